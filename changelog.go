@@ -0,0 +1,219 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zituocn/logx"
+)
+
+// runChangelog 变更日志模式：将合并结果与已存在的C表按key对比，生成 insert/update/delete 变更（通过 Changes() 获取）
+// 并追加写入 ChangelogTable，不改动C表；C表不存在时所有结果行都视为新增
+func (m *Merger) runChangelog(rows []rowData) (*MergeStats, error) {
+	oldRows, fields, err := m.readExistingC()
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]Row
+	m.changes, keys = m.diffAgainstC(rows, oldRows, fields)
+	if err = m.writeChangelog(m.changes, keys); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+	m.infof("[完成] 数据处理任务结束 - %s\n", m.stats.EndTime.Format("2006-01-02 15:04:05"))
+	m.infof("%s", m.stats.String())
+	return &m.stats, nil
+}
+
+// readExistingC 读取已存在的C表中与本次C表字段同名的列，返回记录及参与对比的字段；C表不存在时返回空
+func (m *Merger) readExistingC() ([]rowData, []string, error) {
+	existing, err := m.existingColumns(m.config.TableCSchema, m.config.TableC)
+	if err != nil || len(existing) == 0 {
+		return nil, nil, err
+	}
+	var fields []string
+	for _, f := range m.fieldNamesC {
+		if existing[f] {
+			fields = append(fields, f)
+		}
+	}
+	for _, k := range m.config.KeyFields {
+		if !existing[k] {
+			logx.Errorf("C表%s缺少关键字段%s，无法生成变更日志", m.config.TableC, k)
+			return nil, nil, fmt.Errorf("C表%s缺少关键字段%s，无法生成变更日志", m.config.TableC, k)
+		}
+	}
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = fmt.Sprintf("`%s`", f)
+	}
+	m.infof("[信息] 正在读取已存在的C表(%s)数据...\n", m.config.TableC)
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), m.qualifiedTableC())
+	var rows []rowData
+	_, err = m.scanQuery(m.db, m.config.TableC, fields, query, nil, func(row rowData) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	m.infof("[信息] 已存在的C表共 %d 条记录\n", len(rows))
+	return rows, fields, nil
+}
+
+// diffAgainstC 按key对比新的合并结果与C表原有记录：按结果顺序的 insert/update，随后是按C表顺序的 delete；
+// update 只对比C表中已有的字段，OldValues/NewValues 只包含变化的字段；EmptyKeyExclude 排除的记录不产生变更；
+// 同时返回每个key对应的关键字段值
+func (m *Merger) diffAgainstC(rows, oldRows []rowData, fields []string) ([]ChangeEvent, map[string]Row) {
+	oldByKey := make(map[string]*rowData, len(oldRows))
+	for i := range oldRows {
+		if key, excluded := m.rowKey(&oldRows[i]); !excluded {
+			oldByKey[key] = &oldRows[i]
+		}
+	}
+	var changes []ChangeEvent
+	keys := make(map[string]Row)
+	seen := make(map[string]bool)
+	inserts, updates, deletes := 0, 0, 0
+	for i := range rows {
+		row := &rows[i]
+		key, excluded := m.rowKey(row)
+		if excluded {
+			continue
+		}
+		seen[key] = true
+		keys[key] = m.dataValues(row, m.config.KeyFields)
+		old, ok := oldByKey[key]
+		if !ok {
+			inserts++
+			changes = append(changes, ChangeEvent{Type: ChangeInsert, Key: key, NewValues: m.dataValues(row, m.fieldNamesC)})
+			continue
+		}
+		var changed []string
+		for _, f := range fields {
+			if !valuesEqual(old.Values[f], row.Values[f]) {
+				changed = append(changed, f)
+			}
+		}
+		if len(changed) == 0 {
+			continue
+		}
+		updates++
+		changes = append(changes, ChangeEvent{Type: ChangeUpdate, Key: key, ChangedFields: changed,
+			OldValues: m.dataValues(old, changed), NewValues: m.dataValues(row, changed)})
+	}
+	for i := range oldRows {
+		key, excluded := m.rowKey(&oldRows[i])
+		if excluded || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys[key] = m.dataValues(&oldRows[i], m.config.KeyFields)
+		deletes++
+		changes = append(changes, ChangeEvent{Type: ChangeDelete, Key: key, OldValues: m.dataValues(&oldRows[i], fields)})
+	}
+	m.infof("[信息] 与已存在的C表对比：新增 %d, 更新 %d, 删除 %d\n", inserts, updates, deletes)
+	return changes, keys
+}
+
+// dataValues 返回行中指定字段的值
+func (m *Merger) dataValues(row *rowData, fields []string) Row {
+	values := make(Row, len(fields))
+	for _, f := range fields {
+		values[f] = row.Values[f]
+	}
+	return values
+}
+
+// changelogTable 返回变更日志表名，默认为C表名加 _changelog 后缀
+func (m *Merger) changelogTable() string {
+	if m.config.ChangelogTable != "" {
+		return m.config.ChangelogTable
+	}
+	return m.config.TableC + "_changelog"
+}
+
+// writeChangelog 将变更追加写入变更日志表（与C表同库，不存在时自动创建）；key 及新旧值保存为JSON，
+// 二进制字段以十六进制显示
+func (m *Merger) writeChangelog(changes []ChangeEvent, keys map[string]Row) error {
+	table := m.changelogTable()
+	name := fmt.Sprintf("`%s`", table)
+	if m.config.TableCSchema != "" {
+		name = fmt.Sprintf("`%s`.%s", m.config.TableCSchema, name)
+	}
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  `id` BIGINT NOT NULL AUTO_INCREMENT,\n"+
+		"  `run_id` VARCHAR(32) NOT NULL,\n"+
+		"  `table_c` VARCHAR(255) NOT NULL,\n"+
+		"  `change_type` VARCHAR(10) NOT NULL,\n"+
+		"  `row_key` TEXT NOT NULL,\n"+
+		"  `changed_fields` TEXT NULL,\n"+
+		"  `old_values` LONGTEXT NULL,\n"+
+		"  `new_values` LONGTEXT NULL,\n"+
+		"  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  KEY `idx_run_id` (`run_id`)\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", name)
+	if _, err := m.db.ExecContext(m.runCtx(), createSQL); err != nil {
+		logx.Errorf("创建变更日志表%s失败: %v", table, err)
+		return fmt.Errorf("创建变更日志表%s失败: %v", table, err)
+	}
+	if len(changes) == 0 {
+		m.infof("[信息] 没有变更需要写入\n")
+		return nil
+	}
+
+	const columns = 7
+	for start := 0; start < len(changes); start += m.config.BatchSize {
+		end := min(start+m.config.BatchSize, len(changes))
+		placeholders := make([]string, 0, end-start)
+		args := make([]interface{}, 0, (end-start)*columns)
+		for _, c := range changes[start:end] {
+			rowKey, err := m.changelogJSON(keys[c.Key])
+			if err != nil {
+				return err
+			}
+			oldValues, err := m.changelogJSON(c.OldValues)
+			if err != nil {
+				return err
+			}
+			newValues, err := m.changelogJSON(c.NewValues)
+			if err != nil {
+				return err
+			}
+			var changedFields interface{}
+			if len(c.ChangedFields) > 0 {
+				b, _ := json.Marshal(c.ChangedFields)
+				changedFields = string(b)
+			}
+			placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?, ?)")
+			args = append(args, m.stats.RunID, m.config.TableC, string(c.Type), rowKey, changedFields, oldValues, newValues)
+		}
+		insertSQL := fmt.Sprintf("INSERT INTO %s (`run_id`, `table_c`, `change_type`, `row_key`, `changed_fields`, `old_values`, `new_values`) VALUES %s",
+			name, strings.Join(placeholders, ", "))
+		if _, err := m.db.ExecContext(m.runCtx(), insertSQL, args...); err != nil {
+			logx.Errorf("写入变更日志表%s失败: %v", table, err)
+			return fmt.Errorf("写入变更日志表%s失败: %v", table, err)
+		}
+	}
+	m.infof("[信息] %d 条变更已写入变更日志表 %s (run_id=%s)\n", len(changes), table, m.stats.RunID)
+	return nil
+}
+
+// changelogJSON 将行转换为JSON（二进制字段以十六进制显示），nil 返回 SQL NULL
+func (m *Merger) changelogJSON(values Row) (interface{}, error) {
+	if values == nil {
+		return nil, nil
+	}
+	display := make(map[string]*string, len(values))
+	for f, v := range values {
+		display[f] = m.displayPtr(f, v)
+	}
+	b, err := json.Marshal(display)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
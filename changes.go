@@ -0,0 +1,82 @@
+package reconciler
+
+// ChangeType 变更事件类型
+type ChangeType string
+
+const (
+	// ChangeInsert 仅在B表（新快照）中的记录
+	ChangeInsert ChangeType = "insert"
+	// ChangeUpdate 关键字段相同但其他字段不同的记录
+	ChangeUpdate ChangeType = "update"
+	// ChangeDelete 仅在A表（旧快照）中的记录
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeEvent 将A表视为旧快照、B表视为新快照时的一条变更
+type ChangeEvent struct {
+	Type          ChangeType
+	Key           string   // 关键字段拼接的key
+	ChangedFields []string // 变化的字段，仅 update 有值
+	OldValues     Row      // A表中的记录，insert 时为 nil
+	NewValues     Row      // B表中的记录，delete 时为 nil
+}
+
+// Changes 返回最近一次 ChangeEvents 或 ChangelogMode 模式运行产生的变更事件
+func (m *Merger) Changes() []ChangeEvent {
+	return m.changes
+}
+
+// buildChanges 对比A、B两个快照生成变更事件（按A表顺序的 update/delete，随后是按B表顺序的 insert），
+// 计数沿用 ExactMatch/OnlyInA/OnlyInB/Conflict；不询问用户、不应用冲突策略
+func (m *Merger) buildChanges(dataA []rowData, bIndex rowIndex) error {
+	m.changes = nil
+	m.applyDerivedFields("A", dataA)
+	matched := make(map[string]bool)
+	for i := range dataA {
+		rowA := &dataA[i]
+		key, excluded := m.rowKey(rowA)
+		var rowB *rowData
+		var ok bool
+		if !excluded {
+			var err error
+			if rowB, ok, err = bIndex.get(key); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			m.incStat(&m.stats.OnlyInA)
+			m.changes = append(m.changes, ChangeEvent{Type: ChangeDelete, Key: key, OldValues: Row(rowA.Values)})
+			continue
+		}
+		matched[key] = true
+		if m.config.ShouldCompare != nil && !m.config.ShouldCompare(key, Row(rowA.Values), Row(rowB.Values)) {
+			m.incStat(&m.stats.Uncompared)
+			continue
+		}
+		diffs := m.diffFields(m.compareFields, rowA, rowB)
+		if len(diffs) == 0 {
+			m.incStat(&m.stats.ExactMatch)
+			continue
+		}
+		m.incStat(&m.stats.Conflict)
+		m.changes = append(m.changes, ChangeEvent{Type: ChangeUpdate, Key: key, ChangedFields: diffs,
+			OldValues: Row(rowA.Values), NewValues: Row(rowB.Values)})
+	}
+	err := bIndex.each(func(key string, row *rowData) bool {
+		if !isExcludedKey(key) {
+			if matched[key] {
+				return true
+			}
+			matched[key] = true
+		}
+		m.incStat(&m.stats.OnlyInB)
+		m.changes = append(m.changes, ChangeEvent{Type: ChangeInsert, Key: key, NewValues: Row(row.Values)})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	m.infof("[信息] 共生成 %d 条变更事件（新增 %d, 更新 %d, 删除 %d），未写入C表\n",
+		len(m.changes), m.stats.OnlyInB, m.stats.Conflict, m.stats.OnlyInA)
+	return nil
+}
@@ -0,0 +1,59 @@
+package reconciler
+
+import (
+	"strings"
+	"unicode"
+)
+
+// collationFold 常见带重音的拉丁字母到基础字母的映射，近似 utf8mb4_general_ci 的重音不敏感规则
+var collationFold = map[rune]rune{
+	'À': 'A', 'Á': 'A', 'Â': 'A', 'Ã': 'A', 'Ä': 'A', 'Å': 'A', 'Ā': 'A', 'Ă': 'A', 'Ą': 'A',
+	'Ç': 'C', 'Ć': 'C', 'Ĉ': 'C', 'Ċ': 'C', 'Č': 'C',
+	'Ď': 'D', 'Đ': 'D',
+	'È': 'E', 'É': 'E', 'Ê': 'E', 'Ë': 'E', 'Ē': 'E', 'Ĕ': 'E', 'Ė': 'E', 'Ę': 'E', 'Ě': 'E',
+	'Ĝ': 'G', 'Ğ': 'G', 'Ġ': 'G', 'Ģ': 'G',
+	'Ĥ': 'H', 'Ħ': 'H',
+	'Ì': 'I', 'Í': 'I', 'Î': 'I', 'Ï': 'I', 'Ĩ': 'I', 'Ī': 'I', 'Ĭ': 'I', 'Į': 'I', 'İ': 'I',
+	'Ĵ': 'J',
+	'Ķ': 'K',
+	'Ĺ': 'L', 'Ļ': 'L', 'Ľ': 'L', 'Ŀ': 'L', 'Ł': 'L',
+	'Ñ': 'N', 'Ń': 'N', 'Ņ': 'N', 'Ň': 'N',
+	'Ò': 'O', 'Ó': 'O', 'Ô': 'O', 'Õ': 'O', 'Ö': 'O', 'Ø': 'O', 'Ō': 'O', 'Ŏ': 'O', 'Ő': 'O',
+	'Ŕ': 'R', 'Ŗ': 'R', 'Ř': 'R',
+	'Ś': 'S', 'Ŝ': 'S', 'Ş': 'S', 'Š': 'S',
+	'Ţ': 'T', 'Ť': 'T', 'Ŧ': 'T',
+	'Ù': 'U', 'Ú': 'U', 'Û': 'U', 'Ü': 'U', 'Ũ': 'U', 'Ū': 'U', 'Ŭ': 'U', 'Ů': 'U', 'Ű': 'U', 'Ų': 'U',
+	'Ŵ': 'W',
+	'Ý': 'Y', 'Ÿ': 'Y', 'Ŷ': 'Y',
+	'Ź': 'Z', 'Ż': 'Z', 'Ž': 'Z',
+}
+
+// collationKey 返回值在不区分大小写、不区分重音的排序规则下的比较形式：
+// 先转为大写再去除重音，并忽略末尾空格（与 MySQL PAD SPACE 排序规则一致）
+func collationKey(s string) string {
+	s = strings.TrimRight(s, " ")
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		r = unicode.ToUpper(r)
+		if f, ok := collationFold[r]; ok {
+			r = f
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// collationEqual 判断两个非 NULL 的值在排序规则下是否相同
+func collationEqual(a, b string) bool {
+	return a == b || collationKey(a) == collationKey(b)
+}
+
+// isTextType 判断是否为受排序规则影响的字符串类型
+func isTextType(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext", "enum", "set":
+		return true
+	}
+	return false
+}
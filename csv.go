@@ -0,0 +1,202 @@
+package reconciler
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zituocn/logx"
+)
+
+// CSVMerger CSV文件合并器，使用与 Merger 相同的对比合并逻辑，不连接数据库
+type CSVMerger struct {
+	fileA string
+	fileB string
+	fileC string
+	m     *Merger
+}
+
+// NewCSVMerger 创建CSV合并器：以 fileA 为主表、fileB 为对比表，结果写入 fileC
+// CSV文件首行为表头；config 中的 DSN、表名、BatchSize 等数据库相关配置会被忽略
+func NewCSVMerger(fileA, fileB, fileC string, config MergeConfig) *CSVMerger {
+	return &CSVMerger{
+		fileA: fileA,
+		fileB: fileB,
+		fileC: fileC,
+		m:     NewMerger(config),
+	}
+}
+
+// Stop 请求终止合并，已处理的记录仍会写入结果文件
+func (c *CSVMerger) Stop() {
+	c.m.Stop()
+}
+
+// Stats 返回当前统计信息的副本，可在合并进行中从其他协程调用
+func (c *CSVMerger) Stats() MergeStats {
+	return c.m.Stats()
+}
+
+// WriteTextReport 将最近一次运行收集的冲突写成列对齐的文本报告，见 Merger.WriteTextReport
+func (c *CSVMerger) WriteTextReport(w io.Writer) error {
+	return c.m.WriteTextReport(w)
+}
+
+// Orphans 返回最近一次运行的引用完整性检查结果，见 Merger.Orphans
+func (c *CSVMerger) Orphans() []OrphanReport {
+	return c.m.Orphans()
+}
+
+// Run 执行CSV合并操作
+func (c *CSVMerger) Run() (*MergeStats, error) {
+	stats, err := c.run()
+	if err != nil {
+		c.m.errorf("[错误] CSV数据合并任务失败: %v\n", err)
+	}
+	return stats, err
+}
+
+// run 执行CSV合并操作的各个步骤
+func (c *CSVMerger) run() (*MergeStats, error) {
+	m := c.m
+	m.setStats(func(s *MergeStats) { *s = MergeStats{StartTime: time.Now()} }) // 重置统计
+	m.stopped.Store(false)
+	m.infof("[开始] CSV数据合并任务启动 - %s\n", m.stats.StartTime.Format("2006-01-02 15:04:05"))
+	m.infof("[配置] A文件: [%s] VS B文件: [%s] -> C文件: [%s]\n", c.fileA, c.fileB, c.fileC)
+	m.printConfig()
+
+	// 1. 逐行读取A、B文件
+	fieldsA, dataA, err := readCSV(c.fileA)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, dataB, err := readCSV(c.fileB)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 对比并合并
+	resultRows, err := m.MergeRows(csvColumns(fieldsA), csvColumns(fieldsB), dataA, dataB)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. 写入C文件
+	m.infof("========================================\n")
+	m.infof("[信息] 正在写入C文件(%s)，共 %d 条记录...\n", c.fileC, len(resultRows))
+	if err = writeCSVFile(c.fileC, m.OutputFields(), resultRows); err != nil {
+		return nil, err
+	}
+	if err = m.writeSinks(toRowData(resultRows)); err != nil {
+		return nil, err
+	}
+
+	m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+	m.metricObserve(MetricDurationSeconds, m.stats.EndTime.Sub(m.stats.StartTime).Seconds())
+	m.infof("[完成] 数据处理任务结束 - %s\n", m.stats.EndTime.Format("2006-01-02 15:04:05"))
+	m.infof("%s", m.stats.String())
+
+	return &m.stats, nil
+}
+
+// writeCSVFile 按 fields 的顺序将行写入CSV文件，首行为表头，NULL写为空单元格
+func writeCSVFile(path string, fields []string, rows []Row) error {
+	f, err := os.Create(path)
+	if err != nil {
+		logx.Errorf("创建文件%s失败: %v", path, err)
+		return fmt.Errorf("创建文件%s失败: %v", path, err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err = w.Write(fields); err != nil {
+		logx.Errorf("写入文件%s失败: %v", path, err)
+		return fmt.Errorf("写入文件%s失败: %v", path, err)
+	}
+	record := make([]string, len(fields))
+	for _, row := range rows {
+		for i, name := range fields {
+			if v := row[name]; v != nil {
+				record[i] = *v
+			} else {
+				record[i] = ""
+			}
+		}
+		if err = w.Write(record); err != nil {
+			logx.Errorf("写入文件%s失败: %v", path, err)
+			return fmt.Errorf("写入文件%s失败: %v", path, err)
+		}
+	}
+	w.Flush()
+	if err = w.Error(); err != nil {
+		logx.Errorf("写入文件%s失败: %v", path, err)
+		return fmt.Errorf("写入文件%s失败: %v", path, err)
+	}
+	return nil
+}
+
+// readCSV 逐条读取CSV文件，首行为表头；CSV中没有NULL，空单元格视为空字符串
+func readCSV(path string) ([]string, []Row, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		logx.Errorf("打开文件%s失败: %v", path, err)
+		return nil, nil, fmt.Errorf("打开文件%s失败: %v", path, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.ReuseRecord = true // 值已复制到各行中
+	header, err := r.Read()
+	if err == io.EOF {
+		logx.Errorf("文件%s没有表头", path)
+		return nil, nil, fmt.Errorf("文件%s没有表头", path)
+	}
+	if err != nil {
+		logx.Errorf("解析文件%s失败: %v", path, err)
+		return nil, nil, fmt.Errorf("解析文件%s失败: %v", path, err)
+	}
+	header = append([]string(nil), header...)
+	seen := make(map[string]bool)
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff") // 去除UTF-8 BOM
+		}
+		if name == "" || seen[name] {
+			logx.Errorf("文件%s表头第%d列为空或重复", path, i+1)
+			return nil, nil, fmt.Errorf("文件%s表头第%d列为空或重复", path, i+1)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+
+	var result []Row
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logx.Errorf("解析文件%s失败: %v", path, err)
+			return nil, nil, fmt.Errorf("解析文件%s失败: %v", path, err)
+		}
+		row := make(Row, len(header))
+		for i, name := range header {
+			row[name] = strPtr(rec[i])
+		}
+		result = append(result, row)
+	}
+	return header, result, nil
+}
+
+// csvColumns 根据CSV表头构建列信息（所有列按文本处理）
+func csvColumns(fields []string) []ColumnInfo {
+	cols := make([]ColumnInfo, len(fields))
+	for i, name := range fields {
+		cols[i] = ColumnInfo{Name: name, OrdinalPosition: i + 1, DataType: "text", ColumnType: "text"}
+	}
+	return cols
+}
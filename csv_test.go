@@ -0,0 +1,79 @@
+package reconciler
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVMergerWritesResultAndStats(t *testing.T) {
+	dir := t.TempDir()
+	fileA, fileB, fileC := filepath.Join(dir, "a.csv"), filepath.Join(dir, "b.csv"), filepath.Join(dir, "c.csv")
+	writeFile := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(fileA, "k,name,note\n1,Tom,a\n2,Anna,a\n3,Lily,a\n")
+	writeFile(fileB, "k,name,note\n1,Tom,b\n2,Anne,b\n4,Jack,b\n")
+
+	// note 不参与对比，name 冲突时以B为准；不配置DSN，确认不会连接数据库
+	config := MergeConfig{KeyFields: []string{"k"}, IgnoreFieldsA: []string{"note"}, Strategy: UseB, LogLevel: LogSilent}
+	stats, err := NewCSVMerger(fileA, fileB, fileC, config).Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	f, err := os.Open(fileC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"k", "name", "note", "_source", "_conflict", "_diff_fields"}; !reflect.DeepEqual(records[0], want) {
+		t.Fatalf("表头 = %v, want %v", records[0], want)
+	}
+	got := make(map[string][]string)
+	for _, r := range records[1:] {
+		got[r[0]] = r[1:3]
+	}
+	want := map[string][]string{"1": {"Tom", "a"}, "2": {"Anne", "a"}, "3": {"Lily", "a"}, "4": {"Jack", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("C文件内容 = %v, want %v", got, want)
+	}
+
+	if stats.TotalA != 3 || stats.TotalB != 3 || stats.TotalC != 4 || stats.ExactMatch != 1 ||
+		stats.OnlyInA != 1 || stats.OnlyInB != 1 || stats.Conflict != 1 || stats.ConflictUseB != 1 {
+		t.Errorf("stats = %+v", *stats)
+	}
+}
+
+func TestReadCSVRecordErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.csv")
+	if err := os.WriteFile(path, []byte("\ufeffk,name\n1,Tom\n2,Anna,extra\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// 列数与表头不同的记录在逐条读取时报错
+	if _, _, err := readCSV(path); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("err = %v, want 解析文件失败", err)
+	}
+
+	if err := os.WriteFile(path, []byte("\ufeffk,name\n1,Tom\n2,\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	header, rows, err := readCSV(path)
+	if err != nil {
+		t.Fatalf("readCSV: %v", err)
+	}
+	if !reflect.DeepEqual(header, []string{"k", "name"}) || len(rows) != 2 || value(rows[0], "name") != "Tom" ||
+		value(rows[1], "name") != "" {
+		t.Errorf("header = %v, rows = %d", header, len(rows))
+	}
+}
@@ -0,0 +1,119 @@
+package reconciler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/zituocn/logx"
+)
+
+// decisionEntry 决定日志中的一行：用户对某个key的冲突作出的选择
+type decisionEntry struct {
+	Key    string `json:"key"`
+	Choice string `json:"choice"` // A 或 B
+}
+
+// openDecisionLog 准备决定日志：Resume 时先载入已记录的决定并在文件末尾追加，否则清空重新记录
+func (m *Merger) openDecisionLog() error {
+	m.decisions = nil
+	if m.config.DecisionLog == "" {
+		return nil
+	}
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if m.config.Resume {
+		if err := m.loadDecisions(); err != nil {
+			return err
+		}
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(m.config.DecisionLog, flag, 0644)
+	if err != nil {
+		logx.Errorf("打开决定日志%s失败: %v", m.config.DecisionLog, err)
+		return fmt.Errorf("打开决定日志%s失败: %v", m.config.DecisionLog, err)
+	}
+	m.decisionFile = f
+	return nil
+}
+
+// loadDecisions 载入决定日志中已记录的决定，同一key以最后一条为准；文件不存在时视为没有记录
+func (m *Merger) loadDecisions() error {
+	m.decisions = make(map[string]ConflictStrategy)
+	f, err := os.Open(m.config.DecisionLog)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		logx.Errorf("打开决定日志%s失败: %v", m.config.DecisionLog, err)
+		return fmt.Errorf("打开决定日志%s失败: %v", m.config.DecisionLog, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e decisionEntry
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// 进程中断时最后一行可能不完整，跳过
+			m.infof("[警告] 决定日志第 %d 行无法解析，已跳过: %v\n", line, err)
+			continue
+		}
+		switch e.Choice {
+		case "A":
+			m.decisions[e.Key] = UseA
+		case "B":
+			m.decisions[e.Key] = UseB
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		logx.Errorf("读取决定日志%s失败: %v", m.config.DecisionLog, err)
+		return fmt.Errorf("读取决定日志%s失败: %v", m.config.DecisionLog, err)
+	}
+	m.infof("[信息] 已从决定日志载入 %d 个决定\n", len(m.decisions))
+	return nil
+}
+
+// closeDecisionLog 关闭决定日志
+func (m *Merger) closeDecisionLog() {
+	if m.decisionFile != nil {
+		m.decisionFile.Close()
+		m.decisionFile = nil
+	}
+}
+
+// loggedDecision 返回 Resume 时决定日志中该key已记录的选择
+func (m *Merger) loggedDecision(key string) (ConflictStrategy, bool) {
+	choice, ok := m.decisions[key]
+	if ok {
+		m.incStat(&m.stats.Resumed)
+		name := "A"
+		if choice == UseB {
+			name = "B"
+		}
+		m.conflictf("    [续做] 决定日志中已有选择，以%s表数据为准\n", name)
+	}
+	return choice, ok
+}
+
+// askUser 询问用户选择，用户明确作出的决定（A或B，不含Q终止和读取失败）立即追加写入决定日志
+func (m *Merger) askUser(key string, diffFields []string, rowA, rowB *rowData) ConflictStrategy {
+	choice, answered := m.askUserChoice(diffFields, rowA, rowB)
+	if answered && m.decisionFile != nil {
+		e := decisionEntry{Key: key, Choice: "A"}
+		if choice == UseB {
+			e.Choice = "B"
+		}
+		b, _ := json.Marshal(e)
+		if _, err := m.decisionFile.Write(append(b, '\n')); err != nil {
+			logx.Errorf("写入决定日志%s失败: %v", m.config.DecisionLog, err)
+			m.infof("[警告] 写入决定日志失败: %v\n", err)
+		}
+	}
+	return choice
+}
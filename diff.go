@@ -0,0 +1,138 @@
+package reconciler
+
+import "sort"
+
+// CompareRules 单行对比规则，与 MergeConfig 中的同名配置含义一致
+type CompareRules struct {
+	// 关键字段，不参与对比
+	KeyFields []string
+	// A表中忽略对比的字段
+	IgnoreFieldsA []string
+	// B表中忽略的字段
+	IgnoreFieldsB []string
+	// 按JSON语义对比的字段（忽略空白和键顺序）
+	JSONMergeFields []string
+	// 对比前计算的派生字段，Side 无效或 Compute 为空的忽略
+	DerivedFields []DerivedField
+
+	// 对比时忽略前导零的字段
+	StripLeadingZeros []string
+	// 字符串类型字段按排序规则（不区分大小写/重音、忽略末尾空格）对比
+	CollationCompare bool
+	// 只对这些字段按排序规则对比
+	CollationFields []string
+	// 对比时去除首尾空白并将连续空白视为一个空格
+	CollapseWhitespace bool
+	// 布尔类型字段按布尔值对比，以及识别为真/假的值
+	BooleanAwareCompare bool
+	TruthyValues        []string
+	FalsyValues         []string
+	// 类型不一致字段的对比方式
+	TypeCoercions map[string]TypeCoercion
+	// A为空、B有值时不视为差异的字段，以及视为"无值"的占位值
+	SilentBackfillFields []string
+	NullSentinels        []string
+	FieldNullSentinels   map[string][]string
+
+	// 字段的列信息，用于识别二进制、布尔和字符串类型；未列出的字段按 varchar(255) 处理
+	Columns []ColumnInfo
+}
+
+// FieldDiff 单个字段的差异
+type FieldDiff struct {
+	Field string  // 字段名
+	A     *string // A的值，nil 表示 NULL
+	B     *string // B的值，nil 表示 NULL
+}
+
+// DiffRow 使用与合并相同的对比逻辑比较两行数据，返回值不同的字段（按字段名排序）
+// 仅对比 a 中存在的字段；关键字段、忽略字段以及 b 中不存在的字段不参与对比
+func DiffRow(cfg CompareRules, a, b map[string]*string) []FieldDiff {
+	m := NewMerger(cfg.mergeConfig())
+	a, b = cfg.derive("A", a), cfg.derive("B", b)
+	m.columnsA, m.columnsB = cfg.columns(a), cfg.columns(b)
+	// 与合并相同的字段准备；无效的派生字段已在 mergeConfig 中去掉，不会出错
+	_ = m.initFields()
+
+	rowA := &rowData{Values: a}
+	rowB := &rowData{Values: b}
+	var diffs []FieldDiff
+	for _, f := range m.diffFields(m.compareFields, rowA, rowB) {
+		diffs = append(diffs, FieldDiff{Field: f, A: a[f], B: b[f]})
+	}
+	return diffs
+}
+
+// columns 按字段名顺序返回行中各字段的列信息
+func (r CompareRules) columns(row map[string]*string) []ColumnInfo {
+	known := make(map[string]ColumnInfo, len(r.Columns))
+	for _, c := range r.Columns {
+		known[c.Name] = c
+	}
+	names := make([]string, 0, len(row))
+	for f := range row {
+		names = append(names, f)
+	}
+	sort.Strings(names)
+	cols := make([]ColumnInfo, len(names))
+	for i, f := range names {
+		c, ok := known[f]
+		if !ok {
+			c = ColumnInfo{Name: f, IsNullable: "YES", DataType: "varchar", ColumnType: "varchar(255)"}
+		}
+		c.OrdinalPosition = i + 1
+		cols[i] = c
+	}
+	return cols
+}
+
+// derive 计算指定一侧的派生字段，返回新的行（不修改传入的行）
+func (r CompareRules) derive(side string, row map[string]*string) map[string]*string {
+	if len(r.DerivedFields) == 0 {
+		return row
+	}
+	out := make(map[string]*string, len(row))
+	for k, v := range row {
+		out[k] = v
+	}
+	for _, d := range r.validDerivedFields() {
+		if d.Side == side {
+			out[d.Field] = d.Compute(Row(out))
+		}
+	}
+	return out
+}
+
+// validDerivedFields 返回 Side 为 A 或 B、Compute 不为空的派生字段
+func (r CompareRules) validDerivedFields() []DerivedField {
+	var fields []DerivedField
+	for _, d := range r.DerivedFields {
+		if (d.Side == "A" || d.Side == "B") && d.Compute != nil && d.Field != "" {
+			fields = append(fields, d)
+		}
+	}
+	return fields
+}
+
+// mergeConfig 转换为等价的合并配置
+func (r CompareRules) mergeConfig() MergeConfig {
+	return MergeConfig{
+		KeyFields:            r.KeyFields,
+		IgnoreFieldsA:        r.IgnoreFieldsA,
+		IgnoreFieldsB:        r.IgnoreFieldsB,
+		JSONMergeFields:      r.JSONMergeFields,
+		DerivedFields:        r.validDerivedFields(),
+		StripLeadingZeros:    r.StripLeadingZeros,
+		CollationCompare:     r.CollationCompare,
+		CollationFields:      r.CollationFields,
+		CollapseWhitespace:   r.CollapseWhitespace,
+		BooleanAwareCompare:  r.BooleanAwareCompare,
+		TruthyValues:         r.TruthyValues,
+		FalsyValues:          r.FalsyValues,
+		TypeCoercions:        r.TypeCoercions,
+		SilentBackfillFields: r.SilentBackfillFields,
+		NullSentinels:        r.NullSentinels,
+		FieldNullSentinels:   r.FieldNullSentinels,
+		LogLevel:             LogSilent,
+	}
+}
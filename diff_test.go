@@ -0,0 +1,77 @@
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffRowReportsDifferingFields(t *testing.T) {
+	rules := CompareRules{KeyFields: []string{"k"}, IgnoreFieldsA: []string{"note"}, IgnoreFieldsB: []string{"memo"},
+		JSONMergeFields: []string{"doc"}}
+	a := map[string]*string{"k": strPtr("1"), "name": strPtr("Tom"), "email": nil, "age": strPtr("20"),
+		"note": strPtr("a"), "memo": strPtr("a"), "doc": strPtr(`{"x":1,"y":2}`), "only_a": strPtr("a")}
+	b := map[string]*string{"k": strPtr("2"), "name": strPtr("Tom"), "email": strPtr("b@x.com"), "age": strPtr("21"),
+		"note": strPtr("b"), "memo": strPtr("b"), "doc": strPtr(`{"y":2, "x":1}`)}
+
+	// k 为关键字段，note、memo 被忽略，doc 按JSON语义相同，only_a 在B中不存在
+	want := []FieldDiff{{Field: "age", A: a["age"], B: b["age"]}, {Field: "email", A: nil, B: b["email"]}}
+	if got := DiffRow(rules, a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffRow = %v, want %v", fieldDiffNames(got), fieldDiffNames(want))
+	}
+	if got := DiffRow(rules, a, a); len(got) != 0 {
+		t.Errorf("相同的行 DiffRow = %v, want 空", fieldDiffNames(got))
+	}
+}
+
+func TestDiffRowAppliesNormalization(t *testing.T) {
+	a := map[string]*string{"k": strPtr("1"), "name": strPtr("John  Doe "), "code": strPtr("00123"),
+		"active": strPtr("1"), "email": nil}
+	b := map[string]*string{"k": strPtr("1"), "name": strPtr(" John Doe"), "code": strPtr("123"),
+		"active": strPtr("true"), "email": strPtr("j@x.com")}
+	if got := DiffRow(CompareRules{KeyFields: []string{"k"}}, a, b); !reflect.DeepEqual(fieldDiffNames(got),
+		[]string{"active", "code", "email", "name"}) {
+		t.Errorf("未开启规范化: DiffRow = %v", fieldDiffNames(got))
+	}
+
+	// 与合并相同：空白折叠、忽略前导零、布尔类型按布尔值对比、静默回填字段不视为差异
+	rules := CompareRules{KeyFields: []string{"k"}, CollapseWhitespace: true, StripLeadingZeros: []string{"code"},
+		BooleanAwareCompare: true, SilentBackfillFields: []string{"email"},
+		Columns: []ColumnInfo{{Name: "active", DataType: "tinyint", ColumnType: "tinyint(1)"}}}
+	if got := DiffRow(rules, a, b); len(got) != 0 {
+		t.Errorf("开启规范化: DiffRow = %v, want 空", fieldDiffNames(got))
+	}
+	b["name"] = strPtr("John Smith")
+	if got := DiffRow(rules, a, b); !reflect.DeepEqual(fieldDiffNames(got), []string{"name"}) {
+		t.Errorf("DiffRow = %v, want [name]", fieldDiffNames(got))
+	}
+}
+
+func TestDerivedFieldFullName(t *testing.T) {
+	rules := CompareRules{KeyFields: []string{"k"}, DerivedFields: []DerivedField{{
+		Field: "full_name", Side: "B",
+		Compute: func(row Row) *string {
+			if row["first_name"] == nil || row["last_name"] == nil {
+				return nil
+			}
+			return strPtr(*row["first_name"] + " " + *row["last_name"])
+		},
+	}}}
+	a := map[string]*string{"k": strPtr("1"), "full_name": strPtr("Tom Smith")}
+	b := map[string]*string{"k": strPtr("1"), "first_name": strPtr("Tom"), "last_name": strPtr("Smith")}
+	if got := DiffRow(rules, a, b); len(got) != 0 {
+		t.Errorf("A.full_name 与 B.first_name+last_name 相同，DiffRow = %v", fieldDiffNames(got))
+	}
+	b["last_name"] = strPtr("Jones")
+	if got := DiffRow(rules, a, b); len(got) != 1 || got[0].Field != "full_name" || *got[0].B != "Tom Jones" {
+		t.Errorf("DiffRow = %v, want [full_name]", fieldDiffNames(got))
+	}
+}
+
+// fieldDiffNames 返回差异的字段名，便于输出
+func fieldDiffNames(diffs []FieldDiff) []string {
+	var names []string
+	for _, d := range diffs {
+		names = append(names, d.Field)
+	}
+	return names
+}
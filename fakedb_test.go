@@ -0,0 +1,1135 @@
+package reconciler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试用的内存数据库驱动：按本包生成的SQL语句模拟MySQL的行为（建表、读写、INFORMATION_SCHEMA 查询），
+// 并记录执行过的语句，供不依赖真实数据库的测试使用
+
+const fakeDriverName = "reconciler-fake"
+
+func init() {
+	sql.Register(fakeDriverName, fakeDriver{})
+	sqlDriverName = fakeDriverName
+}
+
+var (
+	fakeMu  sync.Mutex
+	fakeDBs = make(map[string]*fakeDB)
+	fakeSeq int
+)
+
+// fakeDB 一个内存数据库实例，通过 DSN 打开
+type fakeDB struct {
+	dsn       string
+	schema    string // DATABASE() 返回的默认库名
+	maxPacket int64
+
+	// hook 在每条语句执行前调用，返回错误时语句失败；可用于阻塞语句或注入错误
+	hook func(ctx context.Context, query string) error
+
+	mu      sync.Mutex
+	tables  map[string]*fakeTable // key: "库名.表名"
+	log     []fakeStmt
+	connSeq int
+}
+
+// fakeStmt 执行过的一条语句
+type fakeStmt struct {
+	conn  int // 执行语句的连接编号
+	query string
+	args  []driver.Value
+}
+
+type fakeColumn struct {
+	name       string
+	columnType string
+	extra      string
+	def        *string
+	nullable   bool
+}
+
+type fakeIndex struct {
+	name string
+	cols []string
+}
+
+type fakeTable struct {
+	name    string
+	view    bool
+	cols    []fakeColumn
+	unique  []fakeIndex // 主键（名为 PRIMARY）和唯一索引
+	rows    []map[string]*string
+	autoInc int64
+}
+
+// newFakeDB 创建一个空的内存数据库，默认库名为 test
+func newFakeDB(t testing.TB) *fakeDB {
+	t.Helper()
+	fakeMu.Lock()
+	fakeSeq++
+	dsn := fmt.Sprintf("test:test@tcp(fake%d:3306)/test", fakeSeq)
+	db := &fakeDB{dsn: dsn, schema: "test", maxPacket: 4 << 20, tables: make(map[string]*fakeTable)}
+	fakeDBs[dsn] = db
+	fakeMu.Unlock()
+	t.Cleanup(func() {
+		fakeMu.Lock()
+		delete(fakeDBs, dsn)
+		fakeMu.Unlock()
+	})
+	return db
+}
+
+// create 建表，列定义为 "列名 类型 [标记...]"，标记：pk、unique、ai（自增）、notnull、
+// default=值、onupdate（DEFAULT_GENERATED on update CURRENT_TIMESTAMP）
+func (db *fakeDB) create(name string, specs ...string) *fakeTable {
+	tb := &fakeTable{name: name}
+	var pk, uniq []string
+	for _, spec := range specs {
+		parts := strings.Fields(spec)
+		col := fakeColumn{name: parts[0], columnType: parts[1], nullable: true}
+		for _, flag := range parts[2:] {
+			switch {
+			case flag == "pk":
+				pk = append(pk, col.name)
+				col.nullable = false
+			case flag == "unique":
+				uniq = append(uniq, col.name)
+			case flag == "ai":
+				col.extra = "auto_increment"
+				col.nullable = false
+			case flag == "notnull":
+				col.nullable = false
+			case flag == "onupdate":
+				col.extra = "DEFAULT_GENERATED on update CURRENT_TIMESTAMP"
+			case strings.HasPrefix(flag, "default="):
+				col.def = strPtr(strings.TrimPrefix(flag, "default="))
+			default:
+				panic("fakedb: unknown column flag " + flag)
+			}
+		}
+		tb.cols = append(tb.cols, col)
+	}
+	if len(pk) > 0 {
+		tb.unique = append(tb.unique, fakeIndex{name: "PRIMARY", cols: pk})
+	}
+	if len(uniq) > 0 {
+		tb.unique = append(tb.unique, fakeIndex{name: "uk_" + strings.Join(uniq, "_"), cols: uniq})
+	}
+	db.mu.Lock()
+	db.tables[db.schema+"."+name] = tb
+	db.mu.Unlock()
+	return tb
+}
+
+// view 创建一个同名视图（只用于判断对象类型）
+func (db *fakeDB) view(name string) {
+	db.mu.Lock()
+	db.tables[db.schema+"."+name] = &fakeTable{name: name, view: true}
+	db.mu.Unlock()
+}
+
+// vals 一行数据，值为 string 或 nil（NULL）
+type vals map[string]any
+
+// insert 向表中写入测试数据
+func (db *fakeDB) insert(table string, rows ...vals) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tb := db.tables[db.schema+"."+table]
+	for _, r := range rows {
+		row := make(map[string]*string, len(tb.cols))
+		for _, c := range tb.cols {
+			row[c.name] = nil
+		}
+		for k, v := range r {
+			if _, ok := row[k]; !ok {
+				panic("fakedb: unknown column " + k)
+			}
+			if v != nil {
+				row[k] = strPtr(v.(string))
+			}
+		}
+		tb.rows = append(tb.rows, row)
+	}
+}
+
+// table 返回表（不存在时为 nil），调用方只读
+func (db *fakeDB) table(name string) *fakeTable {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.tables[db.schema+"."+name]
+}
+
+// column 返回表的列，不存在时为 nil
+func (tb *fakeTable) column(name string) *fakeColumn {
+	for i := range tb.cols {
+		if tb.cols[i].name == name {
+			return &tb.cols[i]
+		}
+	}
+	return nil
+}
+
+// find 返回字段值为 v 的第一行，没有时为 nil
+func (tb *fakeTable) find(field, v string) map[string]*string {
+	for _, row := range tb.rows {
+		if p := row[field]; p != nil && *p == v {
+			return row
+		}
+	}
+	return nil
+}
+
+// statements 返回包含 substr 的已执行语句
+func (db *fakeDB) statements(substr string) []fakeStmt {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var result []fakeStmt
+	for _, s := range db.log {
+		if strings.Contains(s.query, substr) {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	fakeMu.Lock()
+	db := fakeDBs[dsn]
+	fakeMu.Unlock()
+	if db == nil {
+		return nil, fmt.Errorf("fakedb: unknown dsn %q", dsn)
+	}
+	db.mu.Lock()
+	db.connSeq++
+	id := db.connSeq
+	db.mu.Unlock()
+	return &fakeConn{db: db, id: id}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+	id int
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakePrepared{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if _, _, err := c.db.exec(ctx, c.id, "START TRANSACTION", nil); err != nil {
+		return nil, err
+	}
+	return fakeTx{c}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, _, err := c.db.exec(ctx, c.id, query, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return rows, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	_, n, err := c.db.exec(ctx, c.id, query, namedValues(args))
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+type fakeTx struct{ c *fakeConn }
+
+func (tx fakeTx) Commit() error {
+	_, _, err := tx.c.db.exec(context.Background(), tx.c.id, "COMMIT", nil)
+	return err
+}
+
+func (tx fakeTx) Rollback() error {
+	_, _, err := tx.c.db.exec(context.Background(), tx.c.id, "ROLLBACK", nil)
+	return err
+}
+
+type fakePrepared struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakePrepared) Close() error  { return nil }
+func (s *fakePrepared) NumInput() int { return -1 }
+
+func (s *fakePrepared) Exec(args []driver.Value) (driver.Result, error) {
+	_, n, err := s.conn.db.exec(context.Background(), s.conn.id, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(n), nil
+}
+
+func (s *fakePrepared) Query(args []driver.Value) (driver.Rows, error) {
+	rows, _, err := s.conn.db.exec(context.Background(), s.conn.id, s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if rows == nil {
+		rows = &fakeRows{}
+	}
+	return rows, nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
+
+type fakeRows struct {
+	cols []string
+	data [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.data) {
+		return io.EOF
+	}
+	copy(dest, r.data[r.pos])
+	r.pos++
+	return nil
+}
+
+var (
+	reSelect = regexp.MustCompile(`(?is)^SELECT\s+(DISTINCT\s+)?(.*?)\s+FROM\s+(\S+)(.*)$`)
+	reInsert = regexp.MustCompile(`(?is)^(INSERT|REPLACE)\s+INTO\s+(\S+)\s*\((.*?)\)\s*VALUES\s*(.*)$`)
+	reCreate = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(IF\s+NOT\s+EXISTS\s+)?(\S+)\s*\((.*)\)[^)]*$`)
+	reDrop   = regexp.MustCompile(`(?is)^DROP\s+(TABLE|VIEW)\s+(IF\s+EXISTS\s+)?(\S+)$`)
+	reAlter  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+(\S+)\s+(.*)$`)
+	reLimit  = regexp.MustCompile(`(?i)\s+LIMIT\s+(\d+)(?:\s+OFFSET\s+(\d+))?\s*$`)
+	reDef    = regexp.MustCompile(`(?i)\sDEFAULT\s+('(?:[^']|'')*'|\(.*?\)|\S+)`)
+	reIdents = regexp.MustCompile("`([^`]*)`")
+)
+
+// exec 执行一条语句，查询返回结果集，其它语句返回影响的行数
+func (db *fakeDB) exec(ctx context.Context, conn int, query string, args []driver.Value) (*fakeRows, int64, error) {
+	query = strings.TrimSpace(query)
+	db.mu.Lock()
+	db.log = append(db.log, fakeStmt{conn: conn, query: query, args: args})
+	hook := db.hook
+	db.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	if hook != nil {
+		if err := hook(ctx, query); err != nil {
+			return nil, 0, err
+		}
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	upper := strings.ToUpper(query)
+	switch {
+	case strings.HasPrefix(upper, "SET ") || strings.HasPrefix(upper, "START TRANSACTION") ||
+		upper == "COMMIT" || upper == "ROLLBACK":
+		return nil, 0, nil
+	case upper == "SELECT @@MAX_ALLOWED_PACKET":
+		return &fakeRows{cols: []string{"@@max_allowed_packet"}, data: [][]driver.Value{{db.maxPacket}}}, 0, nil
+	case strings.Contains(upper, "INFORMATION_SCHEMA."):
+		rows, err := db.infoSchema(upper, args)
+		return rows, 0, err
+	case strings.HasPrefix(upper, "SELECT"):
+		rows, err := db.selectRows(query, args)
+		return rows, 0, err
+	case strings.HasPrefix(upper, "INSERT") || strings.HasPrefix(upper, "REPLACE"):
+		n, err := db.insertRows(query, args)
+		return nil, n, err
+	case strings.HasPrefix(upper, "CREATE TABLE"):
+		return nil, 0, db.createTable(query)
+	case strings.HasPrefix(upper, "DROP"):
+		return nil, 0, db.dropTable(query)
+	case strings.HasPrefix(upper, "ALTER TABLE"):
+		return nil, 0, db.alterTable(query)
+	}
+	return nil, 0, fmt.Errorf("fakedb: unsupported statement: %s", query)
+}
+
+// ref 解析 `库`.`表` 或 `表`，返回表的 key
+func (db *fakeDB) ref(s string) (key, name string) {
+	s = strings.ReplaceAll(s, "`", "")
+	if i := strings.Index(s, "."); i >= 0 {
+		return s, s[i+1:]
+	}
+	return db.schema + "." + s, s
+}
+
+func (db *fakeDB) lookup(s string) (*fakeTable, error) {
+	key, _ := db.ref(s)
+	tb := db.tables[key]
+	if tb == nil {
+		return nil, fmt.Errorf("Error 1146: Table '%s' doesn't exist", key)
+	}
+	return tb, nil
+}
+
+func (db *fakeDB) infoSchema(upper string, args []driver.Value) (*fakeRows, error) {
+	schemaTable := func() *fakeTable {
+		schema := fakeString(args[0])
+		if schema == "" {
+			schema = db.schema
+		}
+		return db.tables[schema+"."+fakeString(args[1])]
+	}
+	switch {
+	case strings.Contains(upper, "INFORMATION_SCHEMA.COLUMNS") && strings.Contains(upper, "ORDINAL_POSITION"):
+		rows := &fakeRows{cols: []string{"COLUMN_NAME", "ORDINAL_POSITION", "COLUMN_DEFAULT", "IS_NULLABLE",
+			"DATA_TYPE", "COLUMN_TYPE", "EXTRA"}}
+		tb := db.tables[db.schema+"."+fakeString(args[0])]
+		if tb == nil {
+			return rows, nil
+		}
+		for i, c := range tb.cols {
+			var def driver.Value
+			if c.def != nil {
+				def = *c.def
+			}
+			nullable := "YES"
+			if !c.nullable {
+				nullable = "NO"
+			}
+			dataType := strings.ToLower(c.columnType)
+			if j := strings.IndexAny(dataType, "( "); j >= 0 {
+				dataType = dataType[:j]
+			}
+			rows.data = append(rows.data, []driver.Value{c.name, int64(i + 1), def, nullable, dataType, c.columnType, c.extra})
+		}
+		return rows, nil
+	case strings.Contains(upper, "INFORMATION_SCHEMA.COLUMNS"):
+		rows := &fakeRows{cols: []string{"COLUMN_NAME"}}
+		if tb := schemaTable(); tb != nil {
+			for _, c := range tb.cols {
+				rows.data = append(rows.data, []driver.Value{c.name})
+			}
+		}
+		return rows, nil
+	case strings.Contains(upper, "INFORMATION_SCHEMA.STATISTICS"):
+		rows := &fakeRows{cols: []string{"INDEX_NAME", "COLUMN_NAME"}}
+		if tb := db.tables[db.schema+"."+fakeString(args[0])]; tb != nil {
+			for _, idx := range tb.unique {
+				for _, c := range idx.cols {
+					rows.data = append(rows.data, []driver.Value{idx.name, c})
+				}
+			}
+		}
+		return rows, nil
+	case strings.Contains(upper, "INFORMATION_SCHEMA.TABLES"):
+		rows := &fakeRows{cols: []string{"TABLE_TYPE"}}
+		if tb := schemaTable(); tb != nil {
+			typ := "BASE TABLE"
+			if tb.view {
+				typ = "VIEW"
+			}
+			rows.data = append(rows.data, []driver.Value{typ})
+		}
+		return rows, nil
+	}
+	return nil, fmt.Errorf("fakedb: unsupported INFORMATION_SCHEMA query: %s", upper)
+}
+
+func (db *fakeDB) selectRows(query string, args []driver.Value) (*fakeRows, error) {
+	m := reSelect.FindStringSubmatch(query)
+	if m == nil {
+		return nil, fmt.Errorf("fakedb: unsupported SELECT: %s", query)
+	}
+	distinct, list, rest := m[1] != "", strings.TrimSpace(m[2]), m[4]
+	tb, err := db.lookup(m[3])
+	if err != nil {
+		return nil, err
+	}
+
+	limit, offset := -1, 0
+	if lm := reLimit.FindStringSubmatchIndex(rest); lm != nil {
+		limit, _ = strconv.Atoi(rest[lm[2]:lm[3]])
+		if lm[4] >= 0 {
+			offset, _ = strconv.Atoi(rest[lm[4]:lm[5]])
+		}
+		rest = rest[:lm[0]]
+	}
+	var orderBy []string
+	if i := strings.Index(strings.ToUpper(rest), " ORDER BY "); i >= 0 {
+		for _, id := range reIdents.FindAllStringSubmatch(rest[i:], -1) {
+			orderBy = append(orderBy, id[1])
+		}
+		rest = rest[:i]
+	}
+	cond := func(map[string]*string) bool { return true }
+	if rest = strings.TrimSpace(rest); rest != "" {
+		if !strings.HasPrefix(strings.ToUpper(rest), "WHERE ") {
+			return nil, fmt.Errorf("fakedb: unsupported SELECT: %s", query)
+		}
+		p := &fakeParser{toks: fakeTokens(rest[6:]), args: args}
+		if cond, err = p.parse(); err != nil {
+			return nil, fmt.Errorf("fakedb: %v: %s", err, query)
+		}
+	}
+
+	var matched []map[string]*string
+	for _, row := range tb.rows {
+		if cond(row) {
+			matched = append(matched, row)
+		}
+	}
+	if len(orderBy) > 0 {
+		sort.SliceStable(matched, func(i, j int) bool {
+			for _, f := range orderBy {
+				if c := fakeCompareNullsFirst(matched[i][f], matched[j][f]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	if strings.EqualFold(list, "COUNT(*)") {
+		return &fakeRows{cols: []string{"COUNT(*)"}, data: [][]driver.Value{{int64(len(matched))}}}, nil
+	}
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	matched = matched[offset:]
+	if limit >= 0 && limit < len(matched) {
+		matched = matched[:limit]
+	}
+
+	var fields []string
+	if list == "*" {
+		for _, c := range tb.cols {
+			fields = append(fields, c.name)
+		}
+	} else {
+		for _, id := range reIdents.FindAllStringSubmatch(list, -1) {
+			if tb.column(id[1]) == nil {
+				return nil, fmt.Errorf("Error 1054: Unknown column '%s' in 'field list'", id[1])
+			}
+			fields = append(fields, id[1])
+		}
+	}
+	rows := &fakeRows{cols: fields}
+	seen := make(map[string]bool)
+	for _, row := range matched {
+		values := make([]driver.Value, len(fields))
+		var sig strings.Builder
+		for i, f := range fields {
+			if v := row[f]; v != nil {
+				values[i] = *v
+				sig.WriteString(*v)
+			} else {
+				sig.WriteString("\x00")
+			}
+			sig.WriteString("\x01")
+		}
+		if distinct {
+			if seen[sig.String()] {
+				continue
+			}
+			seen[sig.String()] = true
+		}
+		rows.data = append(rows.data, values)
+	}
+	return rows, nil
+}
+
+func (db *fakeDB) insertRows(query string, args []driver.Value) (int64, error) {
+	m := reInsert.FindStringSubmatch(query)
+	if m == nil {
+		return 0, fmt.Errorf("fakedb: unsupported INSERT: %s", query)
+	}
+	replace := strings.EqualFold(m[1], "REPLACE")
+	upsert := strings.Contains(strings.ToUpper(m[4]), "ON DUPLICATE KEY UPDATE")
+	tb, err := db.lookup(m[2])
+	if err != nil {
+		return 0, err
+	}
+	var cols []string
+	for _, id := range reIdents.FindAllStringSubmatch(m[3], -1) {
+		if tb.column(id[1]) == nil {
+			return 0, fmt.Errorf("Error 1054: Unknown column '%s' in 'field list'", id[1])
+		}
+		cols = append(cols, id[1])
+	}
+	if len(cols) == 0 || len(args)%len(cols) != 0 {
+		return 0, fmt.Errorf("fakedb: %d args for %d columns: %s", len(args), len(cols), query)
+	}
+	var affected int64
+	for start := 0; start < len(args); start += len(cols) {
+		row := make(map[string]*string, len(tb.cols))
+		for _, c := range tb.cols {
+			row[c.name] = c.def
+			if c.def != nil && strings.HasPrefix(strings.ToUpper(*c.def), "CURRENT_TIMESTAMP") {
+				row[c.name] = strPtr(time.Now().Format("2006-01-02 15:04:05"))
+			}
+		}
+		for i, c := range cols {
+			row[c] = fakeValue(args[start+i])
+		}
+		for _, c := range tb.cols {
+			if strings.Contains(c.extra, "auto_increment") {
+				if v := row[c.name]; v == nil {
+					tb.autoInc++
+					row[c.name] = strPtr(strconv.FormatInt(tb.autoInc, 10))
+				} else if n, err := strconv.ParseInt(*v, 10, 64); err == nil && n > tb.autoInc {
+					tb.autoInc = n
+				}
+			}
+		}
+		dup := tb.duplicates(row)
+		switch {
+		case len(dup) > 0 && replace:
+			tb.deleteRows(dup)
+			affected += int64(len(dup))
+		case len(dup) > 0 && upsert:
+			for _, c := range cols {
+				tb.rows[dup[0]][c] = row[c]
+			}
+			affected += 2
+			continue
+		case len(dup) > 0:
+			return affected, fmt.Errorf("Error 1062: Duplicate entry for key '%s'", tb.name)
+		}
+		tb.rows = append(tb.rows, row)
+		affected++
+	}
+	return affected, nil
+}
+
+// duplicates 返回与 row 在主键或唯一索引上重复的行下标（含 NULL 的唯一键不视为重复）
+func (tb *fakeTable) duplicates(row map[string]*string) []int {
+	var result []int
+	for i, existing := range tb.rows {
+		for _, idx := range tb.unique {
+			same := true
+			for _, c := range idx.cols {
+				if row[c] == nil || existing[c] == nil || *row[c] != *existing[c] {
+					same = false
+					break
+				}
+			}
+			if same {
+				result = append(result, i)
+				break
+			}
+		}
+	}
+	return result
+}
+
+func (tb *fakeTable) deleteRows(idx []int) {
+	drop := make(map[int]bool, len(idx))
+	for _, i := range idx {
+		drop[i] = true
+	}
+	kept := tb.rows[:0]
+	for i, row := range tb.rows {
+		if !drop[i] {
+			kept = append(kept, row)
+		}
+	}
+	tb.rows = kept
+}
+
+func (db *fakeDB) createTable(query string) error {
+	m := reCreate.FindStringSubmatch(query)
+	if m == nil {
+		return fmt.Errorf("fakedb: unsupported CREATE TABLE: %s", query)
+	}
+	key, name := db.ref(m[2])
+	if db.tables[key] != nil {
+		if m[1] != "" {
+			return nil
+		}
+		return fmt.Errorf("Error 1050: Table '%s' already exists", name)
+	}
+	tb := &fakeTable{name: name}
+	for _, def := range fakeSplit(m[3]) {
+		upper := strings.ToUpper(def)
+		switch {
+		case strings.HasPrefix(upper, "PRIMARY KEY"):
+			tb.unique = append(tb.unique, fakeIndex{name: "PRIMARY", cols: fakeIdentList(def)})
+		case strings.HasPrefix(upper, "UNIQUE"):
+			ids := fakeIdentList(def)
+			tb.unique = append(tb.unique, fakeIndex{name: ids[0], cols: ids[1:]})
+		case strings.HasPrefix(upper, "KEY") || strings.HasPrefix(upper, "INDEX"):
+		default:
+			col, err := fakeParseColumn(def)
+			if err != nil {
+				return err
+			}
+			if tb.column(col.name) != nil {
+				return fmt.Errorf("Error 1060: Duplicate column name '%s'", col.name)
+			}
+			if strings.Contains(upper, "PRIMARY KEY") {
+				tb.unique = append(tb.unique, fakeIndex{name: "PRIMARY", cols: []string{col.name}})
+			}
+			tb.cols = append(tb.cols, col)
+		}
+	}
+	db.tables[key] = tb
+	return nil
+}
+
+func (db *fakeDB) dropTable(query string) error {
+	m := reDrop.FindStringSubmatch(query)
+	if m == nil {
+		return fmt.Errorf("fakedb: unsupported DROP: %s", query)
+	}
+	key, name := db.ref(m[3])
+	tb := db.tables[key]
+	if tb == nil {
+		if m[2] != "" {
+			return nil
+		}
+		return fmt.Errorf("Error 1051: Unknown table '%s'", name)
+	}
+	if view := strings.EqualFold(m[1], "VIEW"); view != tb.view {
+		return fmt.Errorf("Error 1347: '%s' is not of the expected type", key)
+	}
+	delete(db.tables, key)
+	return nil
+}
+
+func (db *fakeDB) alterTable(query string) error {
+	m := reAlter.FindStringSubmatch(query)
+	if m == nil {
+		return fmt.Errorf("fakedb: unsupported ALTER TABLE: %s", query)
+	}
+	tb, err := db.lookup(m[1])
+	if err != nil {
+		return err
+	}
+	for _, spec := range fakeSplit(m[2]) {
+		if !strings.HasPrefix(strings.ToUpper(spec), "ADD COLUMN ") {
+			return fmt.Errorf("fakedb: unsupported ALTER TABLE: %s", query)
+		}
+		col, err := fakeParseColumn(strings.TrimSpace(spec[len("ADD COLUMN "):]))
+		if err != nil {
+			return err
+		}
+		if tb.column(col.name) != nil {
+			return fmt.Errorf("Error 1060: Duplicate column name '%s'", col.name)
+		}
+		tb.cols = append(tb.cols, col)
+		for _, row := range tb.rows {
+			row[col.name] = col.def
+		}
+	}
+	return nil
+}
+
+// fakeParseColumn 解析 `列名` 类型 [NOT NULL|NULL] [DEFAULT ...] [AUTO_INCREMENT] ... 形式的列定义
+func fakeParseColumn(def string) (fakeColumn, error) {
+	if !strings.HasPrefix(def, "`") {
+		return fakeColumn{}, fmt.Errorf("fakedb: unsupported column definition: %s", def)
+	}
+	end := strings.Index(def[1:], "`") + 1
+	col := fakeColumn{name: def[1:end], nullable: true}
+	rest := strings.TrimSpace(def[end+1:])
+	depth, quoted, i := 0, false, 0
+	for ; i < len(rest); i++ {
+		c := rest[i]
+		if c == '\'' {
+			quoted = !quoted
+		} else if !quoted && c == '(' {
+			depth++
+		} else if !quoted && c == ')' {
+			depth--
+		} else if !quoted && depth == 0 && c == ' ' {
+			break
+		}
+	}
+	col.columnType = strings.ToLower(rest[:i])
+	if k := strings.Index(col.columnType, "("); k >= 0 &&
+		(strings.HasPrefix(col.columnType, "enum") || strings.HasPrefix(col.columnType, "set")) {
+		col.columnType = col.columnType[:k] + rest[k:i]
+	}
+	attrs := rest[i:]
+	upper := strings.ToUpper(attrs)
+	if strings.Contains(upper, "NOT NULL") {
+		col.nullable = false
+	}
+	if strings.Contains(upper, "AUTO_INCREMENT") {
+		col.extra = "auto_increment"
+	}
+	if strings.Contains(upper, "ON UPDATE") {
+		col.extra = "on update CURRENT_TIMESTAMP"
+	}
+	if dm := reDef.FindStringSubmatch(attrs); dm != nil && !strings.EqualFold(dm[1], "NULL") {
+		v := dm[1]
+		if strings.HasPrefix(v, "'") {
+			v = strings.ReplaceAll(v[1:len(v)-1], "''", "'")
+		}
+		col.def = &v
+	}
+	return col, nil
+}
+
+// fakeSplit 按顶层逗号拆分（忽略括号和引号内的逗号），并去掉首尾空白
+func fakeSplit(s string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+func fakeIdentList(s string) []string {
+	var ids []string
+	for _, id := range reIdents.FindAllStringSubmatch(s, -1) {
+		ids = append(ids, id[1])
+	}
+	return ids
+}
+
+// fakeValue 将语句参数转换为存储的字符串值
+func fakeValue(v driver.Value) *string {
+	if v == nil {
+		return nil
+	}
+	return strPtr(fakeString(v))
+}
+
+func fakeString(v driver.Value) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		if x {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		return x.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(v)
+}
+
+// fakeCompare 比较两个非 NULL 值：都是数字时按数值，否则按字符串
+func fakeCompare(a, b string) int {
+	fa, errA := strconv.ParseFloat(a, 64)
+	fb, errB := strconv.ParseFloat(b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+// fakeCompareNullsFirst 排序用的比较，NULL 排在最前
+func fakeCompareNullsFirst(a, b *string) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return fakeCompare(*a, *b)
+}
+
+// fakeTokens 将 WHERE 子句拆分为标识符（保留反引号）、占位符、括号、逗号、运算符和关键字
+func fakeTokens(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\n' || c == '\t':
+			i++
+		case c == '`':
+			end := strings.Index(s[i+1:], "`") + i + 2
+			toks = append(toks, s[i:end])
+			i = end
+		case strings.HasPrefix(s[i:], "<=>"):
+			toks = append(toks, "<=>")
+			i += 3
+		case strings.HasPrefix(s[i:], ">=") || strings.HasPrefix(s[i:], "<=") ||
+			strings.HasPrefix(s[i:], "<>") || strings.HasPrefix(s[i:], "!="):
+			toks = append(toks, s[i:i+2])
+			i += 2
+		case strings.ContainsRune("?(),=<>", rune(c)):
+			toks = append(toks, string(c))
+			i++
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \n\t`?(),=<>!", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, strings.ToUpper(s[i:j]))
+			i = j
+		}
+	}
+	return toks
+}
+
+// fakeParser 解析并求值本包生成的 WHERE 条件：比较、IS [NOT] NULL、<=>、行值比较、AND/OR 与括号
+type fakeParser struct {
+	toks []string
+	pos  int
+	args []driver.Value
+	arg  int
+}
+
+type fakeCond func(row map[string]*string) bool
+
+func (p *fakeParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *fakeParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *fakeParser) expect(t string) error {
+	if got := p.next(); got != t {
+		return fmt.Errorf("expect %q, got %q", t, got)
+	}
+	return nil
+}
+
+func (p *fakeParser) placeholder() (*string, error) {
+	if err := p.expect("?"); err != nil {
+		return nil, err
+	}
+	if p.arg >= len(p.args) {
+		return nil, fmt.Errorf("not enough args")
+	}
+	v := fakeValue(p.args[p.arg])
+	p.arg++
+	return v, nil
+}
+
+func (p *fakeParser) parse() (fakeCond, error) {
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.toks) {
+		return nil, fmt.Errorf("unexpected %q", p.peek())
+	}
+	return cond, nil
+}
+
+func (p *fakeParser) parseOr() (fakeCond, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]*string) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *fakeParser) parseAnd() (fakeCond, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "AND" {
+		p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(row map[string]*string) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *fakeParser) parsePrimary() (fakeCond, error) {
+	if p.peek() == "(" {
+		if p.pos+3 < len(p.toks) && strings.HasPrefix(p.toks[p.pos+1], "`") &&
+			(p.toks[p.pos+2] == "," || p.toks[p.pos+2] == ")" && fakeIsOp(p.toks[p.pos+3])) {
+			return p.parseTuple()
+		}
+		p.next()
+		cond, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+	field := p.next()
+	if !strings.HasPrefix(field, "`") {
+		return nil, fmt.Errorf("expect column, got %q", field)
+	}
+	field = strings.Trim(field, "`")
+	op := p.next()
+	if op == "IS" {
+		not := p.peek() == "NOT"
+		if not {
+			p.next()
+		}
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return func(row map[string]*string) bool { return (row[field] == nil) != not }, nil
+	}
+	v, err := p.placeholder()
+	if err != nil {
+		return nil, err
+	}
+	if op == "<=>" {
+		return func(row map[string]*string) bool {
+			a := row[field]
+			return (a == nil && v == nil) || (a != nil && v != nil && fakeCompare(*a, *v) == 0)
+		}, nil
+	}
+	return func(row map[string]*string) bool {
+		a := row[field]
+		return a != nil && v != nil && fakeOp(op, fakeCompare(*a, *v))
+	}, nil
+}
+
+// parseTuple 解析 (`a`, `b`) op (?, ?) 形式的行值比较，按字典序比较，遇到 NULL 结果为假
+func (p *fakeParser) parseTuple() (fakeCond, error) {
+	p.next()
+	var fields []string
+	for {
+		f := p.next()
+		if !strings.HasPrefix(f, "`") {
+			return nil, fmt.Errorf("expect column, got %q", f)
+		}
+		fields = append(fields, strings.Trim(f, "`"))
+		if sep := p.next(); sep == ")" {
+			break
+		} else if sep != "," {
+			return nil, fmt.Errorf("expect ',' or ')', got %q", sep)
+		}
+	}
+	op := p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	values := make([]*string, len(fields))
+	for i := range fields {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		v, err := p.placeholder()
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return func(row map[string]*string) bool {
+		for i, f := range fields {
+			a := row[f]
+			if a == nil || values[i] == nil {
+				return false
+			}
+			if c := fakeCompare(*a, *values[i]); c != 0 || i == len(fields)-1 {
+				return fakeOp(op, c)
+			}
+		}
+		return false
+	}, nil
+}
+
+func fakeIsOp(t string) bool {
+	switch t {
+	case "=", "<>", "!=", ">", ">=", "<", "<=":
+		return true
+	}
+	return false
+}
+
+func fakeOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<>", "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	}
+	return false
+}
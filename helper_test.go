@@ -0,0 +1,122 @@
+package reconciler
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+// row 按 "字段, 值, 字段, 值..." 构造一行数据，值为 nil 表示 NULL
+func row(kv ...any) rowData {
+	r := rowData{Values: make(map[string]*string, len(kv)/2)}
+	for i := 0; i < len(kv); i += 2 {
+		if v := kv[i+1]; v != nil {
+			r.Values[kv[i].(string)] = strPtr(v.(string))
+		} else {
+			r.Values[kv[i].(string)] = nil
+		}
+	}
+	return r
+}
+
+// textCols 按字段名构造 varchar(255) 的列信息
+func textCols(names ...string) []ColumnInfo {
+	cols := make([]ColumnInfo, len(names))
+	for i, n := range names {
+		cols[i] = ColumnInfo{Name: n, OrdinalPosition: i + 1, IsNullable: "YES",
+			DataType: "varchar", ColumnType: "varchar(255)"}
+	}
+	return cols
+}
+
+// newMemMerger 创建不连接数据库、直接使用给定列信息的合并器
+func newMemMerger(t testing.TB, config MergeConfig, colsA, colsB []ColumnInfo) *Merger {
+	t.Helper()
+	if config.LogLevel == LogInfo {
+		config.LogLevel = LogSilent
+	}
+	m := NewMerger(config)
+	m.columnsA, m.columnsB = colsA, colsB
+	if err := m.initFields(); err != nil {
+		t.Fatalf("initFields: %v", err)
+	}
+	return m
+}
+
+// mergeMem 在内存中对比合并A、B数据，返回结果行和合并器
+func mergeMem(t testing.TB, config MergeConfig, colsA, colsB []ColumnInfo, dataA, dataB []rowData) ([]rowData, *Merger) {
+	t.Helper()
+	m := newMemMerger(t, config, colsA, colsB)
+	rows, err := m.mergeRows(dataA, dataB)
+	if err != nil {
+		t.Fatalf("mergeRows: %v", err)
+	}
+	return rows, m
+}
+
+// value 返回字段值，NULL 返回 "<NULL>"
+func value(values map[string]*string, f string) string {
+	if v := values[f]; v != nil {
+		return *v
+	}
+	return "<NULL>"
+}
+
+// findRow 返回字段值为 v 的第一行，没有时为 nil
+func findRow(rows []rowData, field, v string) *rowData {
+	for i := range rows {
+		if p := rows[i].Values[field]; p != nil && *p == v {
+			return &rows[i]
+		}
+	}
+	return nil
+}
+
+// captureStdout 执行 fn 并返回其间写入标准输出的内容
+func captureStdout(t testing.TB, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.Bytes()
+	}()
+	defer func() { os.Stdout = stdout }()
+	fn()
+	w.Close()
+	os.Stdout = stdout
+	return string(<-done)
+}
+
+// newFakeSources 创建包含A表 a、B表 b 的内存数据库，两表的列相同
+func newFakeSources(t testing.TB, specs ...string) *fakeDB {
+	t.Helper()
+	db := newFakeDB(t)
+	db.create("a", specs...)
+	db.create("b", specs...)
+	return db
+}
+
+// fakeConfig 返回读写 db 中 a、b、c 表的合并配置
+func fakeConfig(db *fakeDB, keys ...string) MergeConfig {
+	return MergeConfig{DSN: db.dsn, TableA: "a", TableB: "b", TableC: "c", KeyFields: keys,
+		Strategy: UseA, LogLevel: LogSilent}
+}
+
+// runFake 运行合并，失败时终止测试
+func runFake(t testing.TB, config MergeConfig) (*MergeStats, *Merger) {
+	t.Helper()
+	m := NewMerger(config)
+	stats, err := m.Run()
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	return stats, m
+}
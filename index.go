@@ -0,0 +1,354 @@
+package reconciler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zituocn/logx"
+)
+
+// rowIndex B表按key建立的索引，用于对比时查找与A表匹配的记录
+type rowIndex interface {
+	// get 按key查找记录，key重复时返回最后一条；EmptyKeyExclude 排除的记录不会被找到
+	get(key string) (*rowData, bool, error)
+	// each 按读取顺序遍历全部记录（包括key重复的记录），fn 返回 false 时停止
+	each(fn func(key string, row *rowData) bool) error
+	// len 返回记录数
+	len() int
+	// close 释放索引占用的资源
+	close()
+}
+
+// memIndex 内存索引（默认）
+type memIndex struct {
+	rows  []rowData
+	keys  []string
+	byKey map[string]*rowData
+}
+
+// newMemIndex 为已读入内存的B表数据建立索引
+func (m *Merger) newMemIndex(rows []rowData) *memIndex {
+	idx := &memIndex{rows: rows, keys: make([]string, len(rows)), byKey: make(map[string]*rowData, len(rows))}
+	for i := range rows {
+		key, excluded := m.rowKey(&rows[i])
+		idx.keys[i] = key
+		if !excluded {
+			idx.byKey[key] = &rows[i]
+		}
+	}
+	return idx
+}
+
+func (idx *memIndex) get(key string) (*rowData, bool, error) {
+	row, ok := idx.byKey[key]
+	return row, ok, nil
+}
+
+func (idx *memIndex) each(fn func(key string, row *rowData) bool) error {
+	for i := range idx.rows {
+		if !fn(idx.keys[i], &idx.rows[i]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (idx *memIndex) len() int {
+	return len(idx.rows)
+}
+
+func (idx *memIndex) close() {}
+
+// diskEntry 记录在临时文件中的位置
+type diskEntry struct {
+	key    string
+	offset int64
+	size   int
+}
+
+// diskIndex 磁盘索引：记录按JSON逐行写入临时文件，内存中只保留key和文件偏移，查找时按偏移读回
+type diskIndex struct {
+	file   *os.File
+	w      *bufio.Writer
+	offset int64
+	order  []diskEntry
+	byKey  map[string]int // key -> order 中的下标
+}
+
+// newDiskIndex 在 dir（为空时使用系统临时目录）中创建磁盘索引的临时文件
+func newDiskIndex(dir string) (*diskIndex, error) {
+	f, err := os.CreateTemp(dir, "reconciler-index-*.jsonl")
+	if err != nil {
+		logx.Errorf("创建磁盘索引临时文件失败: %v", err)
+		return nil, fmt.Errorf("创建磁盘索引临时文件失败: %v", err)
+	}
+	return &diskIndex{file: f, w: bufio.NewWriter(f), byKey: make(map[string]int)}, nil
+}
+
+// add 追加一条记录
+func (idx *diskIndex) add(key string, row rowData) error {
+	data, err := json.Marshal(encodeDiskRow(row))
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err = idx.w.Write(data); err != nil {
+		return err
+	}
+	if !isExcludedKey(key) {
+		idx.byKey[key] = len(idx.order)
+	}
+	idx.order = append(idx.order, diskEntry{key: key, offset: idx.offset, size: len(data) - 1})
+	idx.offset += int64(len(data))
+	return nil
+}
+
+// readDiskIndex 逐行读取表数据并写入磁盘索引，不在内存中保留整行数据；按 FilterB 过滤并在写入前计算派生字段
+func (m *Merger) readDiskIndex(side string, db queryer, tableName string, fieldNames []string) (*diskIndex, error) {
+	idx, err := newDiskIndex(m.config.TempDir)
+	if err != nil {
+		return nil, err
+	}
+	n := 0
+	err = m.scanTable(db, tableName, fieldNames, 0, func(row rowData) error {
+		if side == "B" && m.config.FilterB != nil && !m.config.FilterB(Row(row.Values)) {
+			m.addFiltered(side, 1)
+			return nil
+		}
+		n++
+		if err := m.checkEmptyKey(side, n, &row); err != nil {
+			return err
+		}
+		m.applyDerivedFields(side, []rowData{row})
+		return idx.add(m.buildKey(&row), row)
+	})
+	if err == nil {
+		err = idx.w.Flush()
+	}
+	if err != nil {
+		idx.close()
+		logx.Errorf("写入磁盘索引失败: %v", err)
+		return nil, fmt.Errorf("写入磁盘索引失败: %v", err)
+	}
+	return idx, nil
+}
+
+// read 按位置从临时文件读回记录（ReadAt 可并发调用）
+func (idx *diskIndex) read(e diskEntry) (*rowData, error) {
+	buf := make([]byte, e.size)
+	if _, err := idx.file.ReadAt(buf, e.offset); err != nil {
+		logx.Errorf("读取磁盘索引失败: %v", err)
+		return nil, fmt.Errorf("读取磁盘索引失败: %v", err)
+	}
+	var raw map[string][]byte
+	if err := json.Unmarshal(buf, &raw); err != nil {
+		logx.Errorf("解析磁盘索引记录失败: %v", err)
+		return nil, fmt.Errorf("解析磁盘索引记录失败: %v", err)
+	}
+	row := rowData{Values: make(map[string]*string, len(raw))}
+	for f, v := range raw {
+		if v == nil {
+			row.Values[f] = nil
+		} else {
+			row.Values[f] = strPtr(string(v))
+		}
+	}
+	return &row, nil
+}
+
+// encodeDiskRow 将记录转换为按字节保存的形式（JSON中为base64，二进制数据不会被改写），nil 表示 NULL
+func encodeDiskRow(row rowData) map[string][]byte {
+	raw := make(map[string][]byte, len(row.Values))
+	for f, v := range row.Values {
+		if v == nil {
+			raw[f] = nil
+		} else {
+			raw[f] = []byte(*v)
+		}
+	}
+	return raw
+}
+
+func (idx *diskIndex) get(key string) (*rowData, bool, error) {
+	i, ok := idx.byKey[key]
+	if !ok {
+		return nil, false, nil
+	}
+	row, err := idx.read(idx.order[i])
+	if err != nil {
+		return nil, false, err
+	}
+	return row, true, nil
+}
+
+func (idx *diskIndex) each(fn func(key string, row *rowData) bool) error {
+	for _, e := range idx.order {
+		row, err := idx.read(e)
+		if err != nil {
+			return err
+		}
+		if !fn(e.key, row) {
+			break
+		}
+	}
+	return nil
+}
+
+func (idx *diskIndex) len() int {
+	return len(idx.order)
+}
+
+func (idx *diskIndex) close() {
+	idx.file.Close()
+	os.Remove(idx.file.Name())
+}
+
+// readIndexB 读取B表并建立索引：DiskIndexB 时写入磁盘索引，否则读入内存；按 FilterB 过滤并计算派生字段
+func (m *Merger) readIndexB(src queryer, tableName string, fieldNames []string) (rowIndex, error) {
+	if m.config.DiskIndexB {
+		idx, err := m.readDiskIndex("B", src, tableName, fieldNames)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	dataB, err := m.readTable(src, tableName, fieldNames)
+	if err != nil {
+		return nil, err
+	}
+	dataB = m.filterRows("B", dataB)
+	if err = m.checkEmptyKeys("B", dataB); err != nil {
+		return nil, err
+	}
+	m.applyDerivedFields("B", dataB)
+	return m.newMemIndex(dataB), nil
+}
+
+// Index 可在多次 Run 之间复用的B表索引，由 BuildIndex 建立，通过 MergeConfig.IndexB 传入；
+// 索引内容按建立时的配置（关键字段、KeyFunc、FilterB、派生字段等）生成，可被多个 Run 并发读取
+type Index struct {
+	Table   string    // 建立索引的表名
+	BuiltAt time.Time // 建立时间
+
+	keyFields []string
+	idx       rowIndex
+	invalid   atomic.Bool
+}
+
+// Len 返回索引中的记录数
+func (ix *Index) Len() int {
+	return ix.idx.len()
+}
+
+// Invalidate 将索引标记为失效（例如B表已被修改），之后的 Run 重新读取B表；进行中的 Run 不受影响
+func (ix *Index) Invalidate() {
+	ix.invalid.Store(true)
+}
+
+// Valid 判断索引是否仍有效
+func (ix *Index) Valid() bool {
+	return !ix.invalid.Load()
+}
+
+// Close 使索引失效并释放资源（DiskIndexB 时删除临时文件），调用前须确保没有 Run 正在使用该索引
+func (ix *Index) Close() {
+	ix.Invalidate()
+	ix.idx.close()
+}
+
+// BuildIndex 连接数据库读取指定表并建立可复用的B表索引：以 table 作为B表，按与 Run 相同的步骤准备
+// （AllowedTables 检查、读取A、B表结构、识别二进制等字段类型），再使用 Run 读取B表的配置读取
+// （DiskIndexB、KeyRange、KeyFilter、FilterB、派生字段等）
+func (m *Merger) BuildIndex(table string) (*Index, error) {
+	tableB := m.config.TableB
+	m.config.TableB = table
+	defer func() { m.config.TableB = tableB }()
+	if err := m.checkAllowedTables(); err != nil {
+		return nil, err
+	}
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	defer m.closeDB()
+	if err := m.loadColumns(); err != nil {
+		return nil, err
+	}
+	if err := m.initFields(); err != nil {
+		return nil, err
+	}
+	m.infof("[信息] 正在为表(%s)建立索引...\n", table)
+	idx, err := m.readIndexB(m.dbB, table, m.readFields(m.fieldNamesB))
+	if err != nil {
+		return nil, err
+	}
+	m.infof("[信息] 表(%s)索引已建立，共 %d 条记录\n", table, idx.len())
+	return &Index{Table: table, BuiltAt: time.Now(), keyFields: append([]string{}, m.config.KeyFields...), idx: idx}, nil
+}
+
+// cachedIndexB 返回可复用的 IndexB 索引；未配置或不可用时返回 nil
+func (m *Merger) cachedIndexB() rowIndex {
+	ix := m.config.IndexB
+	if ix == nil {
+		return nil
+	}
+	var reason string
+	switch {
+	case !ix.Valid():
+		reason = "已失效"
+	case ix.Table != m.config.TableB:
+		reason = fmt.Sprintf("建立于表%s，与B表不同", ix.Table)
+	case strings.Join(ix.keyFields, ",") != strings.Join(m.config.KeyFields, ","):
+		reason = "关键字段与当前配置不同"
+	case m.config.IndexMaxAge > 0 && time.Since(ix.BuiltAt) > m.config.IndexMaxAge:
+		reason = fmt.Sprintf("已超过最长使用时间 %v", m.config.IndexMaxAge)
+	}
+	if reason != "" {
+		m.infof("[信息] 缓存的B表索引%s，重新读取B表\n", reason)
+		return nil
+	}
+	m.infof("[信息] 复用 %s 建立的B表索引\n", ix.BuiltAt.Format("2006-01-02 15:04:05"))
+	return ix.idx
+}
+
+// unionIndex 在已有索引之外追加一部分记录（增量对比时按key补读的B表记录），
+// close 只释放追加的部分，已有索引由其创建者负责释放
+type unionIndex struct {
+	base  rowIndex
+	extra *memIndex
+}
+
+func (idx *unionIndex) get(key string) (*rowData, bool, error) {
+	row, ok, err := idx.base.get(key)
+	if ok || err != nil {
+		return row, ok, err
+	}
+	return idx.extra.get(key)
+}
+
+func (idx *unionIndex) each(fn func(key string, row *rowData) bool) error {
+	stopped := false
+	err := idx.base.each(func(key string, row *rowData) bool {
+		if !fn(key, row) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if err != nil || stopped {
+		return err
+	}
+	return idx.extra.each(fn)
+}
+
+func (idx *unionIndex) len() int {
+	return idx.base.len() + idx.extra.len()
+}
+
+func (idx *unionIndex) close() {
+	idx.extra.close()
+}
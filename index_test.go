@@ -0,0 +1,86 @@
+package reconciler
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestBuildIndexUsesRunSetup(t *testing.T) {
+	db := newFakeSources(t, "k int", "data blob")
+	db.create("b2", "k int", "data blob")
+	db.insert("b2", vals{"k": "1", "data": "\xff\x00"}, vals{"k": "2", "data": "\xfe\x01"}, vals{"k": "3", "data": nil})
+	config := fakeConfig(db, "k")
+	config.KeyRange = &KeyRange{Field: "k", Min: "2"}
+	m := NewMerger(config)
+	ix, err := m.BuildIndex("b2")
+	if err != nil {
+		t.Fatalf("BuildIndex: %v", err)
+	}
+	defer ix.Close()
+	if ix.Table != "b2" || m.config.TableB != "b" {
+		t.Errorf("Index.Table = %q, config.TableB = %q", ix.Table, m.config.TableB)
+	}
+	if !m.binarySet["data"] {
+		t.Error("BLOB 列未识别为二进制字段")
+	}
+	// KeyRange 同样作用于建立索引的表
+	if n := ix.idx.len(); n != 2 {
+		t.Errorf("索引 %d 条记录, want 2", n)
+	}
+	if r, ok, _ := ix.idx.get("2"); !ok {
+		t.Error("索引中没有 k=2")
+	} else if got := value(r.Values, "data"); got != "\xfe\x01" {
+		t.Errorf("k=2 的 data = %q", got)
+	}
+
+	config.AllowedTables = []string{"a", "b", "c"}
+	if _, err := NewMerger(config).BuildIndex("b2"); err == nil {
+		t.Error("表不在 AllowedTables 中时 BuildIndex 应返回错误")
+	}
+}
+
+func TestDiskIndexMatchesMemory(t *testing.T) {
+	run := func(disk bool) ([]map[string]*string, *MergeStats) {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "note text")
+		db.insert("a", vals{"k": "1", "name": "Tom", "note": "x"}, vals{"k": "2", "name": "Anna", "note": nil},
+			vals{"k": "3", "name": "Lily", "note": "line1\nline2"}, vals{"k": "4", "name": "Jack", "note": "y"})
+		db.insert("b", vals{"k": "1", "name": "Tom", "note": "x"}, vals{"k": "2", "name": "Anne", "note": "b"},
+			vals{"k": "3", "name": "Lily", "note": "line1\nline2"}, vals{"k": "5", "name": "Rose", "note": "中文"})
+		config := fakeConfig(db, "k")
+		config.Strategy = UseB
+		config.DiskIndexB = disk
+		config.TempDir = t.TempDir()
+		stats, _ := runFake(t, config)
+		if files, _ := os.ReadDir(config.TempDir); len(files) != 0 {
+			t.Errorf("DiskIndexB=%v: 临时文件未删除: %v", disk, files)
+		}
+		return db.table("c").rows, stats
+	}
+	memRows, memStats := run(false)
+	diskRows, diskStats := run(true)
+	if !reflect.DeepEqual(diskRows, memRows) {
+		t.Errorf("磁盘索引的结果与内存索引不同:\n%v\n%v", diskRows, memRows)
+	}
+	if diskStats.ExactMatch != memStats.ExactMatch || diskStats.Conflict != memStats.Conflict ||
+		diskStats.OnlyInA != memStats.OnlyInA || diskStats.OnlyInB != memStats.OnlyInB || diskStats.TotalC != 5 {
+		t.Errorf("统计不同: 磁盘 %+v, 内存 %+v", *diskStats, *memStats)
+	}
+}
+
+func TestDiskIndexKeepsExcludedRows(t *testing.T) {
+	for _, disk := range []bool{false, true} {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+		db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "", "name": "Ghost"})
+		db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "", "name": "Ghost"}, vals{"k": "", "name": "Ghost"})
+		config := fakeConfig(db, "k")
+		config.EmptyKeyPolicy = EmptyKeyExclude
+		config.DiskIndexB = disk
+		config.TempDir = t.TempDir()
+		stats, _ := runFake(t, config)
+		// key相同的排除记录也各自计为仅在B表中，不被去重
+		if stats.ExactMatch != 1 || stats.OnlyInA != 1 || stats.OnlyInB != 2 || stats.TotalC != 4 {
+			t.Errorf("DiskIndexB=%v: %+v", disk, *stats)
+		}
+	}
+}
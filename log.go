@@ -0,0 +1,57 @@
+package reconciler
+
+import "fmt"
+
+// LogLevel 运行过程中向标准输出打印信息的详细程度
+type LogLevel int
+
+const (
+	// LogInfo 打印进度、配置、警告、冲突详情和统计报告（默认）
+	LogInfo LogLevel = iota
+	// LogSilent 不打印任何信息，错误只通过返回值报告；AskUser 的交互提示仍会打印，
+	// 通过 logx 记录的错误日志由 logx 自身的配置决定
+	LogSilent
+	// LogError 只在失败时打印错误
+	LogError
+	// LogDebug 在 LogInfo 的基础上打印调试信息（如读取数据的SQL）
+	LogDebug
+)
+
+// rank 返回日志级别的详细程度，数值越大打印越多
+func (l LogLevel) rank() int {
+	switch l {
+	case LogSilent:
+		return 0
+	case LogError:
+		return 1
+	case LogDebug:
+		return 3
+	}
+	return 2
+}
+
+// logEnabled 判断当前配置下是否打印该级别的信息
+func (m *Merger) logEnabled(level LogLevel) bool {
+	return level.rank() <= m.config.LogLevel.rank()
+}
+
+// errorf 按 LogError 级别打印错误
+func (m *Merger) errorf(format string, args ...interface{}) {
+	if m.logEnabled(LogError) {
+		fmt.Printf(format, args...)
+	}
+}
+
+// infof 按 LogInfo 级别打印信息
+func (m *Merger) infof(format string, args ...interface{}) {
+	if m.logEnabled(LogInfo) {
+		fmt.Printf(format, args...)
+	}
+}
+
+// debugf 按 LogDebug 级别打印调试信息
+func (m *Merger) debugf(format string, args ...interface{}) {
+	if m.logEnabled(LogDebug) {
+		fmt.Printf(format, args...)
+	}
+}
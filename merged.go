@@ -0,0 +1,207 @@
+package reconciler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MergedRow 对外的合并结果行，字段顺序与C表列顺序一致，便于序列化为 protobuf/Avro 等格式
+type MergedRow struct {
+	Fields     []MergedField // C表字段、元数据字段及影子列，按C表列顺序
+	Source     string        // 数据来源：A、B、MERGE_A、MERGE_B、SKIP 等（即 _source）
+	Conflict   bool          // 是否存在冲突（即 _conflict）
+	DiffFields []string      // 不同的字段（即 _diff_fields）
+}
+
+// MergedField 结果行中的一个字段
+type MergedField struct {
+	Name  string
+	Value Value
+}
+
+// Value 字段值，可按需转换为具体类型；零值表示 NULL
+type Value struct {
+	raw *string
+}
+
+// IsNull 判断是否为 NULL
+func (v Value) IsNull() bool {
+	return v.raw == nil
+}
+
+// String 返回字符串值，NULL 返回空字符串
+func (v Value) String() string {
+	if v.raw == nil {
+		return ""
+	}
+	return *v.raw
+}
+
+// Ptr 返回值的副本指针，nil 表示 NULL
+func (v Value) Ptr() *string {
+	return copyStringPtr(v.raw)
+}
+
+// Int64 按十进制整数解析
+func (v Value) Int64() (int64, error) {
+	if v.raw == nil {
+		return 0, fmt.Errorf("值为NULL")
+	}
+	return strconv.ParseInt(strings.TrimSpace(*v.raw), 10, 64)
+}
+
+// Float64 按浮点数解析
+func (v Value) Float64() (float64, error) {
+	if v.raw == nil {
+		return 0, fmt.Errorf("值为NULL")
+	}
+	return strconv.ParseFloat(strings.TrimSpace(*v.raw), 64)
+}
+
+// Bool 按默认的真值/假值集合（不区分大小写）解析，如 1/true/yes 与 0/false/no
+func (v Value) Bool() (bool, error) {
+	if v.raw == nil {
+		return false, fmt.Errorf("值为NULL")
+	}
+	if b, ok := (&Merger{}).parseBool(*v.raw); ok {
+		return b, nil
+	}
+	return false, fmt.Errorf("无法解析为布尔值: %q", *v.raw)
+}
+
+// Time 按 layout 解析时间，layout 为空时使用 "2006-01-02 15:04:05"，解析失败再尝试 RFC3339
+func (v Value) Time(layout string) (time.Time, error) {
+	if layout == "" {
+		layout = "2006-01-02 15:04:05"
+	}
+	if t, ok := parseTimestamp(v.raw, layout); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("无法解析为时间: %s", displayValue(v.raw))
+}
+
+// Value 按字段名返回值，ok 为 false 表示没有该字段
+func (r MergedRow) Value(name string) (Value, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return Value{}, false
+}
+
+// mergedRows 将内部结果行转换为 MergedRow，字段顺序为 outputFields（即C表列顺序）
+func (m *Merger) mergedRows(rows []rowData) []MergedRow {
+	fields := m.outputFields()
+	out := make([]MergedRow, len(rows))
+	for i, row := range rows {
+		r := MergedRow{Fields: make([]MergedField, len(fields))}
+		for j, f := range fields {
+			r.Fields[j] = MergedField{Name: f, Value: Value{raw: copyStringPtr(row.Values[f])}}
+		}
+		if v := row.Values["_source"]; v != nil {
+			r.Source = *v
+		}
+		if v := row.Values["_conflict"]; v != nil {
+			r.Conflict = *v == "1"
+		}
+		if v := row.Values["_diff_fields"]; v != nil && *v != "" {
+			if err := json.Unmarshal([]byte(*v), &r.DiffFields); err != nil {
+				r.DiffFields = strings.Split(*v, ",")
+			}
+		}
+		out[i] = r
+	}
+	return out
+}
+
+// Compute 读取A、B表并对比合并，返回合并结果（含 PreInsert 的修改）而不创建、不写入C表；
+// 统计信息可通过 Stats() 获取，ChangeEvents 模式下返回空结果
+func (m *Merger) Compute() ([]MergedRow, error) {
+	if err := m.checkAllowedTables(); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) {
+		now := time.Now()
+		*s = MergeStats{StartTime: now, RunID: now.Format("20060102150405.000000")}
+	})
+	m.stopped.Store(false)
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	defer m.closeDB()
+	rows, err := m.readAndMerge()
+	if err != nil {
+		return nil, err
+	}
+	if err = m.applyPreInsert(rows); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalC = len(rows); s.EndTime = time.Now() })
+	return m.mergedRows(rows), nil
+}
+
+// MergeRows 不连接数据库，按 config 在内存中对比合并A、B两组记录（columnsA/columnsB 为对应的列信息），
+// 返回写入C的结果行（含 PreInsert 的修改）和统计信息；Ask 策略时仍会询问用户
+func MergeRows(config MergeConfig, columnsA, columnsB []ColumnInfo, dataA, dataB []Row) ([]Row, *MergeStats, error) {
+	m := NewMerger(config)
+	m.setStats(func(s *MergeStats) { s.StartTime = time.Now() })
+	rows, err := m.MergeRows(columnsA, columnsB, dataA, dataB)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+	stats := m.Stats()
+	return rows, &stats, nil
+}
+
+// MergeRows 使用给定的列信息在内存中对比合并A、B两组记录，见 MergeRows；
+// 按 FilterA/FilterB 过滤并检查空key，统计信息累加到合并器上，可通过 Stats() 获取
+func (m *Merger) MergeRows(columnsA, columnsB []ColumnInfo, dataA, dataB []Row) ([]Row, error) {
+	m.columnsA, m.columnsB = columnsA, columnsB
+	rowsA, rowsB := m.filterRows("A", toRowData(dataA)), m.filterRows("B", toRowData(dataB))
+	if err := m.checkEmptyKeys("A", rowsA); err != nil {
+		return nil, err
+	}
+	if err := m.checkEmptyKeys("B", rowsB); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalA, s.TotalB = len(rowsA), len(rowsB) })
+	m.metricObserve(MetricRowsReadA, float64(len(rowsA)))
+	m.metricObserve(MetricRowsReadB, float64(len(rowsB)))
+	m.infof("[信息] A共 %d 条记录, B共 %d 条记录\n", len(rowsA), len(rowsB))
+
+	if err := m.initFields(); err != nil {
+		return nil, err
+	}
+	rows, err := m.mergeRows(rowsA, rowsB)
+	if err != nil {
+		return nil, err
+	}
+	if err = m.applyPreInsert(rows); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalC = len(rows) })
+	out := make([]Row, len(rows))
+	for i := range rows {
+		out[i] = Row(rows[i].Values)
+	}
+	return out, nil
+}
+
+// OutputFields 返回结果行的字段：C表字段、元数据字段及影子列，按写入顺序；在 MergeRows 或 Run 之后有效
+func (m *Merger) OutputFields() []string {
+	return m.outputFields()
+}
+
+// toRowData 将对外的行转换为内部记录（共用各行的map）
+func toRowData(rows []Row) []rowData {
+	out := make([]rowData, len(rows))
+	for i, r := range rows {
+		out[i] = rowData{Values: r}
+	}
+	return out
+}
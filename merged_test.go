@@ -0,0 +1,89 @@
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergedRowFieldOrderMatchesC(t *testing.T) {
+	newDB := func() *fakeDB {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "age int", "email varchar(50)")
+		db.insert("a", vals{"k": "1", "name": "Tom", "age": "20", "email": "a@x.com"}, vals{"k": "2", "name": "Anna", "age": nil, "email": nil})
+		db.insert("b", vals{"k": "1", "name": "Tom", "age": "20", "email": "b@x.com"})
+		return db
+	}
+	config := fakeConfig(newDB(), "k")
+	config.KeepBValuesColumnSuffix = "_b"
+	rows, err := NewMerger(config).Compute()
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+
+	// 同样的数据运行 Run，C表列顺序（去掉代理主键）应与 MergedRow 的字段顺序一致
+	db := newDB()
+	config.DSN = db.dsn
+	runFake(t, config)
+	var colsC []string
+	for _, col := range db.table("c").cols {
+		if col.name != "id" {
+			colsC = append(colsC, col.name)
+		}
+	}
+	if len(rows) != 2 {
+		t.Fatalf("Compute 返回 %d 行, want 2", len(rows))
+	}
+	for _, r := range rows {
+		var names []string
+		for _, f := range r.Fields {
+			names = append(names, f.Name)
+		}
+		if !reflect.DeepEqual(names, colsC) {
+			t.Errorf("MergedRow 字段顺序 = %v, want %v", names, colsC)
+		}
+	}
+
+	r := rows[0]
+	if r.Source != "MERGE_A" || !r.Conflict || !reflect.DeepEqual(r.DiffFields, []string{"email"}) {
+		t.Errorf("元数据 = %q %v %v", r.Source, r.Conflict, r.DiffFields)
+	}
+	if v, ok := r.Value("email_b"); !ok || v.String() != "b@x.com" {
+		t.Errorf("email_b = %v, %v", v.String(), ok)
+	}
+	age, _ := r.Value("age")
+	if n, err := age.Int64(); err != nil || n != 20 {
+		t.Errorf("age.Int64() = %d, %v, want 20", n, err)
+	}
+	if v, _ := rows[1].Value("age"); !v.IsNull() {
+		t.Error("k=2 age 应为 NULL")
+	}
+}
+
+func TestMergeRowsWithoutDatabase(t *testing.T) {
+	cols := textCols("k", "name", "note")
+	dataA := []Row{{"k": strPtr("1"), "name": strPtr("Tom"), "note": strPtr("a")},
+		{"k": strPtr("2"), "name": strPtr("Anna"), "note": strPtr("a")}}
+	dataB := []Row{{"k": strPtr("1"), "name": strPtr("Tomas"), "note": strPtr("b")},
+		{"k": strPtr("3"), "name": strPtr("Lily"), "note": strPtr("b")}}
+	config := MergeConfig{KeyFields: []string{"k"}, IgnoreFieldsA: []string{"note"}, Strategy: UseB, LogLevel: LogSilent}
+	rows, stats, err := MergeRows(config, cols, cols, dataA, dataB)
+	if err != nil {
+		t.Fatalf("MergeRows: %v", err)
+	}
+	if stats.TotalA != 2 || stats.TotalB != 2 || stats.Conflict != 1 || stats.OnlyInA != 1 || stats.OnlyInB != 1 || stats.TotalC != 3 {
+		t.Errorf("统计 = %+v", *stats)
+	}
+	// note 被忽略，冲突的 name 按 UseB 取B的值
+	byKey := make(map[string]Row)
+	for _, r := range rows {
+		byKey[value(r, "k")] = r
+	}
+	if got := value(byKey["1"], "name"); got != "Tomas" {
+		t.Errorf("k=1 name = %q, want Tomas", got)
+	}
+	if got := value(byKey["1"], "_diff_fields"); got != "name" {
+		t.Errorf("k=1 _diff_fields = %q, want name", got)
+	}
+	if len(byKey) != 3 {
+		t.Errorf("结果 %d 个key, want 3", len(byKey))
+	}
+}
@@ -0,0 +1,33 @@
+package reconciler
+
+// MetricsRecorder 运行指标记录器，可对接 Prometheus 等监控系统；对比和写入可能并行，实现须并发安全
+type MetricsRecorder interface {
+	// Inc 计数器加一
+	Inc(name string)
+	// Observe 记录一个数值，如读取的记录数、运行耗时
+	Observe(name string, value float64)
+}
+
+// 指标名称
+const (
+	MetricRowsReadA       = "reconciler_rows_read_a"      // A表（文件）读取的记录数（Observe）
+	MetricRowsReadB       = "reconciler_rows_read_b"      // B表（文件）读取的记录数（Observe）
+	MetricBatchesWritten  = "reconciler_batches_written"  // 成功写入C表的批次（Inc）
+	MetricConflicts       = "reconciler_conflicts"        // 冲突记录（Inc）
+	MetricAutoFilled      = "reconciler_auto_filled"      // 自动用非空值填充的字段（Inc）
+	MetricDurationSeconds = "reconciler_duration_seconds" // 运行耗时，单位秒（Observe）
+)
+
+// metricInc 调用 MetricsRecorder.Inc，未配置时不做任何事
+func (m *Merger) metricInc(name string) {
+	if m.config.MetricsRecorder != nil {
+		m.config.MetricsRecorder.Inc(name)
+	}
+}
+
+// metricObserve 调用 MetricsRecorder.Observe，未配置时不做任何事
+func (m *Merger) metricObserve(name string, value float64) {
+	if m.config.MetricsRecorder != nil {
+		m.config.MetricsRecorder.Observe(name, value)
+	}
+}
@@ -2,13 +2,26 @@ package reconciler
 
 import (
 	"bufio"
+	"context"
+	"crypto/md5"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/zituocn/logx"
 )
 
@@ -22,12 +35,272 @@ const (
 	UseB
 	// AskUser 交互式询问用户
 	AskUser
+	// PreferNewer 以 VersionField 值较新（较大）的一方为准，版本相同或无法比较时弃权
+	PreferNewer
+	// PreferNonNull 以冲突字段中非空值较多的一方为准，数量相同时弃权
+	PreferNonNull
+	// UseNewest 按 TimestampLayout 解析 TimestampField，以时间较晚的一方为准，相同或无法解析时弃权（单独使用时即以A为准）
+	UseNewest
+	// UseResolver 调用 ConflictResolver 决定（例如请求外部服务），返回 UseA/UseB 以外的值时弃权
+	UseResolver
+)
+
+// ResolverErrorPolicy ConflictResolver 返回错误时的处理方式
+type ResolverErrorPolicy int
+
+const (
+	// ResolverErrorAbort 中止合并且不写入C表（默认）
+	ResolverErrorAbort ResolverErrorPolicy = iota
+	// ResolverErrorSkip 记录错误并弃权，由策略链中的下一个策略决定（全部弃权时以A为准）
+	ResolverErrorSkip
+)
+
+// deferChoice 内部使用：AskUser 在 Deferred 模式下延后决定
+const deferChoice ConflictStrategy = -1
+
+// DecisionMode AskUser 模式下询问用户的时机
+type DecisionMode int
+
+const (
+	// Inline 在对比过程中遇到冲突时立即询问（默认）
+	Inline DecisionMode = iota
+	// Deferred 先完成全部对比并收集冲突，再统一询问，最后应用决定
+	Deferred
+)
+
+// strategyNames 策略的中文说明
+var strategyNames = map[ConflictStrategy]string{
+	UseA:          "以A表为准",
+	UseB:          "以B表为准",
+	AskUser:       "交互式询问用户",
+	PreferNewer:   "以版本较新的一方为准",
+	PreferNonNull: "以非空值较多的一方为准",
+	UseNewest:     "以时间戳较新的一方为准",
+	UseResolver:   "由 ConflictResolver 决定",
+}
+
+// String 返回策略的字符串表示，可由 ParseConflictStrategy 解析回来
+func (s ConflictStrategy) String() string {
+	switch s {
+	case UseA:
+		return "use_a"
+	case UseB:
+		return "use_b"
+	case AskUser:
+		return "ask"
+	case PreferNewer:
+		return "prefer_newer"
+	case PreferNonNull:
+		return "prefer_non_null"
+	case UseNewest:
+		return "use_newest"
+	case UseResolver:
+		return "resolver"
+	default:
+		return fmt.Sprintf("ConflictStrategy(%d)", int(s))
+	}
+}
+
+// ParseConflictStrategy 将字符串（use_a/use_b/ask/prefer_newer/prefer_non_null/use_newest/resolver，不区分大小写）解析为冲突处理策略
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "use_a":
+		return UseA, nil
+	case "use_b":
+		return UseB, nil
+	case "ask":
+		return AskUser, nil
+	case "prefer_newer":
+		return PreferNewer, nil
+	case "prefer_non_null":
+		return PreferNonNull, nil
+	case "use_newest":
+		return UseNewest, nil
+	case "resolver":
+		return UseResolver, nil
+	default:
+		return UseA, fmt.Errorf("未知的冲突处理策略: %q", s)
+	}
+}
+
+// AutoFillPolicy 一方为空/NULL、另一方有值时的处理策略
+type AutoFillPolicy int
+
+const (
+	// FillFromNonEmpty 自动使用非空的一方（默认）
+	FillFromNonEmpty AutoFillPolicy = iota
+	// Never 不自动处理，作为普通冲突按 Strategy 决定
+	Never
+	// PreferA 自动使用A的值（即使A为空）
+	PreferA
+	// PreferB 自动使用B的值（即使B为空）
+	PreferB
+)
+
+// BothEmptyPrefer 对比字段在A、B中都为"空"（NULL、空字符串或占位值）但不完全相同时（如 NULL 与 ""）C表的取值
+type BothEmptyPrefer int
+
+const (
+	// BothEmptyByStrategy 作为普通冲突按 Strategy 决定（默认）
+	BothEmptyByStrategy BothEmptyPrefer = iota
+	// BothEmptyNull 写入 NULL
+	BothEmptyNull
+	// BothEmptyEmpty 写入空字符串
+	BothEmptyEmpty
+	// BothEmptyPreferA 使用A的值
+	BothEmptyPreferA
+	// BothEmptyPreferB 使用B的值
+	BothEmptyPreferB
+)
+
+// ConflictSemantics C表 _conflict 字段的含义
+type ConflictSemantics int
+
+const (
+	// AnyDiff 存在任何差异即标记为冲突，包括全部自动解决的差异（默认）
+	AnyDiff ConflictSemantics = iota
+	// ManualOnly 仅在有字段需要按策略决定时标记为冲突，全部自动解决时 _conflict=0，_diff_fields 照常记录
+	ManualOnly
+)
+
+// EmptyKeyPolicy 关键字段值为空字符串时的处理方式
+type EmptyKeyPolicy int
+
+const (
+	// EmptyKeyAllow 空字符串作为普通的key值参与匹配（默认）
+	EmptyKeyAllow EmptyKeyPolicy = iota
+	// EmptyKeyExclude 不参与匹配，该记录总是计为仅在A表或仅在B表中
+	EmptyKeyExclude
+	// EmptyKeyError 中止合并
+	EmptyKeyError
+)
+
+// InsertMode 写入C表使用的语句
+type InsertMode int
+
+const (
+	// PlainInsert 使用 INSERT INTO（默认）
+	PlainInsert InsertMode = iota
+	// ReplaceInto 使用 REPLACE INTO：唯一键（主键或唯一索引）相同的已有行被替换，重跑时后写入者生效
+	ReplaceInto
+)
+
+// ColumnOrder C表字段的排列顺序（元数据字段始终在最后）
+type ColumnOrder int
+
+const (
+	// SourceA 与A表字段顺序一致（默认）
+	SourceA ColumnOrder = iota
+	// KeysFirst 关键字段在前，其次是对比字段，再次是仅写入不对比的字段
+	KeysFirst
+	// CustomOrder 按 CustomColumnOrder 指定的顺序，未列出的字段按A表顺序排在其后
+	CustomOrder
+)
+
+// MatchMode 写入C表的记录范围
+type MatchMode int
+
+const (
+	// FullOuter 写入匹配记录、仅在A表和仅在B表的记录（默认）
+	FullOuter MatchMode = iota
+	// Inner 仅写入A、B表中关键字段匹配的记录
+	Inner
+	// LeftOnly 仅写入只在A表中的记录（匹配记录不做对比）
+	LeftOnly
+	// RightOnly 仅写入只在B表中的记录（匹配记录不做对比）
+	RightOnly
+)
+
+// ConnConfig 结构化的数据库连接参数
+type ConnConfig struct {
+	Host      string            // 主机地址（必填）
+	Port      int               // 端口，默认 3306
+	User      string            // 用户名（必填）
+	Password  string            // 密码
+	Database  string            // 数据库名（必填）
+	Charset   string            // 连接字符集，默认 utf8mb4
+	ParseTime bool              // 是否将时间类型解析为 time.Time
+	Params    map[string]string // 其他连接参数，例如 {"loc": "Local"}
+}
+
+// FormatDSN 将连接参数组装为 go-sql-driver/mysql 格式的DSN
+func (c ConnConfig) FormatDSN() (string, error) {
+	if c.Host == "" {
+		return "", fmt.Errorf("连接参数缺少Host")
+	}
+	if c.User == "" {
+		return "", fmt.Errorf("连接参数缺少User")
+	}
+	if c.Database == "" {
+		return "", fmt.Errorf("连接参数缺少Database")
+	}
+	port := c.Port
+	if port == 0 {
+		port = 3306
+	}
+	if port < 0 || port > 65535 {
+		return "", fmt.Errorf("连接参数Port无效: %d", c.Port)
+	}
+	charset := c.Charset
+	if charset == "" {
+		charset = "utf8mb4"
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = c.User
+	cfg.Passwd = c.Password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(c.Host, strconv.Itoa(port))
+	cfg.DBName = c.Database
+	cfg.ParseTime = c.ParseTime
+	if len(c.Params) > 0 {
+		cfg.Params = make(map[string]string, len(c.Params))
+		for k, v := range c.Params {
+			cfg.Params[k] = v
+		}
+	}
+	if err := cfg.Apply(mysql.Charset(charset, "")); err != nil {
+		return "", fmt.Errorf("设置连接字符集失败: %v", err)
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// BOnlyFillPolicy 仅在B表中的记录写入C表时，B表中不存在（或被忽略）的列的填充方式
+type BOnlyFillPolicy int
+
+const (
+	// BOnlyFillNull 填充NULL（默认）
+	BOnlyFillNull BOnlyFillPolicy = iota
+	// BOnlyFillDefault 填充该列在A表中的默认值，无默认值时为NULL
+	BOnlyFillDefault
+	// BOnlyFillCustom 填充 BOnlyFillValues 中配置的值，未配置的列为NULL
+	BOnlyFillCustom
+)
+
+// DiffFieldsFormat _diff_fields 列的存储格式
+type DiffFieldsFormat int
+
+const (
+	// DiffFieldsCSV 逗号分隔的字段列表（默认），如 name,email
+	DiffFieldsCSV DiffFieldsFormat = iota
+	// DiffFieldsJSON JSON数组，如 ["name","email"]
+	DiffFieldsJSON
 )
 
 // MergeConfig 合并配置
 type MergeConfig struct {
 	// 数据库连接字符串，例如 "user:password@tcp(127.0.0.1:3306)/dbname?charset=utf8mb4&parseTime=true"
 	DSN string
+	// 结构化的连接参数，DSN 为空时用于组装DSN
+	Conn *ConnConfig
+	// A、B、C表各自的数据库连接字符串，用于表位于不同的MySQL服务器时；为空时使用 DSN/Conn
+	DSNA string
+	DSNB string
+	DSNC string
+	// 读写分离：A、B表从 ReadDSN（如只读副本）读取，C表的结构查询和写入使用 WriteDSN（主库）；
+	// DSNA/DSNB/DSNC 优先，均为空时使用 DSN/Conn
+	ReadDSN  string
+	WriteDSN string
 
 	// A表名称（主表）
 	TableA string
@@ -35,36 +308,343 @@ type MergeConfig struct {
 	TableB string
 	// C表名称（输出结果表）
 	TableC string
+	// C表所在的数据库（schema），为空时使用连接的默认数据库；A、B表始终从默认数据库读取
+	TableCSchema string
+
+	// 允许操作的表名前缀，A、B、C表及墓碑表、统计表、拒绝表、变更日志表的表名都必须以此开头，为空时不限制
+	AllowedTablePrefix string
+	// 允许操作的表名集合，A、B、C表及墓碑表、统计表、拒绝表、变更日志表的表名都必须在其中，为空时不限制
+	AllowedTables []string
+
+	// 只读取A、B表中指定字段在范围内的记录（参数化的 WHERE field >= ? AND field <= ?），为 nil 时读取全部
+	KeyRange *KeyRange
+
+	// 只读取A、B表中指定key的记录，每个元素为一组 字段名->值（通常为全部关键字段），多组之间为或的关系；
+	// 用于针对个别记录复现合并过程
+	KeyFilter []map[string]string
 
 	// 多个关键字段名称，用于判断是否为同一条数据
 	KeyFields []string
+	// 自定义匹配key的计算函数，设置后完全替代按 KeyFields 拼接key（NULL处理和分隔符由函数自行负责）；
+	// KeyFields 中的字段仍不参与对比
+	KeyFunc func(row Row) string
+	// 关键字段值为空字符串时的处理方式，默认作为普通值参与匹配；设置 KeyFunc 时不生效
+	EmptyKeyPolicy EmptyKeyPolicy
+
+	// 派生字段：对比前用一侧的多个列计算出字段值（覆盖该侧同名字段），按顺序计算
+	DerivedFields []DerivedField
+
+	// 关键字段按数值规范化后再拼接key，用于A、B关键字段类型不同（如 INT 与 VARCHAR）时避免 "05"、" 5" 与 "5" 匹配不上
+	NumericKeys bool
+	// 自定义关键字段值的规范化函数（v 为 nil 表示 NULL），设置后代替 NumericKeys 和默认的原值拼接
+	KeyNormalize func(field string, v *string) string
+
+	// 决定一对匹配的A、B记录是否参与对比，返回 false 时原样写入A表记录（_source 为 SKIP），不计入冲突；为 nil 时全部对比。
+	// Workers 大于1时会在多个协程中并发调用，须并发安全
+	ShouldCompare func(key string, rowA, rowB Row) bool
+
+	// 读取后按行过滤A、B表记录，返回 false 的记录不参与合并（计入 FilteredA/FilteredB）；用于难以写成SQL的条件，为 nil 时不过滤
+	FilterA func(row Row) bool
+	FilterB func(row Row) bool
 
 	// A表中忽略对比的字段（其值仍然写入C表）
 	IgnoreFieldsA []string
 	// B表中忽略的字段（其值不参与对比，也不写入C表）
 	IgnoreFieldsB []string
+	// 参与对比（也可作为关键字段）但不写入C表的字段，例如只用于匹配的敏感列
+	CompareButNotOutputFields []string
+
+	// 变更事件模式：A表视为旧快照、B表视为新快照，Run 只生成 insert/update/delete 变更事件（通过 Changes() 获取），
+	// 不合并、不询问用户、不改动C表；墓碑表不生效
+	ChangeEvents bool
+	// 变更日志模式：将本次合并结果与已存在的C表按key对比，把新增、更新（含变化字段的新旧值）和删除的key
+	// 追加写入 ChangelogTable（通过 Changes() 也可获取），不改动C表；C表不存在时所有记录都视为新增
+	ChangelogMode bool
+	// 变更日志表名（与C表同库，不存在时自动创建），默认为C表名加 _changelog 后缀
+	ChangelogTable string
+
+	// 由 BuildIndex 预先建立的B表索引，表名和关键字段与当前配置一致、未失效且未超过 IndexMaxAge 时
+	// Run 直接复用而不再读取B表，适用于同一B表与多个A表反复合并；不可用时照常读取
+	IndexB *Index
+	// IndexB 的最长使用时间，超过后视为失效；0 表示不限制
+	IndexMaxAge time.Duration
+
+	// 增量对比：只读取A、B表中 ModifiedColumn >= ModifiedSince 的记录（两者都设置时生效）；
+	// 窗口内只在一侧出现的key会再按key读取另一侧的记录（不受时间窗口限制），避免未修改的一侧被误判为缺失
+	ModifiedSince  time.Time
+	ModifiedColumn string
+
+	// 运行指标记录器：读取记录数、写入批次、冲突、自动填充及运行耗时；为 nil 时不记录
+	MetricsRecorder MetricsRecorder
 
 	// 冲突处理策略：当关键字段相同但其他字段不同时
 	Strategy ConflictStrategy
+	// AskUser 的询问时机，默认在对比过程中逐条询问
+	DecisionMode DecisionMode
+	// AskUser 决定日志文件：用户每作出一个决定即按行追加写入（JSON，含key和选择），为空时不记录
+	DecisionLog string
+	// 从 DecisionLog 续做：已记录决定的key直接应用该决定，只询问其余冲突；未开启时每次运行清空决定日志
+	Resume bool
+	// 按顺序尝试的策略链，第一个给出明确选择的策略生效，全部弃权时以A为准；非空时代替 Strategy
+	StrategyChain []ConflictStrategy
+	// UseResolver 策略调用的冲突解析函数，传入key、需要决定的字段及完整的A、B记录，可在其中请求外部服务；
+	// 返回 UseA 或 UseB 为明确选择，其他值表示弃权
+	ConflictResolver func(key string, diffFields []string, rowA, rowB Row) (ConflictStrategy, error)
+	// ConflictResolver 返回错误时的处理方式，默认中止合并
+	ResolverErrorPolicy ResolverErrorPolicy
+	// PreferNewer 策略使用的版本字段（数值或可按字符串排序的时间），值较大的一方较新
+	VersionField string
+	// UseNewest 策略使用的时间戳字段
+	TimestampField string
+	// TimestampField 的时间格式（Go layout），默认 "2006-01-02 15:04:05"
+	TimestampLayout string
+
+	// 墓碑表：与A、B表位于同一数据库，按 KeyFields 记录已删除的key，这些key不写入C表
+	TombstoneTable string
+	// 墓碑表中的key照常写入C表，并通过 _deleted 列标记为1，而不是排除
+	TombstoneMark bool
+
+	// 冲突数上限，超过时中止任务且不写入C表；0 表示不限制
+	MaxConflicts int
+	// 冲突数占A表记录数的百分比上限（如 5 表示 5%），超过时中止任务且不写入C表；0 表示不限制
+	MaxConflictPct float64
+
+	// _diff_fields 列的存储格式，默认逗号分隔
+	DiffFieldsFormat DiffFieldsFormat
+	// _diff_fields 列的类型，默认 TEXT（使用 DiffFieldsJSON 时可设为 JSON）
+	DiffFieldsColumnType string
+	// 元数据列的类型，如 {"_diff_fields": "MEDIUMTEXT", "_autofill": "MEDIUMTEXT"}，优先于 DiffFieldsColumnType；
+	// 写入前检查元数据列的值是否超出列类型的容量，超出时报错而不是被截断
+	MetaColumnTypes map[string]string
+
+	// 写入 _resolution 列（JSON），记录每个差异字段最终采用A、B还是自动处理，便于审计
+	RecordResolution bool
+	// 写入 _autofill 列，记录全部差异都已自动解决的记录中由B值自动填充的字段列表；
+	// 追加到此前没有该列的C表时需同时开启 AutoMigrateC
+	RecordAutoFill bool
+
+	// 不打印每条冲突的详细信息（仍然统计和合并）；策略中包含 AskUser 时总是打印
+	QuietConflicts bool
+	// 打印信息的详细程度，默认 LogInfo；嵌入其他程序时可使用 LogSilent 不打印任何信息
+	LogLevel LogLevel
+
+	// AskUser 模式下读取用户选择的输入源，默认 os.Stdin；脚本中可传入预先准备好的 A/B 序列
+	InputReader io.Reader
+
+	// 冲突时采用较长（字符数较多）非空值的字段，不经过 Strategy；长度相同时仍按 Strategy 处理
+	LongerWinsFields []string
+	// A为空、B有值时静默回填的字段（如只追加的审计字段）：总是使用B的值，但不视为差异、不打印、
+	// 不计入冲突和 NullAutoFilled，而是计入 SilentBackfilled
+	SilentBackfillFields []string
+
+	// 对比时忽略前导零的字段（如 "00123" 与 "123" 视为相同，"000" 视为 "0"）
+	StripLeadingZeros []string
+	// 写入C表时同时去除 StripLeadingZeros 字段值的前导零
+	NormalizeLeadingZeros bool
+	// 对所有字符串类型字段（char/varchar/text/enum/set）按不区分大小写、不区分重音、忽略末尾空格对比，
+	// 近似 utf8mb4_general_ci 等 _ci 排序规则，使数据库中视为相同的值不再计为冲突
+	CollationCompare bool
+	// 只对这些字段按排序规则对比（不论字段类型），可与 CollationCompare 同时使用
+	CollationFields []string
+	// 对比时去除首尾空白，并将值中连续的空白字符（空格、制表符、换行等）视为一个空格（如 "John  Doe" 与 "John Doe"）；
+	// 只影响对比，写入C表的仍是原值
+	CollapseWhitespace bool
+
+	// 布尔感知对比：A或B中类型为 tinyint(1)/bit(1) 的字段按布尔值对比，如 "1" 与 "true" 视为相同
+	BooleanAwareCompare bool
+	// 布尔对比时识别为真/假的值（不区分大小写），为空时使用默认值 1/true/t/yes/y/on 和 0/false/f/no/n/off
+	TruthyValues []string
+	FalsyValues  []string
+
+	// 空值自动处理策略：一方为空/NULL、另一方有值时如何处理，默认自动使用非空的一方
+	AutoFillPolicy AutoFillPolicy
+	// A、B都为空但不完全相同（如 NULL 与 ""）时C表的取值，默认作为普通冲突按 Strategy 决定
+	BothEmptyPrefer BothEmptyPrefer
+	// _conflict 字段的含义，默认任何差异都标记为冲突；ManualOnly 时仅需按策略决定的差异才标记
+	ConflictSemantics ConflictSemantics
+	// 视为"无值"的占位值（如 -1、N/A、0000-00-00），在空值自动处理时与 NULL/空字符串同等对待，对所有字段生效
+	NullSentinels []string
+	// 按字段配置的占位值，与 NullSentinels 合并生效
+	FieldNullSentinels map[string][]string
+	// 自动处理空值时保留的占位值写为 NULL；默认原样保留占位值
+	NullifySentinels bool
+
+	// C表字段的排列顺序，默认与A表一致
+	ColumnOrder ColumnOrder
+	// ColumnOrder 为 CustomOrder 时的字段顺序
+	CustomColumnOrder []string
+
+	// 写入C表的记录范围，默认全部写入；未写入的记录仍计入统计
+	MatchMode MatchMode
+
+	// 仅在B表中的记录，B表中不存在（或被忽略）的列如何填充，默认NULL
+	BOnlyFillPolicy BOnlyFillPolicy
+	// BOnlyFillCustom 策略下各列的填充值
+	BOnlyFillValues map[string]string
+
+	// 读取A、B表时按关键字段排序（ORDER BY KeyFields），使处理顺序和冲突编号在多次运行间保持一致
+	OrderSourcesByKey bool
+	// 在同一个 REPEATABLE READ 一致性快照（START TRANSACTION WITH CONSISTENT SNAPSHOT）中读取A、B表，
+	// 避免两次读取之间的并发写入造成结果不一致；要求A、B表使用同一数据库连接
+	ConsistentRead bool
+
+	// 按关键字段排序后再写入C表（默认按A表顺序、随后是仅在B表中的记录），使重跑结果的行顺序确定
+	SortResults bool
+
+	// C表附加列及其固定值（如批次号、来源文件名），列类型为 VARCHAR(255)
+	ExtraColumns map[string]string
+	// 按行计算附加列的值，source 为该行的 _source；只有 ExtraColumns 中声明的列生效，返回值覆盖固定值
+	ExtraColumnFunc func(row Row, source string) map[string]string
+
+	// C表 ENUM/SET 列出现不在取值范围内的值（通常来自B表）时返回错误且不写入C表；默认只统计并打印警告
+	StrictEnum bool
+
+	// A、B表中同名字段数据类型不一致（如 DECIMAL 与 VARCHAR）时，未在 TypeCoercions 中配置对比方式的字段不参与对比；
+	// 默认只在 MergeStats.TypeMismatches 中记录并打印警告，仍按字符串对比
+	RefuseTypeMismatch bool
+	// 类型不一致字段的对比方式，配置后即使开启 RefuseTypeMismatch 也参与对比
+	TypeCoercions map[string]TypeCoercion
+
+	// 引用完整性检查：A表字段的值应在B表指定字段中存在，不存在的计为孤儿（只统计并打印警告，见 Orphans()）
+	ReferenceChecks []ReferenceCheck
+	// 每项引用检查保留的孤儿值样例数，默认 10
+	OrphanSampleSize int
+
+	// 写入前对每个结果行调用的回调，可修改行中的值（包括 ExtraColumns 附加列），source 为该行的 _source；
+	// 返回错误时中止且不写入
+	PreInsert func(row map[string]*string, source string) error
+
+	// 额外的结果输出目标（如CSV归档、回调通知），写入C表后每个目标都会收到全部结果行
+	Sinks []ResultSink
+
+	// 单个INSERT语句的字节上限（按字段值长度估算），超过时自动拆分批次；0 表示只按 BatchSize 拆分
+	MaxBatchBytes int
+	// 连接后查询 max_allowed_packet，以其一半作为单批字节上限（与 MaxBatchBytes 同时设置时取较小者）
+	AutoPacketSize bool
+
+	// B表数据不常驻内存：逐行写入临时文件，内存中只保留key和文件偏移，对比时按需读回（以速度换内存）
+	DiskIndexB bool
+	// DiskIndexB 临时文件所在目录，为空时使用系统临时目录
+	TempDir string
 
 	// 批量写入大小
 	BatchSize int
+	// 分页读取A、B表时每页的记录数（按关键字段排序，从上一页最后一个key之后继续读取），与写入的 BatchSize 相互独立；
+	// 0 表示单条查询读取全部。要求关键字段为 NOT NULL 且有主键或唯一索引，否则读取时返回错误
+	ReadChunkSize int
+	// 对比A、B记录的协程数，大于1时并行找出差异字段（适用于JSON等较耗CPU的对比），默认串行
+	Workers int
+	// 并发写入C表的协程数，大于1时多个批次并行写入（每个协程使用独立连接），默认串行
+	InsertConcurrency int
+
+	// 冲突时保留B表原值的影子列后缀（如 "_b"），为空表示不保留
+	// 仅对实际发生冲突的字段在C表中追加影子列，例如 email -> email_b
+	KeepBValuesColumnSuffix string
+
+	// 按JSON子键合并的字段（MySQL json类型列）：以A为基础，缺失的子键用B补全，
+	// 子键冲突时按 Strategy 处理；值无法解析为JSON对象时按普通字段处理
+	JSONMergeFields []string
+
+	// C表自增代理主键的列名，默认 "id"；当源表中存在非自增的自然 id 列时可改名避免冲突
+	SurrogateKeyName string
+	// 不创建自增代理主键，以 KeyFields 作为C表的主键（关键字段为 NOT NULL，存在NULL时中止且不写入C表）
+	NoSurrogateKey bool
+
+	// C表列类型映射：键为源列类型（先按完整类型如 tinyint(1)，再按数据类型如 tinyint 匹配，不区分大小写），
+	// 值为C表中使用的类型；未映射的类型保持不变
+	TypeMap map[string]string
+
+	// 执行前改写C表的 CREATE TABLE 语句，例如追加分区、行格式或表注释；为 nil 时不改写
+	DDLRewriter func(ddl string) string
+	// 执行前改写C表的 DROP TABLE 语句；为 nil 时不改写
+	DropRewriter func(ddl string) string
+	// C表创建后（写入数据前）按顺序执行的语句，如授权、创建触发器；任一语句失败时中止
+	PostCreateSQL []string
+
+	// 运行成功后将 MergeStats 写入该表（与C表同库，不存在时自动创建），每次运行一行，形成运行历史；为空时不写入
+	StatsTable string
+
+	// C表名已作为视图存在时删除该视图后再建表；默认报错，避免误删视图
+	DropViewC bool
+
+	// 追加模式：C表已存在时不删除重建，直接追加写入；C表不存在时自动创建
+	AppendMode bool
+	// 追加模式下，写入前用 ALTER TABLE ADD COLUMN 为已存在的C表补充当前A/B表结构中缺失的列（只增不删）；
+	// 新的源列可为NULL且默认NULL（不复制源列默认值），C表中已有记录的新列为NULL；执行的每条 ALTER 语句都会打印
+	AutoMigrateC bool
+	// 追加模式下自动补充C表缺失的列，与 AutoMigrateC 相同，任一开启即生效
+	AutoAddColumns bool
+	// 写入C表使用的语句，默认 INSERT INTO；ReplaceInto 需要C表有按关键字段的唯一键（如开启 NoSurrogateKey），
+	// 否则与普通 INSERT 相同
+	InsertMode InsertMode
+	// 整批写入C表失败时逐行重试，仍失败的行不中止合并，计入 Rejected（配置 RejectTable 时写入该表）
+	ContinueOnInsertError bool
+	// 写入失败行的拒绝表（与C表同库，不存在时自动创建），保存运行标识、行数据（JSON）和错误信息；
+	// 为空时只记录日志
+	RejectTable string
+
+	// 字段默认值：写入C表时字段值为空/NULL则使用配置的默认值（与A、B之间的自动填充相互独立）
+	DefaultFill map[string]string
+
+	// 写入后重新读取C表核对：记录数增量须与本次写入数一致，并抽样检查部分关键字段能否查回
+	VerifyAfterWrite bool
+
+	// 为每行计算内容哈希（C表字段值的MD5）并写入 _row_hash 列；
+	// 追加模式下，C表中已有同key且哈希相同的行将被跳过，哈希变化的行替换C表中的旧行，
+	// 因此须配合 InsertMode=ReplaceInto，且C表有按关键字段的唯一键（如开启 NoSurrogateKey）
+	RowHash bool
+	// 追加模式下配合 RowHash，只按本次结果行的关键字段分批查询C表中已有记录的行哈希，
+	// 不读取整个C表的哈希，适合大表上近乎幂等的重复运行
+	SkipUnchangedVsC bool
+
+	// 为C表追加 _src_id_a、_src_id_b 列，记录产生该行的A、B表记录主键，便于回溯
+	TraceSourceIDs bool
+	// TraceSourceIDs 使用的主键列名，默认 "id"；该列即使被排除出对比也会被读取
+	SourceIDField string
+
+	// EstimateMemory 判断是否超出的内存上限（字节），默认 1GB
+	MemoryLimit int64
+
+	// 读取A、B表时排除的列（不区分大小写），自增列（EXTRA含auto_increment）总是自动排除
+	ExcludeColumns []string
+	// 是否按名称排除名为 id 的列（即使它不是自增列），默认只排除自增列
+	ExcludeIDByName bool
 }
 
 // MergeStats 合并统计信息
 type MergeStats struct {
-	TotalA         int // A表总记录数
-	TotalB         int // B表总记录数
-	TotalC         int // C表最终记录数
-	ExactMatch     int // 完全相同的记录数
-	OnlyInA        int // 仅在A表中的记录数
-	OnlyInB        int // 仅在B表中的记录数
-	Conflict       int // 关键字段相同但其他字段不同的记录数
-	NullAutoFilled int // 自动用非空值填充的记录数
-	ConflictUseA   int // 冲突中选择A的次数
-	ConflictUseB   int // 冲突中选择B的次数
-	StartTime      time.Time
-	EndTime        time.Time
+	TotalA             int    // A表总记录数
+	TotalB             int    // B表总记录数
+	TotalC             int    // C表最终记录数
+	ExactMatch         int    // 完全相同的记录数
+	OnlyInA            int    // 仅在A表中的记录数
+	OnlyInB            int    // 仅在B表中的记录数
+	Conflict           int    // 关键字段相同但其他字段不同的记录数
+	NullAutoFilled     int    // 自动用非空值填充的记录数
+	DefaultFilled      int    // 使用 DefaultFill 默认值填充的字段数
+	SkippedUnchanged   int    // 追加模式下因内容哈希未变化而跳过写入的记录数
+	ConflictUseA       int    // 冲突中选择A的次数
+	ConflictUseB       int    // 冲突中选择B的次数
+	ConflictUseNewest  int    // 冲突中由 UseNewest 按时间戳决定的次数（已计入选择A/B的次数）
+	Tombstoned         int    // 关键字段在墓碑表中的记录数（被排除或标记）
+	EnumViolations     int    // 不在ENUM/SET列取值范围内的值的个数
+	LongerWinsResolved int    // 按 LongerWinsFields 自动采用较长值的字段个数
+	LeadingZeroMatched int    // 因 StripLeadingZeros 忽略前导零而不再视为冲突的字段值个数
+	Uncompared         int    // 被 ShouldCompare 排除对比、原样写入A表记录的匹配数
+	FilteredA          int    // 被 FilterA 过滤掉的A表记录数（不计入 TotalA）
+	FilteredB          int    // 被 FilterB 过滤掉的B表记录数（不计入 TotalB）
+	Rejected           int    // ContinueOnInsertError 时逐行重试仍写入失败的记录数（不计入 TotalC）
+	SilentBackfilled   int    // 按 SilentBackfillFields 静默回填的字段个数（不计入冲突和 NullAutoFilled）
+	Resumed            int    // Resume 时按决定日志自动应用的决定数（已计入选择A/B的次数）
+	Orphans            int    // 按 ReferenceChecks 检查，引用值在B表中不存在的A表记录数（各项检查累计）
+	Undecided          int    // 提前终止时尚未决定、未写入C表的延后冲突数
+	Stopped            bool   // 是否被 Stop() 提前终止（C表仅包含终止前已处理的记录）
+	RunID              string // 本次运行的标识（开始时间，精确到微秒）
+	StartTime          time.Time
+	EndTime            time.Time
+
+	// A、B表中数据类型不一致的同名字段
+	TypeMismatches []TypeMismatch
 }
 
 // String 返回统计信息的可读字符串
@@ -77,6 +657,9 @@ func (s *MergeStats) String() string {
 A表总记录数:          %d
 B表总记录数:          %d
 C表最终记录数:        %d
+写入失败被拒绝:        %d
+A表过滤掉:            %d
+B表过滤掉:            %d
 ----------------------------------------
 完全相同记录:          %d
 仅在A表中:            %d
@@ -84,26 +667,132 @@ C表最终记录数:        %d
 关键字段相同但值不同:  %d
   - 选择A表数据:      %d
   - 选择B表数据:      %d
+  - 按时间戳决定:     %d
+  - 按决定日志续做:   %d
 自动填充空值:          %d
+静默回填:              %d
+默认值填充:            %d
+未变化跳过写入:        %d
+墓碑表删除/标记:       %d
+跳过对比(原样用A):     %d
+ENUM/SET越界值:        %d
+字段类型不一致:        %d
+引用缺失(孤儿):        %d
+忽略前导零视为相同:    %d
+较长值优先自动处理:    %d
 ----------------------------------------
 执行耗时:              %v
+提前终止:              %v
+终止时未决定冲突:      %d
 ========================================
-`, s.TotalA, s.TotalB, s.TotalC,
+`, s.TotalA, s.TotalB, s.TotalC, s.Rejected, s.FilteredA, s.FilteredB,
 		s.ExactMatch, s.OnlyInA, s.OnlyInB,
-		s.Conflict, s.ConflictUseA, s.ConflictUseB,
-		s.NullAutoFilled, duration)
+		s.Conflict, s.ConflictUseA, s.ConflictUseB, s.ConflictUseNewest, s.Resumed,
+		s.NullAutoFilled, s.SilentBackfilled, s.DefaultFilled, s.SkippedUnchanged, s.Tombstoned, s.Uncompared, s.EnumViolations, len(s.TypeMismatches), s.Orphans, s.LeadingZeroMatched, s.LongerWinsResolved, duration, s.Stopped, s.Undecided)
+}
+
+// FieldRoleKind 字段在合并中的角色
+type FieldRoleKind string
+
+const (
+	// RoleKey 关键字段，用于匹配A、B表记录
+	RoleKey FieldRoleKind = "key"
+	// RoleCompared 参与对比的字段
+	RoleCompared FieldRoleKind = "compared"
+	// RoleIgnored A表忽略对比的字段（IgnoreFieldsA），其值仍写入C表
+	RoleIgnored FieldRoleKind = "ignored"
+	// RoleDropped B表忽略的字段（IgnoreFieldsB），不参与对比，B表的值不写入C表
+	RoleDropped FieldRoleKind = "dropped"
+	// RoleAOnly 仅在A表中的字段，写入C表但无法对比
+	RoleAOnly FieldRoleKind = "a_only"
+	// RoleBOnly 仅在B表中的字段，不写入C表
+	RoleBOnly FieldRoleKind = "b_only"
+	// RoleCompareOnly 参与对比但不写入C表的字段（CompareButNotOutputFields）
+	RoleCompareOnly FieldRoleKind = "compare_only"
+)
+
+// FieldRole 字段角色
+type FieldRole struct {
+	Name string        // 字段名
+	Kind FieldRoleKind // 角色
+	InA  bool          // A表中是否存在
+	InB  bool          // B表中是否存在
+}
+
+// fieldRoleNames 字段角色的中文说明
+var fieldRoleNames = map[FieldRoleKind]string{
+	RoleKey:         "关键字段",
+	RoleCompared:    "参与对比",
+	RoleIgnored:     "忽略对比(保留A值)",
+	RoleDropped:     "丢弃B值",
+	RoleAOnly:       "仅A表(不对比)",
+	RoleBOnly:       "仅B表(不写入)",
+	RoleCompareOnly: "参与对比(不写入)",
+}
+
+// FormatFieldPlan 将字段角色列表格式化为可读文本
+func FormatFieldPlan(plan []FieldRole) string {
+	var sb strings.Builder
+	sb.WriteString("[计划] 字段角色:\n")
+	for _, r := range plan {
+		fmt.Fprintf(&sb, "    %-30s %s\n", r.Name, fieldRoleNames[r.Kind])
+	}
+	return sb.String()
+}
+
+// baseMetaFields C表中固定的元数据字段
+var baseMetaFields = []string{"_source", "_conflict", "_diff_fields"}
+
+// metaColumn 元数据字段的列定义
+type metaColumn struct {
+	colType      string // 列类型
+	defaultValue string // 默认值，如 NULL、0
+	comment      string // 列注释
+}
+
+// metaColumnDefs 元数据字段的列定义
+var metaColumnDefs = map[string]metaColumn{
+	"_source":      {"VARCHAR(10)", "NULL", "数据来源: A/B/MERGE_A/MERGE_B/SKIP"},
+	"_conflict":    {"TINYINT(1)", "0", "是否冲突记录: 0-否, 1-是"},
+	"_diff_fields": {"TEXT", "NULL", "不同的字段列表"},
+	"_autofill":    {"TEXT", "NULL", "A为空时自动用B值填充的字段列表"},
+	"_row_hash":    {"CHAR(32)", "NULL", "行内容哈希，用于变更检测"},
+	"_deleted":     {"TINYINT(1)", "0", "是否在墓碑表中: 0-否, 1-是"},
+	"_src_id_a":    {"VARCHAR(64)", "NULL", "来源A表记录的主键"},
+	"_src_id_b":    {"VARCHAR(64)", "NULL", "来源B表记录的主键"},
+	"_resolution":  {"TEXT", "NULL", "各差异字段的处理结果(JSON): A/B/auto"},
+}
+
+// ColumnInfo 列信息（来自 INFORMATION_SCHEMA.COLUMNS）
+type ColumnInfo struct {
+	Name            string         // 列名
+	OrdinalPosition int            // 列序号
+	ColumnDefault   sql.NullString // 默认值
+	IsNullable      string         // 是否允许NULL: YES/NO
+	DataType        string         // 数据类型，如 varchar
+	ColumnType      string         // 完整类型，如 varchar(64)
+	Extra           string         // 额外信息，如 auto_increment
+	FullDefinition  string         // 完整的列定义，用于创建表
+}
+
+// Row 一行数据，键为字段名，值为 nil 表示 NULL
+type Row map[string]*string
+
+// KeyRange 只读取A、B表中字段值在 [Min, Max] 范围内的记录，用于分段对账；Min 或 Max 为空表示该侧不限制
+type KeyRange struct {
+	Field string
+	Min   string
+	Max   string
 }
 
-// columnInfo 列信息
-type columnInfo struct {
-	Name            string
-	OrdinalPosition int
-	ColumnDefault   sql.NullString
-	IsNullable      string
-	DataType        string
-	ColumnType      string
-	Extra           string
-	FullDefinition  string // 完整的列定义，用于创建表
+// DerivedField 对比前由一侧的多个列计算出的字段值，例如用B表的 first_name、last_name 拼出 full_name 与A表对比
+type DerivedField struct {
+	// 计算结果写入的字段名，须为C表字段才会参与对比
+	Field string
+	// 计算值所在的一侧："A" 或 "B"
+	Side string
+	// 根据该侧的整行数据计算字段值，返回 nil 表示 NULL
+	Compute func(row Row) *string
 }
 
 // rowData 行数据，所有值存为 *string（nil 表示 NULL）
@@ -111,21 +800,58 @@ type rowData struct {
 	Values map[string]*string
 }
 
+// EstimateResult 内存占用预估结果
+type EstimateResult struct {
+	RowsA          int   // A表记录数
+	RowsB          int   // B表记录数
+	AvgRowBytesA   int64 // A表抽样行的平均内存占用（字节）
+	AvgRowBytesB   int64 // B表抽样行的平均内存占用（字节）
+	EstimatedBytes int64 // 预估的内存峰值（字节）
+	Limit          int64 // 判断所用的内存上限（字节）
+	ExceedsLimit   bool  // 预估峰值超过上限，建议拆分数据（如按关键字段分段）后分批合并
+}
+
+// String 返回可读的预估报告
+func (r EstimateResult) String() string {
+	return fmt.Sprintf("[预估] A表 %d 行(平均 %d 字节/行), B表 %d 行(平均 %d 字节/行), 预估内存峰值 %.1f MB, 上限 %.1f MB, 超出上限: %v\n",
+		r.RowsA, r.AvgRowBytesA, r.RowsB, r.AvgRowBytesB,
+		float64(r.EstimatedBytes)/(1<<20), float64(r.Limit)/(1<<20), r.ExceedsLimit)
+}
+
 // Merger 数据合并器
 type Merger struct {
 	config MergeConfig
-	db     *sql.DB
+	db     *sql.DB // C表所在的数据库连接
+	dbA    *sql.DB // A表所在的数据库连接
+	dbB    *sql.DB // B表所在的数据库连接
 	stats  MergeStats
 
-	columnsA    []columnInfo // A表的列信息（排除id）
-	columnsB    []columnInfo // B表的列信息（排除id）
-	columnsC    []columnInfo // C表的列信息（以A表为准）
+	statsMu sync.Mutex // 保护 stats 的修改，使 Stats() 可在合并进行中被其他协程调用
+
+	conns    map[string]*sql.DB // 按DSN复用的数据库连接
+	snapshot *sql.Conn          // ConsistentRead 时读取A、B表的事务连接
+
+	columnsA    []ColumnInfo // A表的列信息（排除自增列等）
+	columnsB    []ColumnInfo // B表的列信息（排除自增列等）
+	columnsC    []ColumnInfo // C表的列信息（以A表为准）
 	fieldNamesA []string     // A表字段名列表
 	fieldNamesB []string     // B表字段名列表
 	fieldNamesC []string     // C表字段名列表
 
 	ignoreSetA map[string]bool // A表忽略字段集合
 	ignoreSetB map[string]bool // B表忽略字段集合
+	hiddenSet  map[string]bool // 参与对比但不写入C表的字段集合
+	jsonSet    map[string]bool // 按JSON子键合并的字段集合
+	binarySet  map[string]bool // 二进制类型（blob/binary/varbinary）字段集合
+	boolSet    map[string]bool // 布尔类型（tinyint(1)/bit(1)）字段集合
+	zeroSet    map[string]bool // 忽略前导零对比的字段集合
+	collateSet map[string]bool // 按排序规则（不区分大小写/重音）对比的字段集合
+	longerSet  map[string]bool // 冲突时较长者优先的字段集合
+	silentSet  map[string]bool // 静默回填的字段集合
+	sentinels  map[string]bool // 对所有字段生效的占位值集合
+
+	// 因忽略前导零而视为相同的字段值个数（对比可能并行，使用原子计数）
+	zeroMatched atomic.Int64
 
 	// 用于对比的字段：C表字段中排除关键字段和A忽略字段
 	compareFields []string
@@ -133,8 +859,49 @@ type Merger struct {
 	// B表字段在C表中存在的映射
 	bFieldInC map[string]bool
 
-	// 标准输入读取器（全局唯一，避免重复创建导致缓冲区混乱）
+	// 墓碑表中的key集合
+	tombstones map[string]bool
+
+	// 发生冲突、需要保留B表原值影子列的字段集合
+	shadowSet map[string]bool
+
+	// C表中已存在的列
+	existingColsC map[string]bool
+
+	// 用户输入读取器（全局唯一，避免重复创建导致缓冲区混乱）
 	stdinReader *bufio.Reader
+
+	// 终止标记，由 Stop() 设置
+	stopped atomic.Bool
+
+	// Deferred 模式下等待用户决定的冲突
+	pending []*pendingDecision
+
+	// Resume 时从决定日志载入的决定，以及正在追加写入的决定日志
+	decisions    map[string]ConflictStrategy
+	decisionFile *os.File
+
+	// 最近一次运行中收集的冲突记录，用于 WriteTextReport
+	conflicts []ConflictRecord
+	// 最近一次 ChangeEvents 模式运行产生的变更事件
+	changes []ChangeEvent
+	// 最近一次运行的引用完整性检查结果
+	orphans []OrphanReport
+	// RunContext 运行期间的 ctx，数据库操作均使用它（见 runCtx）
+	ctx context.Context
+	// ConflictResolver 出错且策略为中止时记录的错误，合并循环据此中止
+	resolverErr error
+}
+
+// pendingDecision 等待用户决定的冲突
+type pendingDecision struct {
+	key    string   // 关键字段拼接的key
+	fields []string // 需要决定的字段
+	rowA   *rowData
+	rowB   *rowData
+	useA   *rowData // 以A为准时的C表行
+	useB   *rowData // 以B为准时的C表行
+	index  int      // 在结果行中的位置
 }
 
 // NewMerger 创建新的合并器
@@ -142,12 +909,27 @@ func NewMerger(config MergeConfig) *Merger {
 	if config.BatchSize <= 0 {
 		config.BatchSize = 500
 	}
+	if config.SurrogateKeyName == "" {
+		config.SurrogateKeyName = "id"
+	}
+	if config.SourceIDField == "" {
+		config.SourceIDField = "id"
+	}
+	if config.InputReader == nil {
+		config.InputReader = os.Stdin
+	}
 	m := &Merger{
 		config:      config,
 		ignoreSetA:  make(map[string]bool),
 		ignoreSetB:  make(map[string]bool),
+		hiddenSet:   make(map[string]bool),
 		bFieldInC:   make(map[string]bool),
-		stdinReader: bufio.NewReader(os.Stdin), // 只创建一次
+		jsonSet:     make(map[string]bool),
+		zeroSet:     make(map[string]bool),
+		longerSet:   make(map[string]bool),
+		silentSet:   make(map[string]bool),
+		sentinels:   make(map[string]bool),
+		stdinReader: bufio.NewReader(config.InputReader), // 只创建一次
 	}
 	for _, f := range config.IgnoreFieldsA {
 		m.ignoreSetA[f] = true
@@ -155,565 +937,3478 @@ func NewMerger(config MergeConfig) *Merger {
 	for _, f := range config.IgnoreFieldsB {
 		m.ignoreSetB[f] = true
 	}
+	for _, f := range config.CompareButNotOutputFields {
+		m.hiddenSet[f] = true
+	}
+	for _, f := range config.JSONMergeFields {
+		m.jsonSet[f] = true
+	}
+	for _, f := range config.StripLeadingZeros {
+		m.zeroSet[f] = true
+	}
+	for _, f := range config.LongerWinsFields {
+		m.longerSet[f] = true
+	}
+	for _, f := range config.SilentBackfillFields {
+		m.silentSet[f] = true
+	}
+	for _, v := range config.NullSentinels {
+		m.sentinels[v] = true
+	}
 	return m
 }
 
 // Run 执行合并操作
 func (m *Merger) Run() (*MergeStats, error) {
-	m.stats = MergeStats{} // 重置统计
-	m.stats.StartTime = time.Now()
-	fmt.Printf("[开始] 数据合并任务启动 - %s\n", m.stats.StartTime.Format("2006-01-02 15:04:05"))
-	fmt.Printf("[配置] A表: [%s] VS B表: [%s] -> C表: [%s]\n", m.config.TableA, m.config.TableB, m.config.TableC)
-	fmt.Printf("[配置] 关键字段: %v\n", strings.Join(m.config.KeyFields, ","))
-	if len(m.config.IgnoreFieldsA) > 0 {
-		fmt.Printf("[配置] A表忽略对比字段: %v\n", strings.Join(m.config.IgnoreFieldsA, ","))
+	stats, err := m.run()
+	if err != nil {
+		m.errorf("[错误] 数据合并任务失败: %v\n", err)
 	}
-	if len(m.config.IgnoreFieldsB) > 0 {
-		fmt.Printf("[配置] B表忽略字段: %v\n", strings.Join(m.config.IgnoreFieldsB, ","))
+	return stats, err
+}
+
+// RunContext 执行合并操作，所有数据库读写都使用 ctx：ctx 取消时终止合并并中断正在执行的查询和写入，
+// 取消前已写入C表的批次不会回滚；此时返回统计信息和 ctx.Err()
+func (m *Merger) RunContext(ctx context.Context) (*MergeStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	strategyName := "以A表为准"
-	if m.config.Strategy == UseB {
-		strategyName = "以B表为准"
-	} else if m.config.Strategy == AskUser {
-		strategyName = "交互式询问用户"
+	m.ctx = ctx
+	defer func() { m.ctx = nil }()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.Stop()
+		case <-done:
+		}
+	}()
+	stats, err := m.Run()
+	if ctx.Err() != nil {
+		return stats, ctx.Err()
 	}
-	fmt.Printf("[配置] 冲突策略: %s\n", strategyName)
+	return stats, err
+}
 
-	// 1. 连接数据库
-	var err error
-	m.db, err = sql.Open("mysql", m.config.DSN)
-	if err != nil {
-		logx.Errorf("连接数据库失败: %v", err)
-		return nil, fmt.Errorf("连接数据库失败: %v", err)
+// runCtx 返回数据库操作使用的上下文：RunContext 传入的 ctx，未设置时为 context.Background()
+func (m *Merger) runCtx() context.Context {
+	if m.ctx != nil {
+		return m.ctx
 	}
-	defer m.db.Close()
+	return context.Background()
+}
 
-	if err = m.db.Ping(); err != nil {
-		logx.Errorf("数据库Ping失败: %v", err)
-		return nil, fmt.Errorf("数据库Ping失败: %v", err)
-	}
-	fmt.Printf("[信息] 数据库连接成功\n")
+// Merge 按配置执行一次合并，等同于 NewMerger(config).Run()，适用于一次性脚本
+func Merge(config MergeConfig) (*MergeStats, error) {
+	return NewMerger(config).Run()
+}
 
-	// 2. 获取A表和B表的列信息
-	m.columnsA, err = m.getColumns(m.config.TableA)
-	if err != nil {
+// MergeContext 按配置执行一次合并，等同于 NewMerger(config).RunContext(ctx)
+func MergeContext(ctx context.Context, config MergeConfig) (*MergeStats, error) {
+	return NewMerger(config).RunContext(ctx)
+}
+
+// run 执行合并操作的各个步骤
+func (m *Merger) run() (*MergeStats, error) {
+	// C表与源表同名时重建C表会删除源表，必须最先检查
+	if err := m.Validate(); err != nil {
 		return nil, err
 	}
-	m.columnsB, err = m.getColumns(m.config.TableB)
+	m.setStats(func(s *MergeStats) { // 重置统计
+		now := time.Now()
+		*s = MergeStats{StartTime: now, RunID: now.Format("20060102150405.000000")}
+	})
+	m.stopped.Store(false)
+	if m.ctx != nil && m.ctx.Err() != nil {
+		m.Stop() // RunContext 的 ctx 在重置终止标记之前已取消
+	}
+	m.infof("[开始] 数据合并任务启动 - %s\n", m.stats.StartTime.Format("2006-01-02 15:04:05"))
+	m.infof("[配置] A表: [%s] VS B表: [%s] -> C表: [%s]\n", m.config.TableA, m.config.TableB, m.config.TableC)
+	m.printConfig()
+
+	// 1. 连接数据库
+	err := m.connect()
 	if err != nil {
 		return nil, err
 	}
+	defer m.closeDB()
 
-	// 重置字段名列表
-	m.fieldNamesA = nil
-	m.fieldNamesB = nil
-	m.fieldNamesC = nil
-	m.compareFields = nil
-
-	for _, c := range m.columnsA {
-		m.fieldNamesA = append(m.fieldNamesA, c.Name)
-	}
-	for _, c := range m.columnsB {
-		m.fieldNamesB = append(m.fieldNamesB, c.Name)
+	// 2-6. 读取A、B表并对比合并
+	resultRows, err := m.readAndMerge()
+	if err != nil {
+		return nil, err
 	}
 
-	// 3. C表字段以A表为准
-	m.columnsC = make([]columnInfo, len(m.columnsA))
-	copy(m.columnsC, m.columnsA)
-	for _, c := range m.columnsC {
-		m.fieldNamesC = append(m.fieldNamesC, c.Name)
+	// 变更事件模式：只生成变更事件，不改动C表
+	if m.config.ChangeEvents {
+		m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+		m.infof("%s", m.stats.String())
+		return &m.stats, nil
 	}
 
-	// 构建B表字段集合，判断B表字段是否在C表中
-	bFieldSet := make(map[string]bool)
-	for _, f := range m.fieldNamesB {
-		bFieldSet[f] = true
-	}
-	for _, f := range m.fieldNamesC {
-		if bFieldSet[f] {
-			m.bFieldInC[f] = true
+	if m.config.ChangelogMode {
+		if err = m.applyPreInsert(resultRows); err != nil {
+			return nil, err
 		}
+		return m.runChangelog(resultRows)
 	}
 
-	// 构建用于对比的字段列表：C表字段中排除关键字段和A表忽略字段
-	keySet := make(map[string]bool)
-	for _, k := range m.config.KeyFields {
-		keySet[k] = true
-	}
-	for _, f := range m.fieldNamesC {
-		if !keySet[f] && !m.ignoreSetA[f] {
-			m.compareFields = append(m.compareFields, f)
+	if m.config.NoSurrogateKey {
+		if err = m.checkKeysNotNull(resultRows); err != nil {
+			return nil, err
 		}
 	}
-
-	fmt.Printf("[信息] A表字段(%d): %v\n", len(m.fieldNamesA), strings.Join(m.fieldNamesA, ","))
-	fmt.Printf("[信息] B表字段(%d): %v\n", len(m.fieldNamesB), strings.Join(m.fieldNamesB, ","))
-	fmt.Printf("[信息] C表字段(%d): %v\n", len(m.fieldNamesC), strings.Join(m.fieldNamesC, ","))
-	fmt.Printf("[信息] 用于对比的字段(%d): %v\n", len(m.compareFields), strings.Join(m.compareFields, ","))
-
-	// 4. 重新创建C表
-	if err = m.recreateTableC(); err != nil {
+	if err = m.checkMetaCapacity(resultRows); err != nil {
 		return nil, err
 	}
 
-	// 5. 读取A表数据
-	fmt.Printf("[信息] 正在读取A表(%s)数据...\n", m.config.TableA)
-	dataA, err := m.readTable(m.config.TableA, m.fieldNamesA)
-	if err != nil {
+	// 7. 准备C表（默认重新创建）
+	if err = m.prepareTableC(); err != nil {
 		return nil, err
 	}
-	m.stats.TotalA = len(dataA)
-	fmt.Printf("[信息] A表共 %d 条记录\n", m.stats.TotalA)
 
-	// 6. 读取B表数据
-	fmt.Printf("[信息] 正在读取B表(%s)数据...\n", m.config.TableB)
-	dataB, err := m.readTable(m.config.TableB, m.fieldNamesB)
-	if err != nil {
+	// 8. 为冲突字段追加保留B表原值的影子列
+	if err = m.addShadowColumnsC(); err != nil {
 		return nil, err
 	}
-	m.stats.TotalB = len(dataB)
-	fmt.Printf("[信息] B表共 %d 条记录\n", m.stats.TotalB)
 
-	// 7. 建立B表索引：key -> rowData
-	bIndex := make(map[string]*rowData)
-	for i := range dataB {
-		key := m.buildKey(&dataB[i])
-		bIndex[key] = &dataB[i]
+	// 9. 批量写入C表（追加模式下先核对C表列，并跳过内容未变化的记录）
+	if err = m.applyPreInsert(resultRows); err != nil {
+		return nil, err
 	}
-
-	// 8. 对比并合并
-	fmt.Printf("[信息] 开始数据对比与合并...\n")
-	var resultRows []rowData
-	bMatched := make(map[string]bool) // 记录B表中已匹配的key
-
-	for i := range dataA {
-		rowA := &dataA[i]
-		keyA := m.buildKey(rowA)
-
-		if rowB, ok := bIndex[keyA]; ok {
-			// 在B表中找到了相同关键字段的记录
-			bMatched[keyA] = true
-			merged := m.compareAndMerge(rowA, rowB, keyA)
-			resultRows = append(resultRows, *merged)
-		} else {
-			// 仅在A表中
-			m.stats.OnlyInA++
-			resultRows = append(resultRows, *m.buildCRowFromAWithMeta(rowA, "A", false, ""))
+	if m.config.AppendMode {
+		if err = m.checkInsertColumnsC(); err != nil {
+			return nil, err
 		}
 	}
+	if resultRows, err = m.skipUnchanged(resultRows); err != nil {
+		return nil, err
+	}
+	m.infof("========================================\n")
+	m.infof("[信息] 正在写入C表(%s)，共 %d 条记录...\n", m.config.TableC, len(resultRows))
+	var countBefore int
+	if m.config.VerifyAfterWrite {
+		if countBefore, err = m.countTableC(); err != nil {
+			return nil, err
+		}
+	}
+	if resultRows, err = m.batchInsertC(resultRows); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalC = len(resultRows) })
+	if err = m.writeSinks(resultRows); err != nil {
+		return nil, err
+	}
 
-	// 9. 处理仅在B表中的数据
-	for i := range dataB {
-		key := m.buildKey(&dataB[i])
-		if !bMatched[key] {
-			m.stats.OnlyInB++
-			resultRows = append(resultRows, *m.buildCRowFromB(&dataB[i]))
+	// 10. 写入后核对
+	if m.config.VerifyAfterWrite {
+		if err = m.verifyTableC(resultRows, countBefore); err != nil {
+			return nil, err
 		}
 	}
 
-	// 10. 批量写入C表
-	fmt.Printf("========================================\n")
-	fmt.Printf("[信息] 正在写入C表(%s)，共 %d 条记录...\n", m.config.TableC, len(resultRows))
-	if err = m.batchInsertC(resultRows); err != nil {
+	m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+	m.metricObserve(MetricDurationSeconds, m.stats.EndTime.Sub(m.stats.StartTime).Seconds())
+
+	// 11. 记录本次运行的统计
+	if err = m.writeStatsTable(); err != nil {
 		return nil, err
 	}
-	m.stats.TotalC = len(resultRows)
-
-	m.stats.EndTime = time.Now()
-	fmt.Printf("[完成] 数据处理任务结束 - %s\n", m.stats.EndTime.Format("2006-01-02 15:04:05"))
-	fmt.Print(m.stats.String())
+	m.infof("[完成] 数据处理任务结束 - %s\n", m.stats.EndTime.Format("2006-01-02 15:04:05"))
+	m.infof("%s", m.stats.String())
 
 	return &m.stats, nil
 }
 
-// getColumns 获取表的列信息（排除自增主键id）
-func (m *Merger) getColumns(tableName string) ([]columnInfo, error) {
-	query := `
-		SELECT 
-			COLUMN_NAME, ORDINAL_POSITION, COLUMN_DEFAULT, IS_NULLABLE,
-			DATA_TYPE, COLUMN_TYPE, EXTRA
-		FROM INFORMATION_SCHEMA.COLUMNS 
-		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
-		ORDER BY ORDINAL_POSITION
-	`
-	rows, err := m.db.Query(query, tableName)
+// readAndMerge 读取A、B表结构和数据并对比合并，返回待写入C表的结果行（Run 的第2-6步，不涉及C表）；
+// ChangeEvents 模式下只生成变更事件，返回 nil
+func (m *Merger) readAndMerge() ([]rowData, error) {
+	// 2. 获取A表和B表的列信息
+	err := m.loadColumns()
 	if err != nil {
-		logx.Errorf("查询表%s列信息失败: %v", tableName, err)
-		return nil, fmt.Errorf("查询表%s列信息失败: %v", tableName, err)
+		return nil, err
 	}
-	defer rows.Close()
 
-	var columns []columnInfo
-	for rows.Next() {
-		var col columnInfo
-		if err := rows.Scan(&col.Name, &col.OrdinalPosition, &col.ColumnDefault,
-			&col.IsNullable, &col.DataType, &col.ColumnType, &col.Extra); err != nil {
-			logx.Errorf("扫描列信息失败: %v", err)
-			return nil, fmt.Errorf("扫描列信息失败: %v", err)
+	// 3. 构建C表字段及对比字段
+	if err = m.initFields(); err != nil {
+		return nil, err
+	}
+	m.infof("%s", FormatFieldPlan(m.fieldPlan()))
+	if err = m.checkSurrogateKey(); err != nil {
+		return nil, err
+	}
+
+	// 4. 读取A表数据（ConsistentRead 时A、B表在同一快照中读取）
+	srcA, srcB, err := m.beginConsistentRead()
+	if err != nil {
+		return nil, err
+	}
+	defer m.endConsistentRead()
+	m.infof("[信息] 正在读取A表(%s)数据...\n", m.config.TableA)
+	dataA, err := m.readTable(srcA, m.config.TableA, m.readFields(m.fieldNamesA))
+	if err != nil {
+		return nil, err
+	}
+	dataA = m.filterRows("A", dataA)
+	if err = m.checkEmptyKeys("A", dataA); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalA = len(dataA) })
+	m.metricObserve(MetricRowsReadA, float64(len(dataA)))
+	m.infof("[信息] A表共 %d 条记录\n", m.stats.TotalA)
+
+	// 5. 读取B表数据（DiskIndexB 时写入磁盘索引；IndexB 可用时直接复用）
+	bIndex := m.cachedIndexB()
+	if bIndex == nil {
+		m.infof("[信息] 正在读取B表(%s)数据...\n", m.config.TableB)
+		fieldsB := m.neededFieldsB()
+		if len(fieldsB) < len(m.fieldNamesB) {
+			m.infof("[信息] B表只读取需要的 %d/%d 个字段\n", len(fieldsB), len(m.fieldNamesB))
+		}
+		if bIndex, err = m.readIndexB(srcB, m.config.TableB, m.readFields(fieldsB)); err != nil {
+			return nil, err
+		}
+		defer bIndex.close()
+	}
+	if m.modifiedWindow() {
+		extraA, extraB, err := m.completeWindow(srcA, srcB, dataA, bIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.checkEmptyKeys("A", extraA); err != nil {
+			return nil, err
+		}
+		if err = m.checkEmptyKeys("B", extraB); err != nil {
+			return nil, err
+		}
+		dataA = append(dataA, extraA...)
+		m.setStats(func(s *MergeStats) { s.TotalA = len(dataA) })
+		m.applyDerivedFields("B", extraB)
+		bIndex = &unionIndex{base: bIndex, extra: m.newMemIndex(extraB)}
+	}
+	m.endConsistentRead()
+	m.setStats(func(s *MergeStats) { s.TotalB = bIndex.len() })
+	m.metricObserve(MetricRowsReadB, float64(bIndex.len()))
+	m.infof("[信息] B表共 %d 条记录\n", m.stats.TotalB)
+
+	// 变更事件模式：只生成变更事件，不合并
+	if m.config.ChangeEvents {
+		return nil, m.buildChanges(dataA, bIndex)
+	}
+
+	// 读取墓碑表
+	if err = m.loadTombstones(); err != nil {
+		return nil, err
+	}
+
+	// 6. 对比并合并（冲突超过上限时中止，不改动C表）
+	return m.mergeIndexed(dataA, bIndex)
+}
+
+// Summarize 只统计分类数量（完全相同/仅在A/仅在B/冲突），不构建合并行、不询问用户、不改动C表，
+// 比 Run 开销小得多；分类规则与 Run 相同（含墓碑表、派生字段和 ShouldCompare），但不受 MatchMode 影响
+func (m *Merger) Summarize() (*MergeStats, error) {
+	m.setStats(func(s *MergeStats) { *s = MergeStats{StartTime: time.Now()} })
+	err := m.checkAllowedTables()
+	if err != nil {
+		return nil, err
+	}
+	if err = m.connect(); err != nil {
+		return nil, err
+	}
+	defer m.closeDB()
+	if err = m.loadColumns(); err != nil {
+		return nil, err
+	}
+	if err = m.initFields(); err != nil {
+		return nil, err
+	}
+	srcA, srcB, err := m.beginConsistentRead()
+	if err != nil {
+		return nil, err
+	}
+	defer m.endConsistentRead()
+	dataA, err := m.readTable(srcA, m.config.TableA, m.fieldNamesA)
+	if err != nil {
+		return nil, err
+	}
+	dataB, err := m.readTable(srcB, m.config.TableB, m.neededFieldsB())
+	if err != nil {
+		return nil, err
+	}
+	dataA, dataB = m.filterRows("A", dataA), m.filterRows("B", dataB)
+	if m.modifiedWindow() {
+		extraA, extraB, err := m.completeWindow(srcA, srcB, dataA, m.newMemIndex(dataB))
+		if err != nil {
+			return nil, err
+		}
+		dataA, dataB = append(dataA, extraA...), append(dataB, extraB...)
+	}
+	m.endConsistentRead()
+	if err = m.loadTombstones(); err != nil {
+		return nil, err
+	}
+	if err = m.checkEmptyKeys("A", dataA); err != nil {
+		return nil, err
+	}
+	if err = m.checkEmptyKeys("B", dataB); err != nil {
+		return nil, err
+	}
+	m.setStats(func(s *MergeStats) { s.TotalA, s.TotalB = len(dataA), len(dataB) })
+	m.classifyRows(dataA, dataB)
+	m.setStats(func(s *MergeStats) { s.EndTime = time.Now() })
+	return &m.stats, nil
+}
+
+// classifyRows 按关键字段对A、B表记录分类计数，不构建合并行
+func (m *Merger) classifyRows(dataA, dataB []rowData) {
+	m.zeroMatched.Store(0)
+	defer m.setStats(func(s *MergeStats) { s.LeadingZeroMatched = int(m.zeroMatched.Load()) })
+	m.applyDerivedFields("A", dataA)
+	m.applyDerivedFields("B", dataB)
+	bIndex := make(map[string]*rowData)
+	for i := range dataB {
+		if key, excluded := m.rowKey(&dataB[i]); !excluded {
+			bIndex[key] = &dataB[i]
+		}
+	}
+	bMatched := make(map[string]bool)
+	for i := range dataA {
+		rowA := &dataA[i]
+		keyA, excluded := m.rowKey(rowA)
+		if excluded {
+			m.incStat(&m.stats.OnlyInA)
+			continue
 		}
-		// 排除自增主键id
-		if strings.ToLower(col.Name) == "id" && strings.Contains(strings.ToLower(col.Extra), "auto_increment") {
+		if m.tombstones[keyA] {
+			m.incStat(&m.stats.Tombstoned)
+			if !m.config.TombstoneMark {
+				bMatched[keyA] = true
+				continue
+			}
+		}
+		rowB, ok := bIndex[keyA]
+		if !ok {
+			m.incStat(&m.stats.OnlyInA)
+			continue
+		}
+		bMatched[keyA] = true
+		switch {
+		case m.config.ShouldCompare != nil && !m.config.ShouldCompare(keyA, Row(rowA.Values), Row(rowB.Values)):
+			m.incStat(&m.stats.Uncompared)
+		case len(m.diffFields(m.compareFields, rowA, rowB)) == 0:
+			m.incStat(&m.stats.ExactMatch)
+		default:
+			m.incStat(&m.stats.Conflict)
+			m.metricInc(MetricConflicts)
+		}
+	}
+	for i := range dataB {
+		key, excluded := m.rowKey(&dataB[i])
+		if excluded {
+			m.incStat(&m.stats.OnlyInB)
 			continue
 		}
-		// 构建完整列定义
-		col.FullDefinition = m.buildColumnDef(col)
-		columns = append(columns, col)
+		if bMatched[key] {
+			continue
+		}
+		if m.tombstones[key] {
+			m.incStat(&m.stats.Tombstoned)
+			if !m.config.TombstoneMark {
+				continue
+			}
+		}
+		m.incStat(&m.stats.OnlyInB)
+	}
+}
+
+// ErrTableCCollision C表与A表或B表是同一个库中的同名表（不区分大小写），重建C表会删除源表
+var ErrTableCCollision = errors.New("C表与源表同名")
+
+// Validate 检查配置：C表不能与A、B表是同一个库中的同名表，读写的各表名须满足 AllowedTablePrefix 和 AllowedTables 限制，
+// 追加模式下的 RowHash 须按关键字段匹配并以 REPLACE INTO 更新变化的行
+func (m *Merger) Validate() error {
+	schemaC := m.config.TableCSchema
+	if schemaC == "" {
+		schemaC = m.dsnSchema(firstNonEmpty(m.config.DSNC, m.config.WriteDSN))
+	}
+	sources := []struct{ schema, table string }{
+		{m.dsnSchema(firstNonEmpty(m.config.DSNA, m.config.ReadDSN)), m.config.TableA},
+		{m.dsnSchema(firstNonEmpty(m.config.DSNB, m.config.ReadDSN)), m.config.TableB},
+	}
+	for _, t := range sources {
+		if strings.EqualFold(m.config.TableC, t.table) && strings.EqualFold(schemaC, t.schema) {
+			name := t.table
+			if t.schema != "" {
+				name = t.schema + "." + t.table
+			}
+			logx.Errorf("%v: %s", ErrTableCCollision, name)
+			return fmt.Errorf("%w: %s", ErrTableCCollision, name)
+		}
+	}
+	if m.config.RowHash && m.config.AppendMode {
+		if len(m.config.KeyFields) == 0 {
+			logx.Errorf("追加模式下的 RowHash 需要配置 KeyFields")
+			return fmt.Errorf("追加模式下的 RowHash 需要配置 KeyFields")
+		}
+		if m.config.InsertMode != ReplaceInto {
+			logx.Errorf("追加模式下的 RowHash 需要 InsertMode=ReplaceInto，否则内容变化的记录会重复写入C表")
+			return fmt.Errorf("追加模式下的 RowHash 需要 InsertMode=ReplaceInto，否则内容变化的记录会重复写入C表")
+		}
+	}
+	return m.checkAllowedTables()
+}
+
+// checkAllowedTables 检查会读写的各表名是否满足 AllowedTablePrefix 和 AllowedTables 限制
+func (m *Merger) checkAllowedTables() error {
+	allowed := make(map[string]bool)
+	for _, t := range m.config.AllowedTables {
+		allowed[t] = true
+	}
+	for _, t := range m.configuredTables() {
+		if m.config.AllowedTablePrefix != "" && !strings.HasPrefix(t, m.config.AllowedTablePrefix) {
+			logx.Errorf("表%s不以允许的前缀%s开头", t, m.config.AllowedTablePrefix)
+			return fmt.Errorf("表%s不以允许的前缀%s开头", t, m.config.AllowedTablePrefix)
+		}
+		if len(allowed) > 0 && !allowed[t] {
+			logx.Errorf("表%s不在允许操作的表名单中", t)
+			return fmt.Errorf("表%s不在允许操作的表名单中", t)
+		}
+	}
+	return nil
+}
+
+// configuredTables 返回配置中会读取或写入的表名（未配置的跳过）：A、B、C表、墓碑表、统计表、拒绝表，
+// 以及 ChangelogMode 下的变更日志表（含默认的 C表名_changelog）
+func (m *Merger) configuredTables() []string {
+	names := []string{m.config.TableA, m.config.TableB, m.config.TableC,
+		m.config.TombstoneTable, m.config.StatsTable, m.config.RejectTable}
+	if m.config.ChangelogMode {
+		names = append(names, m.changelogTable())
+	}
+	var tables []string
+	for _, t := range names {
+		if t != "" {
+			tables = append(tables, t)
+		}
+	}
+	return tables
+}
+
+// connect 分别连接A、B、C表所在的数据库并检查连通性，相同DSN共用一个连接
+func (m *Merger) connect() error {
+	m.conns = make(map[string]*sql.DB)
+	var err error
+	if m.dbA, err = m.openDB(firstNonEmpty(m.config.DSNA, m.config.ReadDSN)); err != nil {
+		m.closeDB()
+		return err
+	}
+	if m.dbB, err = m.openDB(firstNonEmpty(m.config.DSNB, m.config.ReadDSN)); err != nil {
+		m.closeDB()
+		return err
+	}
+	if m.db, err = m.openDB(firstNonEmpty(m.config.DSNC, m.config.WriteDSN)); err != nil {
+		m.closeDB()
+		return err
+	}
+	m.infof("[信息] 数据库连接成功\n")
+	return nil
+}
+
+// sqlDriverName 打开数据库连接使用的 database/sql 驱动名
+var sqlDriverName = "mysql"
+
+// openDB 打开指定DSN（为空时使用默认DSN）的数据库连接，已打开的DSN直接复用
+func (m *Merger) openDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		var err error
+		if dsn, err = m.dsn(); err != nil {
+			logx.Errorf("组装DSN失败: %v", err)
+			return nil, err
+		}
+	}
+	if db, ok := m.conns[dsn]; ok {
+		return db, nil
+	}
+	db, err := sql.Open(sqlDriverName, dsn)
+	if err != nil {
+		logx.Errorf("连接数据库失败: %v", err)
+		return nil, fmt.Errorf("连接数据库失败: %v", err)
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		logx.Errorf("数据库Ping失败: %v", err)
+		return nil, fmt.Errorf("数据库Ping失败: %v", err)
+	}
+	m.conns[dsn] = db
+	return db, nil
+}
+
+// closeDB 关闭所有已打开的数据库连接
+func (m *Merger) closeDB() {
+	for _, db := range m.conns {
+		db.Close()
+	}
+	m.conns = nil
+}
+
+// loadColumns 获取A表和B表的列信息（各自从所在的数据库读取）
+func (m *Merger) loadColumns() error {
+	var err error
+	m.columnsA, err = m.getColumns(m.dbA, m.config.TableA)
+	if err != nil {
+		return err
+	}
+	m.columnsB, err = m.getColumns(m.dbB, m.config.TableB)
+	return err
+}
+
+// FieldPlan 连接数据库读取A、B表结构，返回每个字段在合并中的角色，不读取或写入任何数据
+func (m *Merger) FieldPlan() ([]FieldRole, error) {
+	if err := m.checkAllowedTables(); err != nil {
+		return nil, err
+	}
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	defer m.closeDB()
+	if err := m.loadColumns(); err != nil {
+		return nil, err
+	}
+	if err := m.initFields(); err != nil {
+		return nil, err
+	}
+	return m.fieldPlan(), nil
+}
+
+// fieldPlan 根据已构建的字段信息生成字段角色列表：先按C表字段顺序，再追加仅在B表中的字段
+func (m *Merger) fieldPlan() []FieldRole {
+	keySet := make(map[string]bool)
+	for _, k := range m.config.KeyFields {
+		keySet[k] = true
+	}
+	inA := make(map[string]bool)
+	for _, f := range m.fieldNamesA {
+		inA[f] = true
+	}
+	inB := make(map[string]bool)
+	for _, f := range m.fieldNamesB {
+		inB[f] = true
+	}
+
+	var plan []FieldRole
+	for _, f := range m.fieldNamesC {
+		role := FieldRole{Name: f, InA: inA[f], InB: inB[f]}
+		switch {
+		case keySet[f]:
+			role.Kind = RoleKey
+		case m.ignoreSetA[f]:
+			role.Kind = RoleIgnored
+		case m.ignoreSetB[f]:
+			role.Kind = RoleDropped
+		case !inB[f]:
+			role.Kind = RoleAOnly
+		default:
+			role.Kind = RoleCompared
+		}
+		plan = append(plan, role)
+	}
+	for _, f := range m.fieldNamesA {
+		if m.hiddenSet[f] {
+			plan = append(plan, FieldRole{Name: f, Kind: RoleCompareOnly, InA: true, InB: inB[f]})
+		}
+	}
+	for _, f := range m.fieldNamesB {
+		if !m.hasFieldC(f) && !(m.hiddenSet[f] && inA[f]) {
+			plan = append(plan, FieldRole{Name: f, Kind: RoleBOnly, InB: true})
+		}
+	}
+	return plan
+}
+
+// dropHiddenFieldsC 从C表字段中移除 CompareButNotOutputFields（须在构建对比字段之后调用，使其仍参与对比）
+func (m *Merger) dropHiddenFieldsC(keySet map[string]bool) error {
+	if len(m.hiddenSet) == 0 {
+		return nil
+	}
+	for f := range m.hiddenSet {
+		if m.config.NoSurrogateKey && keySet[f] {
+			logx.Errorf("关键字段%s作为C表主键，不能配置为不写入C表", f)
+			return fmt.Errorf("关键字段%s作为C表主键，不能配置为不写入C表", f)
+		}
+	}
+	columns := m.columnsC[:0]
+	for _, c := range m.columnsC {
+		if !m.hiddenSet[c.Name] {
+			columns = append(columns, c)
+		}
+	}
+	m.columnsC = columns
+	m.fieldNamesC = nil
+	for _, c := range m.columnsC {
+		m.fieldNamesC = append(m.fieldNamesC, c.Name)
+	}
+	for f := range m.hiddenSet {
+		delete(m.bFieldInC, f)
+	}
+	return nil
+}
+
+// dsn 返回默认数据库连接字符串：优先使用 DSN，为空时由 Conn 组装
+func (m *Merger) dsn() (string, error) {
+	if m.config.DSN != "" {
+		return m.config.DSN, nil
+	}
+	if m.config.Conn == nil {
+		return "", fmt.Errorf("未配置DSN或Conn连接参数")
+	}
+	return m.config.Conn.FormatDSN()
+}
+
+// dsnSchema 返回 dsn（为空时为默认DSN）连接的默认数据库名，无法解析时返回空字符串
+func (m *Merger) dsnSchema(dsn string) string {
+	if dsn == "" {
+		dsn, _ = m.dsn()
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return ""
+	}
+	return cfg.DBName
+}
+
+// printConfig 打印关键字段、忽略字段和冲突策略等配置
+func (m *Merger) printConfig() {
+	m.infof("[配置] 关键字段: %v\n", strings.Join(m.config.KeyFields, ","))
+	if len(m.config.IgnoreFieldsA) > 0 {
+		m.infof("[配置] A表忽略对比字段: %v\n", strings.Join(m.config.IgnoreFieldsA, ","))
+	}
+	if len(m.config.IgnoreFieldsB) > 0 {
+		m.infof("[配置] B表忽略字段: %v\n", strings.Join(m.config.IgnoreFieldsB, ","))
+	}
+	var names []string
+	for _, s := range m.strategies() {
+		names = append(names, strategyNames[s])
+	}
+	m.infof("[配置] 冲突策略: %s\n", strings.Join(names, " -> "))
+	if m.autoMigrateC() && !m.config.AppendMode {
+		m.infof("[警告] AutoMigrateC/AutoAddColumns 需同时开启 AppendMode，本次不生效\n")
+	}
+	if m.config.Resume && m.config.DecisionLog == "" {
+		m.infof("[警告] 开启了 Resume 但未配置 DecisionLog，本次不生效\n")
+	}
+	if m.config.ReadChunkSize > 0 {
+		m.infof("[配置] 分页读取A、B表: 每页 %d 条\n", m.config.ReadChunkSize)
+	}
+	if m.config.SkipUnchangedVsC && (!m.config.RowHash || !m.config.AppendMode) {
+		m.infof("[警告] SkipUnchangedVsC 需同时开启 RowHash 和 AppendMode，本次不生效\n")
+	}
+	if m.config.ConflictSemantics == ManualOnly {
+		m.infof("[配置] _conflict 仅标记需按策略决定的差异，全部自动解决的记录为 0\n")
+	}
+	if m.config.InsertMode == ReplaceInto {
+		m.infof("[配置] 写入方式: REPLACE INTO\n")
+		if !m.config.NoSurrogateKey {
+			m.infof("[警告] 未开启 NoSurrogateKey，C表需自行建立按关键字段的唯一索引，否则 REPLACE INTO 不会替换已有行\n")
+		}
+	}
+}
+
+// initFields 根据A、B表的列信息构建字段名列表、C表字段和用于对比的字段
+func (m *Merger) initFields() error {
+	// 重置字段名列表
+	m.fieldNamesA = nil
+	m.fieldNamesB = nil
+	m.fieldNamesC = nil
+	m.compareFields = nil
+	m.bFieldInC = make(map[string]bool)
+	m.shadowSet = make(map[string]bool)
+	m.binarySet = make(map[string]bool)
+	m.boolSet = make(map[string]bool)
+	m.collateSet = make(map[string]bool)
+	for _, f := range m.config.CollationFields {
+		m.collateSet[f] = true
+	}
+
+	for _, c := range m.columnsA {
+		m.fieldNamesA = append(m.fieldNamesA, c.Name)
+	}
+	for _, c := range m.columnsB {
+		m.fieldNamesB = append(m.fieldNamesB, c.Name)
+	}
+	for _, c := range append(m.columnsA, m.columnsB...) {
+		if isBinaryType(c.DataType) {
+			m.binarySet[c.Name] = true
+		}
+		if isBoolType(c.ColumnType) {
+			m.boolSet[c.Name] = true
+		}
+		if m.config.CollationCompare && isTextType(c.DataType) {
+			m.collateSet[c.Name] = true
+		}
+	}
+
+	// C表字段以A表为准
+	m.columnsC = make([]ColumnInfo, len(m.columnsA))
+	copy(m.columnsC, m.columnsA)
+	if err := m.orderColumnsC(); err != nil {
+		return err
+	}
+	for _, c := range m.columnsC {
+		m.fieldNamesC = append(m.fieldNamesC, c.Name)
+	}
+
+	// 构建B表字段集合，判断B表字段是否在C表中
+	bFieldSet := make(map[string]bool)
+	for _, f := range m.fieldNamesB {
+		bFieldSet[f] = true
+	}
+	for _, d := range m.config.DerivedFields {
+		if (d.Side != "A" && d.Side != "B") || d.Compute == nil || d.Field == "" {
+			logx.Errorf("派生字段%s配置无效：Side 须为 A 或 B 且 Compute 不能为空", d.Field)
+			return fmt.Errorf("派生字段%s配置无效：Side 须为 A 或 B 且 Compute 不能为空", d.Field)
+		}
+		if d.Side == "B" {
+			bFieldSet[d.Field] = true
+		}
+	}
+	for _, f := range m.fieldNamesC {
+		if bFieldSet[f] {
+			m.bFieldInC[f] = true
+		}
+	}
+
+	// 构建用于对比的字段列表：C表字段中排除关键字段和A表忽略字段
+	keySet := make(map[string]bool)
+	for _, k := range m.config.KeyFields {
+		keySet[k] = true
+	}
+	for _, f := range m.fieldNamesC {
+		if !keySet[f] && !m.ignoreSetA[f] {
+			m.compareFields = append(m.compareFields, f)
+		}
+	}
+	if err := m.dropHiddenFieldsC(keySet); err != nil {
+		return err
+	}
+	m.checkTypeMismatches(keySet)
+
+	m.infof("[信息] A表字段(%d): %v\n", len(m.fieldNamesA), strings.Join(m.fieldNamesA, ","))
+	m.infof("[信息] B表字段(%d): %v\n", len(m.fieldNamesB), strings.Join(m.fieldNamesB, ","))
+	m.infof("[信息] C表字段(%d): %v\n", len(m.fieldNamesC), strings.Join(m.fieldNamesC, ","))
+	m.infof("[信息] 用于对比的字段(%d): %v\n", len(m.compareFields), strings.Join(m.compareFields, ","))
+
+	// 检查附加列名是否与C表字段或元数据字段冲突
+	for name := range m.config.ExtraColumns {
+		if m.hasFieldC(name) || metaColumnDefs[name].colType != "" || name == m.config.SurrogateKeyName {
+			logx.Errorf("附加列%s与C表已有字段重名", name)
+			return fmt.Errorf("附加列%s与C表已有字段重名", name)
+		}
+	}
+
+	// 检查影子列名是否与C表已有字段冲突
+	if suffix := m.config.KeepBValuesColumnSuffix; suffix != "" {
+		for _, f := range m.compareFields {
+			if m.hasFieldC(f+suffix) || f+suffix == m.config.SurrogateKeyName {
+				logx.Errorf("影子列%s与C表已有字段重名", f+suffix)
+				return fmt.Errorf("影子列%s与C表已有字段重名", f+suffix)
+			}
+		}
+	}
+	return nil
+}
+
+// orderColumnsC 按 ColumnOrder 调整C表字段顺序，写入时的字段顺序与之一致
+func (m *Merger) orderColumnsC() error {
+	rank := make(map[string]int)
+	switch m.config.ColumnOrder {
+	case SourceA:
+		return nil
+	case KeysFirst:
+		for i, k := range m.config.KeyFields {
+			rank[k] = i - len(m.config.KeyFields) - 1 // 关键字段按配置顺序排在最前
+		}
+		for _, col := range m.columnsC {
+			if _, ok := rank[col.Name]; !ok && m.ignoreSetA[col.Name] {
+				rank[col.Name] = 1 // 仅写入不对比的字段
+			}
+		}
+	case CustomOrder:
+		names := make(map[string]bool)
+		for _, col := range m.columnsC {
+			names[col.Name] = true
+		}
+		for i, f := range m.config.CustomColumnOrder {
+			if !names[f] {
+				logx.Errorf("CustomColumnOrder 中的字段%s不在C表字段中", f)
+				return fmt.Errorf("CustomColumnOrder 中的字段%s不在C表字段中", f)
+			}
+			rank[f] = i - len(m.config.CustomColumnOrder) - 1
+		}
+	}
+	sort.SliceStable(m.columnsC, func(i, j int) bool {
+		return rank[m.columnsC[i].Name] < rank[m.columnsC[j].Name]
+	})
+	return nil
+}
+
+// hasFieldC 判断C表中是否已有该字段
+func (m *Merger) hasFieldC(name string) bool {
+	for _, f := range m.fieldNamesC {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSurrogateKey 检查代理主键名是否与源表字段或元数据字段冲突
+func (m *Merger) checkSurrogateKey() error {
+	if m.config.NoSurrogateKey {
+		if len(m.config.KeyFields) == 0 {
+			logx.Errorf("NoSurrogateKey 需要配置 KeyFields 作为C表主键")
+			return fmt.Errorf("NoSurrogateKey 需要配置 KeyFields 作为C表主键")
+		}
+		for _, k := range m.config.KeyFields {
+			if !m.hasFieldC(k) {
+				logx.Errorf("关键字段%s不在C表字段中，无法作为C表主键", k)
+				return fmt.Errorf("关键字段%s不在C表字段中，无法作为C表主键", k)
+			}
+		}
+		return nil
+	}
+	surrogate := m.config.SurrogateKeyName
+	for _, f := range m.metaFields() {
+		if f == surrogate {
+			logx.Errorf("代理主键名%s与元数据字段重名", surrogate)
+			return fmt.Errorf("代理主键名%s与元数据字段重名", surrogate)
+		}
+	}
+	if m.hasFieldC(surrogate) {
+		logx.Errorf("代理主键名%s与源表字段重名，请通过 SurrogateKeyName 指定其他名称", surrogate)
+		return fmt.Errorf("代理主键名%s与源表字段重名，请通过 SurrogateKeyName 指定其他名称", surrogate)
+	}
+	return nil
+}
+
+// checkKeysNotNull 关键字段作为C表主键时，检查结果行的关键字段都不为NULL
+func (m *Merger) checkKeysNotNull(rows []rowData) error {
+	nullCount := 0
+	for _, row := range rows {
+		for _, k := range m.config.KeyFields {
+			if row.Values[k] == nil {
+				nullCount++
+				break
+			}
+		}
+	}
+	if nullCount > 0 {
+		logx.Errorf("%d 条记录的关键字段为NULL，无法以关键字段作为C表主键", nullCount)
+		return fmt.Errorf("%d 条记录的关键字段为NULL，无法以关键字段作为C表主键", nullCount)
+	}
+	return nil
+}
+
+// loadTombstones 读取墓碑表中的关键字段，构建已删除的key集合
+func (m *Merger) loadTombstones() error {
+	m.tombstones = make(map[string]bool)
+	if m.config.TombstoneTable == "" {
+		return nil
+	}
+	if len(m.config.KeyFields) == 0 {
+		logx.Errorf("使用墓碑表时必须配置 KeyFields")
+		return fmt.Errorf("使用墓碑表时必须配置 KeyFields")
+	}
+	m.infof("[信息] 正在读取墓碑表(%s)...\n", m.config.TombstoneTable)
+	rows, err := m.readTable(m.dbA, m.config.TombstoneTable, m.config.KeyFields)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		if key, excluded := m.rowKey(&rows[i]); !excluded {
+			m.tombstones[key] = true
+		}
+	}
+	m.infof("[信息] 墓碑表共 %d 个key\n", len(m.tombstones))
+	return nil
+}
+
+// applyDerivedFields 为指定一侧的每一行计算派生字段
+func (m *Merger) applyDerivedFields(side string, rows []rowData) {
+	for _, d := range m.config.DerivedFields {
+		if d.Side != side {
+			continue
+		}
+		for i := range rows {
+			rows[i].Values[d.Field] = d.Compute(Row(rows[i].Values))
+		}
+	}
+}
+
+// sortRows 按关键字段稳定排序（NULL 排在最前）；使用 KeyFunc 时按其计算的key排序
+func (m *Merger) sortRows(rows []rowData) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		if m.config.KeyFunc != nil {
+			return m.buildKey(&rows[i]) < m.buildKey(&rows[j])
+		}
+		for _, kf := range m.config.KeyFields {
+			a, b := rows[i].Values[kf], rows[j].Values[kf]
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return true
+			case b == nil:
+				return false
+			case *a != *b:
+				return *a < *b
+			}
+		}
+		return false
+	})
+}
+
+// checkEnumValues 检查C表 ENUM/SET 列的值是否在列定义的取值范围内（不区分大小写），
+// 违规值计入统计并打印；StrictEnum 时返回错误，不写入C表
+func (m *Merger) checkEnumValues(rows []rowData) error {
+	allowed := make(map[string]map[string]bool)
+	isSet := make(map[string]bool)
+	for _, col := range m.columnsC {
+		colType := m.mapColumnType(col)
+		lower := strings.ToLower(colType)
+		if !strings.HasPrefix(lower, "enum(") && !strings.HasPrefix(lower, "set(") {
+			continue
+		}
+		values := make(map[string]bool)
+		for _, v := range parseEnumValues(colType) {
+			values[strings.ToLower(v)] = true
+		}
+		allowed[col.Name] = values
+		isSet[col.Name] = strings.HasPrefix(lower, "set(")
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	var examples []string
+	for _, row := range rows {
+		for field, values := range allowed {
+			v := row.Values[field]
+			if v == nil || enumValueAllowed(*v, values, isSet[field]) {
+				continue
+			}
+			m.incStat(&m.stats.EnumViolations)
+			if len(examples) < 10 {
+				examples = append(examples, fmt.Sprintf("%s=%q(key=%s)", field, *v, m.buildKey(&row)))
+			}
+		}
+	}
+	if m.stats.EnumViolations == 0 {
+		return nil
+	}
+	m.infof("[警告] %d 个值不在ENUM/SET列的取值范围内，例如: %s\n", m.stats.EnumViolations, strings.Join(examples, ", "))
+	if m.config.StrictEnum {
+		logx.Errorf("%d 个值不在ENUM/SET列的取值范围内", m.stats.EnumViolations)
+		return fmt.Errorf("%d 个值不在ENUM/SET列的取值范围内，例如: %s", m.stats.EnumViolations, strings.Join(examples, ", "))
+	}
+	return nil
+}
+
+// neededFieldsB 返回读取B表时实际需要的字段（按B表字段顺序）：关键字段、对比字段、写入C表的字段，以及
+// 策略和引用检查用到的字段；B表中既不参与对比也不写入C表的列（如B表独有的列、B表忽略字段）不再读取，以节省内存。
+// 配置了可访问整行的回调（KeyFunc、FilterB、ShouldCompare、ConflictResolver、B表派生字段）或 ChangeEvents 时读取全部字段
+func (m *Merger) neededFieldsB() []string {
+	if m.config.KeyFunc != nil || m.config.FilterB != nil || m.config.ShouldCompare != nil ||
+		m.config.ConflictResolver != nil || m.config.ChangeEvents {
+		return m.fieldNamesB
+	}
+	for _, d := range m.config.DerivedFields {
+		if d.Side == "B" {
+			return m.fieldNamesB
+		}
+	}
+	need := make(map[string]bool)
+	for _, k := range m.config.KeyFields {
+		need[k] = true
+	}
+	for _, f := range m.compareFields {
+		if !m.ignoreSetB[f] {
+			need[f] = true
+		}
+	}
+	for f := range m.bFieldInC {
+		if !m.ignoreSetB[f] {
+			need[f] = true
+		}
+	}
+	for _, f := range []string{m.config.VersionField, m.config.TimestampField} {
+		if f != "" {
+			need[f] = true
+		}
+	}
+	for _, rc := range m.config.ReferenceChecks {
+		need[rc.RefField] = true
+	}
+	var fields []string
+	for _, f := range m.fieldNamesB {
+		if need[f] {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// readFields 返回读取A/B表时的字段列表：TraceSourceIDs 时额外读取主键列（即使它已被排除出对比）
+func (m *Merger) readFields(fieldNames []string) []string {
+	if !m.config.TraceSourceIDs {
+		return fieldNames
+	}
+	for _, f := range fieldNames {
+		if f == m.config.SourceIDField {
+			return fieldNames
+		}
+	}
+	return append(append([]string{}, fieldNames...), m.config.SourceIDField)
+}
+
+// traceSourceIDs 在C表行中记录产生它的A、B表记录主键，rowA 或 rowB 为 nil 表示该侧没有记录
+func (m *Merger) traceSourceIDs(row, rowA, rowB *rowData) {
+	if !m.config.TraceSourceIDs {
+		return
+	}
+	row.Values["_src_id_a"] = nil
+	row.Values["_src_id_b"] = nil
+	if rowA != nil {
+		row.Values["_src_id_a"] = copyStringPtr(rowA.Values[m.config.SourceIDField])
+	}
+	if rowB != nil {
+		row.Values["_src_id_b"] = copyStringPtr(rowB.Values[m.config.SourceIDField])
+	}
+}
+
+// mergeRows 按关键字段对比A、B两组数据并生成C表行，不涉及任何数据库操作
+func (m *Merger) mergeRows(dataA, dataB []rowData) ([]rowData, error) {
+	// 计算派生字段（可用于关键字段和对比字段），并建立B表内存索引
+	m.applyDerivedFields("B", dataB)
+	return m.mergeIndexed(dataA, m.newMemIndex(dataB))
+}
+
+// mergeIndexed 按关键字段将A表数据与B表索引对比合并，返回写入C表的结果行
+func (m *Merger) mergeIndexed(dataA []rowData, bIndex rowIndex) ([]rowData, error) {
+	m.zeroMatched.Store(0)
+	defer m.setStats(func(s *MergeStats) { s.LeadingZeroMatched = int(m.zeroMatched.Load()) })
+	m.applyDerivedFields("A", dataA)
+
+	// 对比并合并
+	m.infof("[信息] 开始数据对比与合并...\n")
+	var resultRows []rowData
+	bMatched := make(map[string]bool) // 记录B表中已匹配的key
+
+	m.pending = nil
+	m.conflicts = nil
+	m.resolverErr = nil
+	if err := m.checkReferences(dataA, bIndex); err != nil {
+		return nil, err
+	}
+	if err := m.openDecisionLog(); err != nil {
+		return nil, err
+	}
+	defer m.closeDecisionLog()
+
+	// 多协程时先并行找出差异字段（只读），再串行合并，保证统计、输出和交互顺序与串行一致
+	var diffs []rowDiff
+	if m.config.Workers > 1 && m.config.MatchMode != LeftOnly && m.config.MatchMode != RightOnly {
+		var err error
+		if diffs, err = m.parallelDiffs(dataA, bIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range dataA {
+		if m.stopped.Load() {
+			break
+		}
+		rowA := &dataA[i]
+		keyA, excluded := m.rowKey(rowA)
+
+		// 墓碑表中的key：默认不写入C表（B表中相同key的记录一并排除），TombstoneMark 时照常处理并标记
+		if !excluded && m.tombstones[keyA] {
+			m.incStat(&m.stats.Tombstoned)
+			if !m.config.TombstoneMark {
+				bMatched[keyA] = true
+				continue
+			}
+		}
+
+		var rowB *rowData
+		var ok bool
+		if !excluded {
+			var err error
+			if rowB, ok, err = bIndex.get(keyA); err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			// 在B表中找到了相同关键字段的记录
+			bMatched[keyA] = true
+			if m.config.MatchMode == LeftOnly || m.config.MatchMode == RightOnly {
+				continue
+			}
+			var merged *rowData
+			pendingCount := len(m.pending)
+			var uncompared bool
+			if diffs != nil {
+				uncompared = diffs[i].uncompared // 并行对比时已调用过 ShouldCompare
+			} else if m.config.ShouldCompare != nil {
+				uncompared = !m.config.ShouldCompare(keyA, Row(rowA.Values), Row(rowB.Values))
+			}
+			if uncompared {
+				// 不参与对比：原样写入A表记录，不计入冲突
+				m.incStat(&m.stats.Uncompared)
+				merged = m.buildCRowFromAWithMeta(rowA, "SKIP", false, "")
+			} else if diffs != nil {
+				merged = m.mergeDiffs(rowA, rowB, keyA, diffs[i].fields)
+			} else {
+				merged = m.compareAndMerge(rowA, rowB, keyA)
+			}
+			m.traceSourceIDs(merged, rowA, rowB)
+			if len(m.pending) > pendingCount {
+				// 延后决定的冲突，待统一询问后再处理
+				m.pending[pendingCount].index = len(resultRows)
+				resultRows = append(resultRows, *merged)
+			} else {
+				resultRows = append(resultRows, *m.finishRow(merged))
+			}
+			if m.resolverErr != nil {
+				return nil, m.resolverErr
+			}
+			if err := m.checkConflictLimit(len(dataA)); err != nil {
+				return nil, err
+			}
+		} else {
+			// 仅在A表中
+			m.incStat(&m.stats.OnlyInA)
+			if m.config.MatchMode == FullOuter || m.config.MatchMode == LeftOnly {
+				row := m.buildCRowFromAWithMeta(rowA, "A", false, "")
+				m.traceSourceIDs(row, rowA, nil)
+				resultRows = append(resultRows, *m.finishRow(row))
+			}
+		}
+	}
+
+	// 处理仅在B表中的数据
+	err := bIndex.each(func(key string, rowB *rowData) bool {
+		if m.stopped.Load() {
+			return false
+		}
+		if !isExcludedKey(key) {
+			if bMatched[key] {
+				return true
+			}
+			if m.tombstones[key] {
+				m.incStat(&m.stats.Tombstoned)
+				if !m.config.TombstoneMark {
+					return true
+				}
+			}
+		}
+		m.incStat(&m.stats.OnlyInB)
+		if m.config.MatchMode == FullOuter || m.config.MatchMode == RightOnly {
+			row := m.buildCRowFromB(rowB)
+			m.traceSourceIDs(row, nil, rowB)
+			resultRows = append(resultRows, *m.finishRow(row))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Deferred 模式下统一询问收集到的冲突
+	resultRows = m.resolvePending(resultRows)
+
+	if m.config.SortResults {
+		m.sortRows(resultRows)
+	}
+
+	// 检查 ENUM/SET 列的取值（来自B表的值可能不在A表定义的取值范围内）
+	if err := m.checkEnumValues(resultRows); err != nil {
+		return nil, err
+	}
+
+	if m.stopped.Load() {
+		m.setStats(func(s *MergeStats) { s.Stopped = true })
+		m.infof("[终止] 任务已被终止，仅写入已处理的 %d 条记录\n", len(resultRows))
+	}
+	return resultRows, nil
+}
+
+// checkConflictLimit 检查当前冲突数是否超过 MaxConflicts 或 MaxConflictPct（相对A表记录数 totalA）
+func (m *Merger) checkConflictLimit(totalA int) error {
+	if m.config.MaxConflicts > 0 && m.stats.Conflict > m.config.MaxConflicts {
+		logx.Errorf("冲突数 %d 超过上限 %d，任务中止", m.stats.Conflict, m.config.MaxConflicts)
+		return fmt.Errorf("冲突数 %d 超过上限 %d，任务中止", m.stats.Conflict, m.config.MaxConflicts)
+	}
+	if m.config.MaxConflictPct > 0 && totalA > 0 {
+		pct := float64(m.stats.Conflict) * 100 / float64(totalA)
+		if pct > m.config.MaxConflictPct {
+			logx.Errorf("冲突占比 %.2f%% 超过上限 %.2f%%，任务中止", pct, m.config.MaxConflictPct)
+			return fmt.Errorf("冲突占比 %.2f%% 超过上限 %.2f%%，任务中止", pct, m.config.MaxConflictPct)
+		}
+	}
+	return nil
+}
+
+// SelfTest 自检：检查数据库连通性、A/B表的读取权限以及C表所在库的建表/删表权限，不执行合并；
+// 返回的错误指明未通过的检查项
+func (m *Merger) SelfTest() error {
+	if err := m.checkAllowedTables(); err != nil {
+		return err
+	}
+	if err := m.connect(); err != nil {
+		return err
+	}
+	defer m.closeDB()
+
+	checks := []struct {
+		name string
+		fn   func() error
+	}{
+		{fmt.Sprintf("读取A表(%s)结构", m.config.TableA), func() (err error) {
+			m.columnsA, err = m.getColumns(m.dbA, m.config.TableA)
+			return err
+		}},
+		{fmt.Sprintf("读取B表(%s)结构", m.config.TableB), func() (err error) {
+			m.columnsB, err = m.getColumns(m.dbB, m.config.TableB)
+			return err
+		}},
+		{fmt.Sprintf("查询A表(%s)数据", m.config.TableA), func() error {
+			return selectOne(m.runCtx(), m.dbA, m.config.TableA)
+		}},
+		{fmt.Sprintf("查询B表(%s)数据", m.config.TableB), func() error {
+			return selectOne(m.runCtx(), m.dbB, m.config.TableB)
+		}},
+		{"在C表所在库创建并删除临时表", m.createDropProbeTable},
+	}
+	for _, c := range checks {
+		if err := c.fn(); err != nil {
+			m.infof("[自检] %s: 失败\n", c.name)
+			logx.Errorf("自检未通过[%s]: %v", c.name, err)
+			return fmt.Errorf("自检未通过[%s]: %v", c.name, err)
+		}
+		m.infof("[自检] %s: 通过\n", c.name)
+	}
+	return nil
+}
+
+// selectOne 查询表中的一行，用于检查 SELECT 权限
+func selectOne(ctx context.Context, db *sql.DB, tableName string) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT * FROM `%s` LIMIT 1", tableName))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return rows.Err()
+}
+
+// createDropProbeTable 在C表所在库中创建并删除一个临时表，用于检查 CREATE/DROP 权限
+func (m *Merger) createDropProbeTable() error {
+	name := fmt.Sprintf("`_reconciler_selftest_%d`", time.Now().UnixNano())
+	if m.config.TableCSchema != "" {
+		name = fmt.Sprintf("`%s`.%s", m.config.TableCSchema, name)
+	}
+	if _, err := m.db.ExecContext(m.runCtx(), fmt.Sprintf("CREATE TABLE %s (`id` INT NOT NULL)", name)); err != nil {
+		return fmt.Errorf("创建临时表失败: %v", err)
+	}
+	if _, err := m.db.ExecContext(m.runCtx(), fmt.Sprintf("DROP TABLE %s", name)); err != nil {
+		return fmt.Errorf("删除临时表%s失败: %v", name, err)
+	}
+	return nil
+}
+
+// estimateSampleRows 预估内存时每张表抽样的行数
+const estimateSampleRows = 1000
+
+// fieldOverheadBytes 每个字段值在 map[string]*string 中的额外开销（map槽位、字符串头、指针）的近似值
+const fieldOverheadBytes = 64
+
+// EstimateMemory 在不执行合并的情况下预估内存峰值：统计A、B表记录数，
+// 并按抽样行的平均大小推算；合并时A、B两表数据和C表结果行同时驻留内存
+func (m *Merger) EstimateMemory() (EstimateResult, error) {
+	result := EstimateResult{Limit: m.config.MemoryLimit}
+	if result.Limit <= 0 {
+		result.Limit = 1 << 30
+	}
+	if err := m.checkAllowedTables(); err != nil {
+		return result, err
+	}
+	if err := m.connect(); err != nil {
+		return result, err
+	}
+	defer m.closeDB()
+	if err := m.loadColumns(); err != nil {
+		return result, err
+	}
+	if err := m.initFields(); err != nil {
+		return result, err
+	}
+
+	var err error
+	if result.RowsA, err = countTable(m.runCtx(), m.dbA, m.config.TableA); err != nil {
+		return result, err
+	}
+	if result.RowsB, err = countTable(m.runCtx(), m.dbB, m.config.TableB); err != nil {
+		return result, err
+	}
+	if result.AvgRowBytesA, err = m.sampleRowBytes(m.dbA, m.config.TableA, m.fieldNamesA); err != nil {
+		return result, err
+	}
+	if result.AvgRowBytesB, err = m.sampleRowBytes(m.dbB, m.config.TableB, m.fieldNamesB); err != nil {
+		return result, err
+	}
+
+	result.EstimatedBytes = estimatePeakBytes(result.RowsA, result.RowsB, result.AvgRowBytesA, result.AvgRowBytesB)
+	result.ExceedsLimit = result.EstimatedBytes > result.Limit
+	m.infof("%s", result.String())
+	return result, nil
+}
+
+// estimatePeakBytes 按行数和平均行大小推算内存峰值：A、B两表数据加上C表结果行
+// （C表行数最多为A、B之和，行大小按两表较大者计）
+func estimatePeakBytes(rowsA, rowsB int, avgA, avgB int64) int64 {
+	avgC := avgA
+	if avgB > avgC {
+		avgC = avgB
+	}
+	return int64(rowsA)*avgA + int64(rowsB)*avgB + int64(rowsA+rowsB)*avgC
+}
+
+// sampleRowBytes 抽样读取表中的数据，返回每行的平均内存占用
+func (m *Merger) sampleRowBytes(db *sql.DB, tableName string, fieldNames []string) (int64, error) {
+	rows, err := m.readTableLimit(db, tableName, fieldNames, estimateSampleRows)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	var total int64
+	for _, row := range rows {
+		for name, v := range row.Values {
+			total += int64(len(name)) + fieldOverheadBytes
+			if v != nil {
+				total += int64(len(*v))
+			}
+		}
+	}
+	return total / int64(len(rows)), nil
+}
+
+// countTable 查询表的记录数
+func countTable(ctx context.Context, db *sql.DB, tableName string) (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM `%s`", tableName)
+	if err := db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		logx.Errorf("查询表%s记录数失败: %v", tableName, err)
+		return 0, fmt.Errorf("查询表%s记录数失败: %v", tableName, err)
+	}
+	return count, nil
+}
+
+// Stats 返回当前统计信息的副本，可在合并进行中从其他协程调用以查看进度
+func (m *Merger) Stats() MergeStats {
+	m.statsMu.Lock()
+	defer m.statsMu.Unlock()
+	return m.stats
+}
+
+// setStats 在锁保护下修改统计信息
+func (m *Merger) setStats(fn func(s *MergeStats)) {
+	m.statsMu.Lock()
+	fn(&m.stats)
+	m.statsMu.Unlock()
+}
+
+// incStat 在锁保护下将 m.stats 中的某个计数加一
+func (m *Merger) incStat(counter *int) {
+	m.statsMu.Lock()
+	*counter++
+	m.statsMu.Unlock()
+}
+
+// Stop 请求终止合并：Run 在处理完当前记录后停止对比，
+// 将已处理的记录写入C表并返回，统计信息中 Stopped 为 true
+func (m *Merger) Stop() {
+	m.stopped.Store(true)
+}
+
+// Columns 返回 Run 或 FieldPlan 过程中获取的列信息，table 为配置中的A、B、C表名；
+// C表列不含自增代理主键、元数据字段和影子列。未运行或表名不匹配时返回 nil
+func (m *Merger) Columns(table string) []ColumnInfo {
+	var cols []ColumnInfo
+	switch table {
+	case m.config.TableA:
+		cols = m.columnsA
+	case m.config.TableB:
+		cols = m.columnsB
+	case m.config.TableC:
+		cols = m.columnsC
+	default:
+		return nil
+	}
+	return append([]ColumnInfo(nil), cols...)
+}
+
+// getColumns 获取表的列信息（排除自增列及 ExcludeColumns 中的列）
+func (m *Merger) getColumns(db *sql.DB, tableName string) ([]ColumnInfo, error) {
+	query := `
+		SELECT 
+			COLUMN_NAME, ORDINAL_POSITION, COLUMN_DEFAULT, IS_NULLABLE,
+			DATA_TYPE, COLUMN_TYPE, EXTRA
+		FROM INFORMATION_SCHEMA.COLUMNS 
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`
+	rows, err := db.QueryContext(m.runCtx(), query, tableName)
+	if err != nil {
+		logx.Errorf("查询表%s列信息失败: %v", tableName, err)
+		return nil, fmt.Errorf("查询表%s列信息失败: %v", tableName, err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var col ColumnInfo
+		if err := rows.Scan(&col.Name, &col.OrdinalPosition, &col.ColumnDefault,
+			&col.IsNullable, &col.DataType, &col.ColumnType, &col.Extra); err != nil {
+			logx.Errorf("扫描列信息失败: %v", err)
+			return nil, fmt.Errorf("扫描列信息失败: %v", err)
+		}
+		if m.isExcludedColumn(col) {
+			continue
+		}
+		// 构建完整列定义
+		col.FullDefinition = m.buildColumnDef(col)
+		columns = append(columns, col)
+	}
+	if err = rows.Err(); err != nil {
+		logx.Errorf("遍历列信息出错: %v", err)
+		return nil, fmt.Errorf("遍历列信息出错: %v", err)
+	}
+	if len(columns) == 0 {
+		logx.Errorf("表%s没有找到列（或表不存在）", tableName)
+		return nil, fmt.Errorf("表%s没有找到列（或表不存在）", tableName)
+	}
+	return columns, nil
+}
+
+// isExcludedColumn 判断列是否应被排除：自增列、ExcludeColumns 中的列，以及开启 ExcludeIDByName 时名为 id 的列
+func (m *Merger) isExcludedColumn(col ColumnInfo) bool {
+	if strings.Contains(strings.ToLower(col.Extra), "auto_increment") {
+		return true
+	}
+	if m.config.ExcludeIDByName && strings.EqualFold(col.Name, "id") {
+		return true
+	}
+	for _, name := range m.config.ExcludeColumns {
+		if strings.EqualFold(col.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildColumnDef 构建列的DDL定义（C表中所有字段都允许NULL）
+func (m *Merger) buildColumnDef(col ColumnInfo) string {
+	colType := m.mapColumnType(col)
+	def := fmt.Sprintf("`%s` %s", col.Name, colType)
+	// C表中所有字段都允许为空（因为B表写入时可能缺少字段）
+	def += " NULL " + columnDefaultClause(col)
+	// 源列的 ON UPDATE CURRENT_TIMESTAMP（EXTRA中）照样复制：它只在 UPDATE 未给该列赋值时生效，
+	// 写入C表时总是显式给出合并结果中的值，不会被改写为当前时间；TypeMap 映射为非时间类型时不复制
+	if onUpdate := onUpdateClause(col.Extra); onUpdate != "" && isTemporalType(colType) {
+		def += " " + onUpdate
+	}
+	return def
+}
+
+// onUpdateClause 从列的 EXTRA 中取出 ON UPDATE 子句（如 "ON UPDATE CURRENT_TIMESTAMP(3)"），没有时返回空字符串
+func onUpdateClause(extra string) string {
+	const prefix = "on update "
+	i := strings.Index(strings.ToLower(extra), prefix)
+	if i < 0 {
+		return ""
+	}
+	return "ON UPDATE " + strings.TrimSpace(extra[i+len(prefix):])
+}
+
+// isTemporalType 判断列类型是否为可带 ON UPDATE 的 TIMESTAMP 或 DATETIME
+func isTemporalType(columnType string) bool {
+	t := strings.ToLower(columnType)
+	return strings.HasPrefix(t, "timestamp") || strings.HasPrefix(t, "datetime")
+}
+
+// columnDefaultClause 返回列的 DEFAULT 子句：表达式默认值（CURRENT_TIMESTAMP，或 EXTRA 含 DEFAULT_GENERATED）
+// 不加引号，其余按字符串字面量处理
+func columnDefaultClause(col ColumnInfo) string {
+	if !col.ColumnDefault.Valid {
+		return "DEFAULT NULL"
+	}
+	v := col.ColumnDefault.String
+	if isCurrentTimestamp(v) {
+		return "DEFAULT " + v
+	}
+	if strings.Contains(strings.ToUpper(col.Extra), "DEFAULT_GENERATED") {
+		// MySQL 8.0.13+ 的表达式默认值，建表时须用括号包裹
+		return fmt.Sprintf("DEFAULT (%s)", v)
+	}
+	// 字面量默认值中的单引号和反斜杠需转义
+	return fmt.Sprintf("DEFAULT '%s'", strings.NewReplacer(`\`, `\\`, "'", "''").Replace(v))
+}
+
+// isCurrentTimestamp 判断列默认值是否为 CURRENT_TIMESTAMP（含精度，如 CURRENT_TIMESTAMP(3)）
+func isCurrentTimestamp(v string) bool {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	return v == "CURRENT_TIMESTAMP" || strings.HasPrefix(v, "CURRENT_TIMESTAMP(")
+}
+
+// mapColumnType 按 TypeMap 返回C表中使用的列类型
+func (m *Merger) mapColumnType(col ColumnInfo) string {
+	for src, dst := range m.config.TypeMap {
+		if strings.EqualFold(src, col.ColumnType) {
+			return dst
+		}
+	}
+	for src, dst := range m.config.TypeMap {
+		if strings.EqualFold(src, col.DataType) {
+			return dst
+		}
+	}
+	return col.ColumnType
+}
+
+// recreateTableC 重新创建C表
+func (m *Merger) recreateTableC() error {
+	tableType, err := m.tableTypeC()
+	if err != nil {
+		return err
+	}
+	if tableType == "VIEW" && !m.config.DropViewC {
+		logx.Errorf("C表%s已作为视图存在", m.config.TableC)
+		return fmt.Errorf("C表%s已作为视图存在，请更换 TableC 或开启 DropViewC 删除该视图", m.config.TableC)
+	}
+	dropSQL := m.dropStatementC(tableType)
+	if m.config.DropRewriter != nil {
+		dropSQL = m.config.DropRewriter(dropSQL)
+	}
+	if _, err = m.db.ExecContext(m.runCtx(), dropSQL); err != nil {
+		logx.Errorf("删除C表失败: %v", err)
+		return fmt.Errorf("删除C表失败: %v", err)
+	}
+	if err = m.createTableC(); err != nil {
+		return err
+	}
+	m.infof("[信息] C表(%s)已重新创建\n", m.config.TableC)
+	return nil
+}
+
+// prepareTableC 准备C表：默认删除重建；追加模式下保留已存在的C表，按需补充缺失的列
+func (m *Merger) prepareTableC() error {
+	if !m.config.AppendMode {
+		return m.recreateTableC()
+	}
+	existing, err := m.existingColumns(m.config.TableCSchema, m.config.TableC)
+	if err != nil {
+		return err
+	}
+	if len(existing) == 0 {
+		if err = m.createTableC(); err != nil {
+			return err
+		}
+		m.infof("[信息] C表(%s)不存在，已创建\n", m.config.TableC)
+		return nil
+	}
+	m.existingColsC = existing
+
+	missing, missingDefs := m.missingColumnsC(existing)
+	if len(missing) == 0 {
+		m.infof("[信息] C表(%s)已存在，追加写入\n", m.config.TableC)
+		return nil
+	}
+	if !m.autoMigrateC() {
+		logx.Errorf("C表%s缺少字段: %s", m.config.TableC, strings.Join(missing, ","))
+		return fmt.Errorf("C表%s缺少字段: %s（可开启 AutoMigrateC 自动补充）", m.config.TableC, strings.Join(missing, ","))
+	}
+	for _, f := range missing {
+		alterSQL := m.addColumnSQLC(missingDefs[f])
+		if _, err = m.db.ExecContext(m.runCtx(), alterSQL); err != nil {
+			logx.Errorf("C表补充字段%s失败: %v\nSQL: %s", f, err, alterSQL)
+			return fmt.Errorf("C表补充字段%s失败: %v", f, err)
+		}
+		m.existingColsC[f] = true
+		m.infof("[信息] C表已补充字段%s，已执行: %s\n", f, alterSQL)
+	}
+	m.infof("[信息] C表(%s)已存在，补充 %d 个字段后追加写入\n", m.config.TableC, len(missing))
+	return nil
+}
+
+// autoMigrateC 是否开启了 AutoMigrateC 或 AutoAddColumns
+func (m *Merger) autoMigrateC() bool {
+	return m.config.AutoMigrateC || m.config.AutoAddColumns
+}
+
+// missingColumnsC 按C表字段、元数据字段的顺序找出已存在的C表中缺失的列及其定义；
+// 源列补充为可NULL且默认NULL，已有记录的新列为NULL
+func (m *Merger) missingColumnsC(existing map[string]bool) ([]string, map[string]string) {
+	var missing []string
+	missingDefs := make(map[string]string)
+	for _, col := range m.columnsC {
+		if !existing[col.Name] {
+			missing = append(missing, col.Name)
+			missingDefs[col.Name] = fmt.Sprintf("`%s` %s NULL DEFAULT NULL", col.Name, m.mapColumnType(col))
+		}
+	}
+	for _, f := range m.metaFields() {
+		if !existing[f] {
+			missing = append(missing, f)
+			missingDefs[f] = m.metaColumnDef(f)
+		}
+	}
+	return missing, missingDefs
+}
+
+// addColumnSQLC 生成为C表补充一列的语句
+func (m *Merger) addColumnSQLC(def string) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", m.qualifiedTableC(), def)
+}
+
+// GenerateAlignmentDDL 连接数据库读取A、B表结构和已存在的C表，返回使C表与当前A/B表结构对齐所需的语句，
+// 只生成不执行：C表已存在时按C表字段顺序返回补充缺失列的 ALTER TABLE 语句（只增不删，与 AutoMigrateC 相同），
+// C表不存在时返回建表语句；影子列取决于合并中出现的冲突，不包含在内
+func (m *Merger) GenerateAlignmentDDL() ([]string, error) {
+	if err := m.checkAllowedTables(); err != nil {
+		return nil, err
+	}
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	defer m.closeDB()
+	if err := m.loadColumns(); err != nil {
+		return nil, err
+	}
+	if err := m.initFields(); err != nil {
+		return nil, err
+	}
+	existing, err := m.existingColumns(m.config.TableCSchema, m.config.TableC)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return []string{m.createTableSQLC()}, nil
+	}
+	missing, missingDefs := m.missingColumnsC(existing)
+	ddl := make([]string, 0, len(missing))
+	for _, f := range missing {
+		ddl = append(ddl, m.addColumnSQLC(missingDefs[f]))
+	}
+	return ddl, nil
+}
+
+// tableTypeC 查询C表名对应对象的类型：BASE TABLE、VIEW，不存在时返回空字符串
+func (m *Merger) tableTypeC() (string, error) {
+	query := `SELECT TABLE_TYPE FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?`
+	var tableType string
+	err := m.db.QueryRowContext(m.runCtx(), query, m.config.TableCSchema, m.config.TableC).Scan(&tableType)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		logx.Errorf("查询C表类型失败: %v", err)
+		return "", fmt.Errorf("查询C表类型失败: %v", err)
+	}
+	return tableType, nil
+}
+
+// dropStatementC 按C表名对应对象的类型生成删除语句：视图使用 DROP VIEW，其余使用 DROP TABLE
+func (m *Merger) dropStatementC(tableType string) string {
+	if tableType == "VIEW" {
+		return fmt.Sprintf("DROP VIEW IF EXISTS %s", m.qualifiedTableC())
+	}
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s", m.qualifiedTableC())
+}
+
+// existingColumns 查询表中已有的列名（schema 为空时使用默认数据库），表不存在时返回空集合
+func (m *Merger) existingColumns(schema, tableName string) (map[string]bool, error) {
+	query := `SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ?`
+	rows, err := m.db.QueryContext(m.runCtx(), query, schema, tableName)
+	if err != nil {
+		logx.Errorf("查询表%s列信息失败: %v", tableName, err)
+		return nil, fmt.Errorf("查询表%s列信息失败: %v", tableName, err)
+	}
+	defer rows.Close()
+
+	cols := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logx.Errorf("扫描列信息失败: %v", err)
+			return nil, fmt.Errorf("扫描列信息失败: %v", err)
+		}
+		cols[name] = true
+	}
+	if err = rows.Err(); err != nil {
+		logx.Errorf("遍历列信息出错: %v", err)
+		return nil, fmt.Errorf("遍历列信息出错: %v", err)
+	}
+	return cols, nil
+}
+
+// qualifiedTableC 返回SQL中引用C表的名称，配置了 TableCSchema 时带上库名
+func (m *Merger) qualifiedTableC() string {
+	if m.config.TableCSchema != "" {
+		return fmt.Sprintf("`%s`.`%s`", m.config.TableCSchema, m.config.TableC)
+	}
+	return fmt.Sprintf("`%s`", m.config.TableC)
+}
+
+// metaColumnDef 返回元数据字段的DDL定义
+func (m *Merger) metaColumnDef(field string) string {
+	col, ok := metaColumnDefs[field]
+	if !ok {
+		col = metaColumn{"VARCHAR(255)", "NULL", "附加列"}
+	}
+	return fmt.Sprintf("`%s` %s NULL DEFAULT %s COMMENT '%s'", field, m.metaColumnType(field), col.defaultValue, col.comment)
+}
+
+// metaColumnType 返回元数据列的类型：优先使用配置的类型，未配置时使用默认类型
+func (m *Merger) metaColumnType(field string) string {
+	if t := m.config.MetaColumnTypes[field]; t != "" {
+		return t
+	}
+	if field == "_diff_fields" && m.config.DiffFieldsColumnType != "" {
+		return m.config.DiffFieldsColumnType
+	}
+	if col, ok := metaColumnDefs[field]; ok {
+		return col.colType
+	}
+	return "VARCHAR(255)"
+}
+
+// checkMetaCapacity 检查元数据列（_diff_fields、_autofill、_resolution）的值是否超出列类型的容量，
+// 超出时返回错误，避免写入时被数据库截断或报错
+func (m *Merger) checkMetaCapacity(rows []rowData) error {
+	for _, field := range []string{"_diff_fields", "_autofill", "_resolution"} {
+		colType := m.metaColumnType(field)
+		limit, inBytes := textCapacity(colType)
+		if limit <= 0 {
+			continue
+		}
+		for i := range rows {
+			v := rows[i].Values[field]
+			if v == nil {
+				continue
+			}
+			n := len(*v)
+			if !inBytes {
+				n = utf8.RuneCountInString(*v)
+			}
+			if n > limit {
+				logx.Errorf("C表列%s的值长度%d超过类型%s的容量%d(key=%s)", field, n, colType, limit, m.buildKey(&rows[i]))
+				return fmt.Errorf("C表列%s的值长度%d超过类型%s的容量%d(key=%s)，请通过 MetaColumnTypes 使用更大的类型（如 MEDIUMTEXT）",
+					field, n, colType, limit, m.buildKey(&rows[i]))
+			}
+		}
+	}
+	return nil
+}
+
+// textCapacity 返回文本类型的容量：TEXT 系列按字节，CHAR/VARCHAR 按字符；无法确定或不受限（如 JSON）时返回 0。
+// 类型后的字符集等属性（如 TEXT CHARACTER SET utf8mb4）不影响结果
+func textCapacity(colType string) (limit int, inBytes bool) {
+	t := strings.ToLower(colType)
+	if f := strings.Fields(t); len(f) > 0 {
+		t = f[0]
+	}
+	switch t {
+	case "tinytext":
+		return 255, true
+	case "text":
+		return 65535, true
+	case "mediumtext":
+		return 16777215, true
+	}
+	for _, prefix := range []string{"varchar(", "char("} {
+		if strings.HasPrefix(t, prefix) && strings.HasSuffix(t, ")") {
+			if n, err := strconv.Atoi(t[len(prefix) : len(t)-1]); err == nil {
+				return n, false
+			}
+		}
+	}
+	return 0, false
+}
+
+// createTableC 按C表字段和元数据字段创建C表
+func (m *Merger) createTableC() error {
+	createSQL := m.createTableSQLC()
+	if _, err := m.db.ExecContext(m.runCtx(), createSQL); err != nil {
+		logx.Errorf("创建C表失败: %v\nSQL: %s", err, createSQL)
+		return fmt.Errorf("创建C表失败: %v", err)
+	}
+	for i, stmt := range m.config.PostCreateSQL {
+		if _, err := m.db.ExecContext(m.runCtx(), stmt); err != nil {
+			logx.Errorf("执行C表创建后的第%d条语句失败: %v\nSQL: %s", i+1, err, stmt)
+			return fmt.Errorf("执行C表创建后的第%d条语句失败: %v（SQL: %s）", i+1, err, stmt)
+		}
+	}
+	if len(m.config.PostCreateSQL) > 0 {
+		m.infof("[信息] C表创建后已执行 %d 条语句\n", len(m.config.PostCreateSQL))
+	}
+	m.existingColsC = make(map[string]bool)
+	for _, col := range m.columnsC {
+		m.existingColsC[col.Name] = true
+	}
+	for _, f := range m.metaFields() {
+		m.existingColsC[f] = true
+	}
+	for _, col := range m.shadowColumns() {
+		m.existingColsC[col.Name] = true
+	}
+	return nil
+}
+
+// createTableSQLC 生成C表的建表语句（已经过 DDLRewriter）
+func (m *Merger) createTableSQLC() string {
+	var colDefs []string
+	keySet := make(map[string]bool)
+	if m.config.NoSurrogateKey {
+		for _, k := range m.config.KeyFields {
+			keySet[k] = true
+		}
+	} else {
+		colDefs = append(colDefs, fmt.Sprintf("`%s` INT NOT NULL AUTO_INCREMENT PRIMARY KEY", m.config.SurrogateKeyName))
+	}
+	for _, col := range m.columnsC {
+		if keySet[col.Name] {
+			// 关键字段作为主键，必须为 NOT NULL
+			colDefs = append(colDefs, fmt.Sprintf("`%s` %s NOT NULL", col.Name, m.mapColumnType(col)))
+			continue
+		}
+		colDefs = append(colDefs, col.FullDefinition)
+	}
+	// 添加来源标记字段和冲突标记字段
+	for _, f := range m.metaFields() {
+		colDefs = append(colDefs, m.metaColumnDef(f))
+	}
+	// 添加保留B表原值的影子列
+	for _, col := range m.shadowColumns() {
+		colDefs = append(colDefs, col.FullDefinition)
+	}
+	if m.config.NoSurrogateKey {
+		quotedKeys := make([]string, len(m.config.KeyFields))
+		for i, k := range m.config.KeyFields {
+			quotedKeys[i] = fmt.Sprintf("`%s`", k)
+		}
+		colDefs = append(colDefs, fmt.Sprintf("PRIMARY KEY (%s)", strings.Join(quotedKeys, ", ")))
+	}
+
+	createSQL := fmt.Sprintf("CREATE TABLE %s (\n  %s\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		m.qualifiedTableC(), strings.Join(colDefs, ",\n  "))
+	if m.config.DDLRewriter != nil {
+		createSQL = m.config.DDLRewriter(createSQL)
+	}
+	return createSQL
+}
+
+// sourceWhere 根据 KeyRange、KeyFilter 和 ModifiedSince 生成读取A、B表时的参数化 WHERE 子句，均未配置时返回空字符串；
+// window 为 false 时不加 ModifiedSince 条件
+func (m *Merger) sourceWhere(window bool) (string, []interface{}, error) {
+	var conds []string
+	var args []interface{}
+	if r := m.config.KeyRange; r != nil {
+		if r.Field == "" || strings.Contains(r.Field, "`") {
+			logx.Errorf("KeyRange 字段名%q无效", r.Field)
+			return "", nil, fmt.Errorf("KeyRange 字段名%q无效", r.Field)
+		}
+		if r.Min != "" {
+			conds = append(conds, fmt.Sprintf("`%s` >= ?", r.Field))
+			args = append(args, r.Min)
+		}
+		if r.Max != "" {
+			conds = append(conds, fmt.Sprintf("`%s` <= ?", r.Field))
+			args = append(args, r.Max)
+		}
+	}
+	if len(m.config.KeyFilter) > 0 {
+		var tuples []string
+		for _, tuple := range m.config.KeyFilter {
+			fields := make([]string, 0, len(tuple))
+			for f := range tuple {
+				fields = append(fields, f)
+			}
+			sort.Strings(fields)
+			var parts []string
+			for _, f := range fields {
+				if f == "" || strings.Contains(f, "`") {
+					logx.Errorf("KeyFilter 字段名%q无效", f)
+					return "", nil, fmt.Errorf("KeyFilter 字段名%q无效", f)
+				}
+				parts = append(parts, fmt.Sprintf("`%s` = ?", f))
+				args = append(args, tuple[f])
+			}
+			if len(parts) == 0 {
+				logx.Errorf("KeyFilter 中存在空的key")
+				return "", nil, fmt.Errorf("KeyFilter 中存在空的key")
+			}
+			tuples = append(tuples, "("+strings.Join(parts, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(tuples, " OR ")+")")
+	}
+	if window && m.modifiedWindow() {
+		if strings.Contains(m.config.ModifiedColumn, "`") {
+			logx.Errorf("ModifiedColumn 字段名%q无效", m.config.ModifiedColumn)
+			return "", nil, fmt.Errorf("ModifiedColumn 字段名%q无效", m.config.ModifiedColumn)
+		}
+		conds = append(conds, fmt.Sprintf("`%s` >= ?", m.config.ModifiedColumn))
+		args = append(args, m.config.ModifiedSince)
+	}
+	if len(conds) == 0 {
+		return "", nil, nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args, nil
+}
+
+// windowLookupBatch 增量对比按key补读另一侧记录时，每条查询包含的key数
+const windowLookupBatch = 500
+
+// completeWindow 增量对比时，为时间窗口内只在一侧出现的key按key补读另一侧的记录（不受时间窗口限制），
+// 使未修改的一侧仍能参与匹配；返回补读并经 FilterA/FilterB 过滤的A、B表记录
+func (m *Merger) completeWindow(srcA, srcB queryer, dataA []rowData, bIndex rowIndex) ([]rowData, []rowData, error) {
+	keysA := make(map[string]bool, len(dataA))
+	var missingInB []*rowData
+	for i := range dataA {
+		key, excluded := m.rowKey(&dataA[i])
+		if excluded {
+			continue // 不参与匹配，无需补读
+		}
+		keysA[key] = true
+		if _, ok, err := bIndex.get(key); err != nil {
+			return nil, nil, err
+		} else if !ok {
+			missingInB = append(missingInB, &dataA[i])
+		}
+	}
+	var missingInA []*rowData
+	err := bIndex.each(func(key string, row *rowData) bool {
+		if !isExcludedKey(key) && !keysA[key] {
+			keysA[key] = true
+			missingInA = append(missingInA, row)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	extraB, err := m.lookupByKeys(srcB, m.config.TableB, m.readFields(m.neededFieldsB()), missingInB)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraA, err := m.lookupByKeys(srcA, m.config.TableA, m.readFields(m.fieldNamesA), missingInA)
+	if err != nil {
+		return nil, nil, err
+	}
+	extraA = m.filterRows("A", extraA)
+	extraB = m.filterRows("B", extraB)
+	m.infof("[信息] 增量对比：按key补读A表 %d 条、B表 %d 条窗口外的记录\n", len(extraA), len(extraB))
+	return extraA, extraB, nil
+}
+
+// lookupByKeys 按 rows 的关键字段值分批读取表中的记录（KeyRange、KeyFilter 仍然生效，不加时间窗口）
+func (m *Merger) lookupByKeys(src queryer, tableName string, fieldNames []string, rows []*rowData) ([]rowData, error) {
+	var result []rowData
+	if len(m.config.KeyFields) == 0 {
+		return nil, nil
+	}
+	for start := 0; start < len(rows); start += windowLookupBatch {
+		end := min(start+windowLookupBatch, len(rows))
+		where, args, err := m.sourceWhere(false)
+		if err != nil {
+			return nil, err
+		}
+		keyCond, keyArgs := m.keyTupleCond(rows[start:end])
+		args = append(args, keyArgs...)
+		if where == "" {
+			where = " WHERE " + keyCond
+		} else {
+			where += " AND " + keyCond
+		}
+		err = m.scanWhere(src, tableName, fieldNames, where, args, 0, func(row rowData) error {
+			result = append(result, row)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// keyTupleCond 构建按关键字段值匹配一批记录的条件：(k1 = ? AND k2 = ?) OR ...，NULL 使用 IS NULL
+func (m *Merger) keyTupleCond(rows []*rowData) (string, []interface{}) {
+	var tuples []string
+	var args []interface{}
+	for _, row := range rows {
+		parts := make([]string, len(m.config.KeyFields))
+		for i, k := range m.config.KeyFields {
+			if v := row.Values[k]; v != nil {
+				parts[i] = fmt.Sprintf("`%s` = ?", k)
+				args = append(args, *v)
+			} else {
+				parts[i] = fmt.Sprintf("`%s` IS NULL", k)
+			}
+		}
+		tuples = append(tuples, "("+strings.Join(parts, " AND ")+")")
+	}
+	return "(" + strings.Join(tuples, " OR ") + ")", args
+}
+
+// modifiedWindow 判断是否只读取 ModifiedSince 之后修改的记录
+func (m *Merger) modifiedWindow() bool {
+	return m.config.ModifiedColumn != "" && !m.config.ModifiedSince.IsZero()
+}
+
+// readTable 读取表的所有数据
+func (m *Merger) readTable(db queryer, tableName string, fieldNames []string) ([]rowData, error) {
+	return m.readTableLimit(db, tableName, fieldNames, 0)
+}
+
+// filterRows 按 FilterA/FilterB 过滤读取的记录（原地复用切片），并累计过滤掉的记录数
+func (m *Merger) filterRows(side string, rows []rowData) []rowData {
+	filter := m.config.FilterA
+	if side == "B" {
+		filter = m.config.FilterB
+	}
+	if filter == nil {
+		return rows
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		if filter(Row(row.Values)) {
+			kept = append(kept, row)
+		}
+	}
+	m.addFiltered(side, len(rows)-len(kept))
+	return kept
+}
+
+// addFiltered 累计被过滤掉的记录数
+func (m *Merger) addFiltered(side string, n int) {
+	m.setStats(func(s *MergeStats) {
+		if side == "B" {
+			s.FilteredB += n
+		} else {
+			s.FilteredA += n
+		}
+	})
+}
+
+// queryer 执行只读查询的对象，*sql.DB 和 ConsistentRead 使用的 *sql.Conn 均满足
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// beginConsistentRead 返回读取A、B表使用的连接：未开启 ConsistentRead 时分别为 dbA、dbB；
+// 开启时在单个连接上执行 START TRANSACTION WITH CONSISTENT SNAPSHOT（REPEATABLE READ），A、B表都从该快照读取
+func (m *Merger) beginConsistentRead() (queryer, queryer, error) {
+	if !m.config.ConsistentRead {
+		return m.dbA, m.dbB, nil
+	}
+	if m.dbA != m.dbB {
+		logx.Errorf("ConsistentRead 要求A、B表使用同一数据库连接")
+		return nil, nil, fmt.Errorf("ConsistentRead 要求A、B表使用同一数据库连接（DSNA 与 DSNB 须相同），跨库无法共享快照")
+	}
+	ctx := m.runCtx()
+	conn, err := m.dbA.Conn(ctx)
+	if err != nil {
+		logx.Errorf("获取一致性读连接失败: %v", err)
+		return nil, nil, fmt.Errorf("获取一致性读连接失败: %v", err)
+	}
+	for _, stmt := range []string{
+		"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ",
+		"START TRANSACTION WITH CONSISTENT SNAPSHOT, READ ONLY",
+	} {
+		if _, err = conn.ExecContext(ctx, stmt); err != nil {
+			conn.Close()
+			logx.Errorf("开启一致性读事务失败: %v", err)
+			return nil, nil, fmt.Errorf("开启一致性读事务失败: %v", err)
+		}
+	}
+	m.snapshot = conn
+	m.infof("[信息] 已开启一致性读快照，A、B表将从同一快照读取\n")
+	return conn, conn, nil
+}
+
+// endConsistentRead 结束一致性读事务并归还连接；未开启或已结束时不做任何事
+func (m *Merger) endConsistentRead() {
+	if m.snapshot == nil {
+		return
+	}
+	// ctx 取消后仍须结束只读事务，避免带着未结束的事务把连接归还连接池
+	if _, err := m.snapshot.ExecContext(context.WithoutCancel(m.runCtx()), "COMMIT"); err != nil {
+		logx.Errorf("结束一致性读事务失败: %v", err)
+	}
+	m.snapshot.Close()
+	m.snapshot = nil
+}
+
+// readTableLimit 读取表中指定字段的数据，limit 大于0时最多读取 limit 行
+func (m *Merger) readTableLimit(db queryer, tableName string, fieldNames []string, limit int) ([]rowData, error) {
+	var result []rowData
+	err := m.scanTable(db, tableName, fieldNames, limit, func(row rowData) error {
+		result = append(result, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scanTable 逐行读取表中指定字段的数据并交给 fn 处理，limit 大于0时最多读取 limit 行
+func (m *Merger) scanTable(db queryer, tableName string, fieldNames []string, limit int, fn func(row rowData) error) error {
+	var where string
+	var args []interface{}
+	source := tableName == m.config.TableA || tableName == m.config.TableB
+	if source {
+		var err error
+		if where, args, err = m.sourceWhere(true); err != nil {
+			return err
+		}
+	}
+	if source && m.config.ReadChunkSize > 0 && limit <= 0 && len(m.config.KeyFields) > 0 {
+		return m.scanChunked(db, tableName, fieldNames, where, args, fn)
+	}
+	return m.scanWhere(db, tableName, fieldNames, where, args, limit, fn)
+}
+
+// scanChunked 按关键字段分页读取（keyset 分页）：每页按关键字段排序读取 ReadChunkSize 条，
+// 下一页从上一页最后一行的关键字段值之后开始（WHERE (k1, k2) > (?, ?)），不足一页时结束
+func (m *Merger) scanChunked(db queryer, tableName string, fieldNames []string, where string, args []interface{}, fn func(row rowData) error) error {
+	if err := m.checkChunkKeys(db, tableName, fieldNames); err != nil {
+		return err
+	}
+	quotedFields := make([]string, len(fieldNames))
+	for i, f := range fieldNames {
+		quotedFields[i] = fmt.Sprintf("`%s`", f)
+	}
+	quotedKeys := make([]string, len(m.config.KeyFields))
+	holders := make([]string, len(m.config.KeyFields))
+	for i, k := range m.config.KeyFields {
+		quotedKeys[i] = fmt.Sprintf("`%s`", k)
+		holders[i] = "?"
+	}
+	after := fmt.Sprintf("(%s) > (%s)", strings.Join(quotedKeys, ", "), strings.Join(holders, ", "))
+	chunk := m.config.ReadChunkSize
+	var last rowData
+	for {
+		cond, pageArgs := where, args
+		if last.Values != nil {
+			if cond == "" {
+				cond = " WHERE " + after
+			} else {
+				cond += " AND " + after
+			}
+			pageArgs = append([]interface{}{}, args...)
+			for _, k := range m.config.KeyFields {
+				pageArgs = append(pageArgs, *last.Values[k])
+			}
+		}
+		query := fmt.Sprintf("SELECT %s FROM `%s`%s ORDER BY %s LIMIT %d",
+			strings.Join(quotedFields, ", "), tableName, cond, strings.Join(quotedKeys, ", "), chunk)
+		n, err := m.scanQuery(db, tableName, fieldNames, query, pageArgs, func(row rowData) error {
+			last = row
+			return fn(row)
+		})
+		if err != nil {
+			return err
+		}
+		if n < chunk || m.stopped.Load() {
+			return nil
+		}
+	}
+}
+
+// checkChunkKeys 检查能否按关键字段分页读取：关键字段须都被读取且不为NULL，并且表上有列全部属于关键字段的
+// 主键或唯一索引（即关键字段唯一），否则翻页时会漏读或重复读取同key的记录
+func (m *Merger) checkChunkKeys(db queryer, tableName string, fieldNames []string) error {
+	columns := m.columnsB
+	if tableName == m.config.TableA {
+		columns = m.columnsA
+	}
+	nullable := make(map[string]string, len(columns))
+	for _, col := range columns {
+		nullable[col.Name] = col.IsNullable
+	}
+	read := make(map[string]bool, len(fieldNames))
+	for _, f := range fieldNames {
+		read[f] = true
+	}
+	keySet := make(map[string]bool, len(m.config.KeyFields))
+	for _, k := range m.config.KeyFields {
+		if !read[k] || nullable[k] != "NO" {
+			logx.Errorf("ReadChunkSize 要求表%s的关键字段%s为 NOT NULL 列", tableName, k)
+			return fmt.Errorf("ReadChunkSize 要求表%s的关键字段%s为 NOT NULL 列", tableName, k)
+		}
+		keySet[k] = true
+	}
+
+	query := `SELECT INDEX_NAME, COLUMN_NAME FROM INFORMATION_SCHEMA.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND NON_UNIQUE = 0
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX`
+	rows, err := db.QueryContext(m.runCtx(), query, tableName)
+	if err != nil {
+		logx.Errorf("查询表%s索引信息失败: %v", tableName, err)
+		return fmt.Errorf("查询表%s索引信息失败: %v", tableName, err)
+	}
+	defer rows.Close()
+	covered := make(map[string]bool) // 唯一索引名 -> 其列是否都属于关键字段
+	for rows.Next() {
+		var index, column string
+		if err = rows.Scan(&index, &column); err != nil {
+			logx.Errorf("扫描索引信息失败: %v", err)
+			return fmt.Errorf("扫描索引信息失败: %v", err)
+		}
+		if ok, seen := covered[index]; !seen || ok {
+			covered[index] = keySet[column]
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logx.Errorf("遍历索引信息出错: %v", err)
+		return fmt.Errorf("遍历索引信息出错: %v", err)
+	}
+	for _, ok := range covered {
+		if ok {
+			return nil
+		}
+	}
+	logx.Errorf("ReadChunkSize 要求表%s在关键字段上有主键或唯一索引", tableName)
+	return fmt.Errorf("ReadChunkSize 要求表%s在关键字段上有主键或唯一索引", tableName)
+}
+
+// scanWhere 按给定的 WHERE 子句逐行读取表中指定字段的数据并交给 fn 处理
+func (m *Merger) scanWhere(db queryer, tableName string, fieldNames []string, where string, args []interface{}, limit int, fn func(row rowData) error) error {
+	quotedFields := make([]string, len(fieldNames))
+	for i, f := range fieldNames {
+		quotedFields[i] = fmt.Sprintf("`%s`", f)
+	}
+	query := fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(quotedFields, ", "), tableName) + where
+	if m.config.OrderSourcesByKey && len(m.config.KeyFields) > 0 {
+		quotedKeys := make([]string, len(m.config.KeyFields))
+		for i, k := range m.config.KeyFields {
+			quotedKeys[i] = fmt.Sprintf("`%s`", k)
+		}
+		query += " ORDER BY " + strings.Join(quotedKeys, ", ")
+	}
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	_, err := m.scanQuery(db, tableName, fieldNames, query, args, fn)
+	return err
+}
+
+// scanQuery 执行查询并逐行交给 fn 处理，返回读取的行数
+func (m *Merger) scanQuery(db queryer, tableName string, fieldNames []string, query string, args []interface{}, fn func(row rowData) error) (int, error) {
+	m.debugf("[调试] SQL: %s %v\n", query, args)
+	rows, err := db.QueryContext(m.runCtx(), query, args...)
+	if err != nil {
+		logx.Errorf("查询表%s数据失败: %v", tableName, err)
+		return 0, fmt.Errorf("查询表%s数据失败: %v", tableName, err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		scanArgs := make([]interface{}, len(fieldNames))
+		nullStrings := make([]sql.NullString, len(fieldNames))
+		rawBytes := make([][]byte, len(fieldNames))
+		for i, f := range fieldNames {
+			if m.binarySet[f] {
+				scanArgs[i] = &rawBytes[i]
+			} else {
+				scanArgs[i] = &nullStrings[i]
+			}
+		}
+		if err := rows.Scan(scanArgs...); err != nil {
+			logx.Errorf("扫描数据行失败: %v", err)
+			return n, fmt.Errorf("扫描数据行失败: %v", err)
+		}
+		n++
+		rd := rowData{Values: make(map[string]*string)}
+		for i, f := range fieldNames {
+			if m.binarySet[f] {
+				// 二进制数据按字节原样保存，nil 表示 NULL
+				if rawBytes[i] != nil {
+					val := string(rawBytes[i])
+					rd.Values[f] = &val
+				} else {
+					rd.Values[f] = nil
+				}
+			} else if nullStrings[i].Valid {
+				val := nullStrings[i].String
+				rd.Values[f] = &val
+			} else {
+				rd.Values[f] = nil // NULL
+			}
+		}
+		if err = fn(rd); err != nil {
+			return n, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		logx.Errorf("遍历数据出错: %v", err)
+		return n, fmt.Errorf("遍历数据出错: %v", err)
+	}
+	return n, nil
+}
+
+// buildKey 根据关键字段构建唯一key
+func (m *Merger) buildKey(row *rowData) string {
+	key, _ := m.rowKey(row)
+	return key
+}
+
+// rowKey 根据关键字段构建key；EmptyKeyExclude 时关键字段为空的记录返回 excluded，
+// 其key带 emptyKeyPrefix 前缀（同一记录每次相同），调用方须跳过匹配
+func (m *Merger) rowKey(row *rowData) (key string, excluded bool) {
+	if m.config.KeyFunc != nil {
+		return m.config.KeyFunc(Row(row.Values)), false
+	}
+	if m.config.EmptyKeyPolicy == EmptyKeyExclude {
+		_, excluded = m.emptyKeyField(row)
+	}
+	parts := make([]string, len(m.config.KeyFields))
+	for i, kf := range m.config.KeyFields {
+		val := row.Values[kf]
+		if m.config.KeyNormalize != nil {
+			parts[i] = m.config.KeyNormalize(kf, val)
+			continue
+		}
+		if val == nil {
+			parts[i] = "\x00<NULL>\x00"
+		} else if m.config.NumericKeys {
+			parts[i] = normalizeNumeric(*val)
+		} else {
+			parts[i] = *val
+		}
+	}
+	key = strings.Join(parts, "\x01@@\x01")
+	if excluded {
+		key = emptyKeyPrefix + key
+	}
+	return key, excluded
+}
+
+// emptyKeyPrefix EmptyKeyExclude 时关键字段为空的记录的key前缀
+const emptyKeyPrefix = "\x00<EMPTY>\x00"
+
+// isExcludedKey 判断key是否属于 EmptyKeyExclude 排除的记录
+func isExcludedKey(key string) bool {
+	return strings.HasPrefix(key, emptyKeyPrefix)
+}
+
+// emptyKeyField 返回第一个值为空字符串的关键字段
+func (m *Merger) emptyKeyField(row *rowData) (string, bool) {
+	for _, kf := range m.config.KeyFields {
+		if v := row.Values[kf]; v != nil && *v == "" {
+			return kf, true
+		}
+	}
+	return "", false
+}
+
+// checkEmptyKeys EmptyKeyPolicy 为 EmptyKeyError 时，检查记录中是否有关键字段为空字符串
+func (m *Merger) checkEmptyKeys(side string, rows []rowData) error {
+	for i := range rows {
+		if err := m.checkEmptyKey(side, i+1, &rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEmptyKey 检查第 n 条记录（从1开始）的关键字段是否为空字符串
+func (m *Merger) checkEmptyKey(side string, n int, row *rowData) error {
+	if m.config.EmptyKeyPolicy != EmptyKeyError || m.config.KeyFunc != nil {
+		return nil
+	}
+	if f, empty := m.emptyKeyField(row); empty {
+		logx.Errorf("%s表第 %d 条记录的关键字段%s为空字符串", side, n, f)
+		return fmt.Errorf("%s表第 %d 条记录的关键字段%s为空字符串", side, n, f)
+	}
+	return nil
+}
+
+// rowDiff 并行对比中一条A表记录的结果
+type rowDiff struct {
+	uncompared bool     // 被 ShouldCompare 排除，不参与对比
+	fields     []string // 差异字段
+}
+
+// parallelDiffs 使用 Workers 个协程并行找出每条A表记录与匹配的B表记录的差异字段，结果按A表记录下标存放；
+// 与串行合并相同，跳过墓碑表中的key（未开启 TombstoneMark 时）和 ShouldCompare 排除的记录，
+// 未匹配或跳过的记录没有差异字段
+func (m *Merger) parallelDiffs(dataA []rowData, bIndex rowIndex) ([]rowDiff, error) {
+	diffs := make([]rowDiff, len(dataA))
+	jobs := make(chan int, m.config.Workers)
+	var (
+		wg       sync.WaitGroup
+		firstErr error
+		errOnce  sync.Once
+	)
+	for w := 0; w < m.config.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				keyA, excluded := m.rowKey(&dataA[i])
+				if excluded || m.tombstones[keyA] && !m.config.TombstoneMark {
+					continue
+				}
+				rowB, ok, err := bIndex.get(keyA)
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					continue
+				}
+				if !ok {
+					continue
+				}
+				if m.config.ShouldCompare != nil && !m.config.ShouldCompare(keyA, Row(dataA[i].Values), Row(rowB.Values)) {
+					diffs[i].uncompared = true
+					continue
+				}
+				diffs[i].fields = m.diffFields(m.compareFields, &dataA[i], rowB)
+			}
+		}()
+	}
+	for i := range dataA {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return diffs, firstErr
+}
+
+// diffFields 在给定字段中找出A、B两行值不同的字段（跳过B表忽略的字段和B表中不存在的字段）
+func (m *Merger) diffFields(fields []string, rowA, rowB *rowData) []string {
+	var diffs []string
+	for _, f := range fields {
+		// B表中忽略的字段不参与对比
+		if m.ignoreSetB[f] {
+			continue
+		}
+		valA := rowA.Values[f]
+		// B表中可能没有此字段
+		valB, bHasField := rowB.Values[f]
+		if !bHasField {
+			continue
+		}
+		if m.isSilentBackfill(f, valA, valB) {
+			continue
+		}
+		if !m.fieldEqual(f, valA, valB) {
+			diffs = append(diffs, f)
+		}
+	}
+	return diffs
+}
+
+// isSilentBackfill 判断字段是否为 SilentBackfillFields 中A为空、B有值的情况
+func (m *Merger) isSilentBackfill(field string, valA, valB *string) bool {
+	return m.silentSet[field] && m.isEmptyValue(field, valA) && !m.isEmptyValue(field, valB)
+}
+
+// silentBackfill 用B的值回填 SilentBackfillFields 中A为空的字段，有回填时返回A记录的副本
+func (m *Merger) silentBackfill(rowA, rowB *rowData) *rowData {
+	var filled *rowData
+	for f := range m.silentSet {
+		valB, ok := rowB.Values[f]
+		if !ok || !m.isSilentBackfill(f, rowA.Values[f], valB) {
+			continue
+		}
+		if filled == nil {
+			filled = &rowData{Values: make(map[string]*string, len(rowA.Values))}
+			for k, v := range rowA.Values {
+				filled.Values[k] = v
+			}
+		}
+		filled.Values[f] = copyStringPtr(valB)
+		m.incStat(&m.stats.SilentBackfilled)
+	}
+	if filled == nil {
+		return rowA
+	}
+	return filled
+}
+
+// fieldEqual 按字段的对比规则判断A、B的值是否相同
+func (m *Merger) fieldEqual(field string, valA, valB *string) bool {
+	if m.jsonSet[field] && jsonValuesEqual(valA, valB) {
+		return true
+	}
+	if m.zeroSet[field] && valA != nil && valB != nil && *valA != *valB &&
+		stripLeadingZeros(*valA) == stripLeadingZeros(*valB) {
+		m.zeroMatched.Add(1)
+		return true
+	}
+	if m.config.BooleanAwareCompare && m.boolSet[field] && valA != nil && valB != nil {
+		boolA, okA := m.parseBool(*valA)
+		boolB, okB := m.parseBool(*valB)
+		if okA && okB {
+			return boolA == boolB
+		}
+	}
+	if valA != nil && valB != nil {
+		a, b := *valA, *valB
+		if m.config.CollapseWhitespace && !m.binarySet[field] {
+			a, b = collapseWhitespace(a), collapseWhitespace(b)
+		}
+		if equal, ok := m.coercedEqual(field, a, b); ok {
+			return equal
+		}
+		if m.collateSet[field] {
+			return collationEqual(a, b)
+		}
+		return a == b
+	}
+	return valuesEqual(valA, valB)
+}
+
+// compareAndMerge 比较两行数据并合并
+func (m *Merger) compareAndMerge(rowA, rowB *rowData, key string) *rowData {
+	// 第一遍：找出所有不同的字段
+	return m.mergeDiffs(rowA, rowB, key, m.diffFields(m.compareFields, rowA, rowB))
+}
+
+// mergeDiffs 根据已找出的差异字段合并两行数据
+func (m *Merger) mergeDiffs(rowA, rowB *rowData, key string, diffFields []string) *rowData {
+	rowA = m.silentBackfill(rowA, rowB)
+	// 完全相同
+	if len(diffFields) == 0 {
+		m.incStat(&m.stats.ExactMatch)
+		return m.buildCRowFromAWithMeta(rowA, "A", false, "")
+	}
+
+	// 有差异，打印冲突信息
+	m.incStat(&m.stats.Conflict)
+	m.metricInc(MetricConflicts)
+	m.recordConflict(key, rowA, rowB, diffFields)
+	m.conflictf("\n[冲突 #%d] 关键字段 [%v] = [%s]\n", m.stats.Conflict, strings.Join(m.config.KeyFields, ","), key)
+	m.conflictf("不同的字段共 %d 个:\n\n", len(diffFields))
+	for _, f := range diffFields {
+		aVal := m.displayField(f, rowA.Values[f])
+		bVal := "<字段不存在>"
+		if v, ok := rowB.Values[f]; ok {
+			bVal = m.displayField(f, v)
+		}
+		m.conflictf("    字段[%s]: A=%-30s B=%s\n", f, aVal, bVal)
+	}
+
+	// 第二遍：构建合并行，先以A为基础
+	merged := &rowData{Values: make(map[string]*string)}
+	for _, f := range m.fieldNamesC {
+		if v, ok := rowA.Values[f]; ok {
+			merged.Values[f] = copyStringPtr(v)
+		} else {
+			merged.Values[f] = nil
+		}
+	}
+
+	// 第三遍：分类差异字段——哪些可以自动解决，哪些需要人工干预
+	var manualDiffFields []string // 两者都有值且不同，需人工决定
+	var autoFilledFields []string // A为空、自动用B值填充的字段
+	autoResolvedCount := 0
+	jsonUseB := make(map[string]*string) // JSON字段在以B为准时的合并结果
+
+	for _, f := range diffFields {
+		valA := rowA.Values[f]
+		valB, bHas := rowB.Values[f]
+		if !bHas {
+			continue
+		}
+
+		aIsEmpty := m.isEmptyValue(f, valA)
+		bIsEmpty := m.isEmptyValue(f, valB)
+
+		if m.jsonSet[f] && !aIsEmpty && !bIsEmpty {
+			if mergedA, mergedB, diffKeys, ok := mergeJSONValues(*valA, *valB); ok {
+				merged.Values[f] = strPtr(mergedA)
+				if len(diffKeys) == 0 {
+					autoResolvedCount++
+					m.conflictf("  [JSON合并] 字段[%s]: 子键无冲突, 已用B补全缺失子键\n", f)
+					continue
+				}
+				m.conflictf("  [JSON合并] 字段[%s]: 子键冲突: %s\n", f, strings.Join(diffKeys, ","))
+				jsonUseB[f] = strPtr(mergedB)
+				manualDiffFields = append(manualDiffFields, f)
+				continue
+			}
+		}
+
+		policy := m.config.AutoFillPolicy
+		if aIsEmpty && bIsEmpty && m.config.BothEmptyPrefer != BothEmptyByStrategy {
+			// A、B都为空但形式不同 => 按 BothEmptyPrefer 自动处理
+			merged.Values[f] = m.bothEmptyValue(valA, valB)
+			autoResolvedCount++
+			m.conflictf("  [都为空] 字段[%s]: A=%s B=%s, 使用: %s\n", f,
+				m.displayField(f, valA), m.displayField(f, valB), m.displayField(f, merged.Values[f]))
+		} else if aIsEmpty != bIsEmpty && policy == Never {
+			// 不自动处理空值 => 作为普通冲突根据策略决定
+			manualDiffFields = append(manualDiffFields, f)
+		} else if aIsEmpty && !bIsEmpty && policy != PreferA {
+			// A为空/NULL，B有值 => 自动用B的值
+			merged.Values[f] = copyStringPtr(valB)
+			m.incStat(&m.stats.NullAutoFilled)
+			m.metricInc(MetricAutoFilled)
+			autoResolvedCount++
+			autoFilledFields = append(autoFilledFields, f)
+			m.conflictf("  [自动填充] 字段[%s]: A为空/NULL, 自动使用B的值: %s\n", f, m.displayField(f, valB))
+		} else if aIsEmpty && !bIsEmpty {
+			// A为空/NULL，B有值，策略为PreferA => 自动保留A的空值
+			merged.Values[f] = m.keptEmptyValue(f, valA)
+			autoResolvedCount++
+			m.conflictf("  [自动保留] 字段[%s]: 优先A, 自动保留A的值: %s\n", f, m.displayField(f, valA))
+		} else if !aIsEmpty && bIsEmpty && policy == PreferB {
+			// A有值，B为空/NULL，策略为PreferB => 自动使用B的空值
+			merged.Values[f] = m.keptEmptyValue(f, valB)
+			autoResolvedCount++
+			m.conflictf("  [自动覆盖] 字段[%s]: 优先B, 自动使用B的值: %s\n", f, m.displayField(f, valB))
+		} else if !aIsEmpty && bIsEmpty {
+			// A有值，B为空/NULL => 自动保留A的值
+			autoResolvedCount++
+			m.conflictf("  [自动保留] 字段[%s]: B为空/NULL, 自动保留A的值: %s\n", f, m.displayField(f, valA))
+		} else if m.longerSet[f] && !aIsEmpty && !bIsEmpty && utf8.RuneCountInString(*valA) != utf8.RuneCountInString(*valB) {
+			// 两者都有值且不同，字段配置为较长者优先 => 不经过策略，直接采用较长的值
+			autoResolvedCount++
+			m.incStat(&m.stats.LongerWinsResolved)
+			if utf8.RuneCountInString(*valB) > utf8.RuneCountInString(*valA) {
+				merged.Values[f] = copyStringPtr(valB)
+				m.conflictf("  [较长优先] 字段[%s]: B的值较长, 使用B的值: %s\n", f, m.displayField(f, valB))
+			} else {
+				m.conflictf("  [较长优先] 字段[%s]: A的值较长, 保留A的值: %s\n", f, m.displayField(f, valA))
+			}
+		} else {
+			// 两者都有值且不同 => 需要根据策略决定
+			manualDiffFields = append(manualDiffFields, f)
+		}
+	}
+
+	// 如果所有差异都已自动解决，无需人工干预
+	if len(manualDiffFields) == 0 {
+		m.conflictf("  [结果] 所有差异已自动解决（共 %d 个自动处理）\n", autoResolvedCount)
+		diffStr := m.formatDiffFields(diffFields)
+		conflict := m.config.ConflictSemantics != ManualOnly
+		row := m.withAutoFill(m.buildCRowMerged(merged, "MERGE_A", conflict, diffStr), autoFilledFields)
+		return m.withResolution(row, rowB, diffFields, nil, "")
+	}
+
+	// 存在需要人工决定的差异字段
+	m.conflictf("\n[待决] 以下 %d 个字段两者都有值但不同，需根据策略决定:\n\n", len(manualDiffFields))
+	for _, f := range manualDiffFields {
+		m.conflictf("    字段[%s]: A=%-30s B=%s\n", f, m.displayField(f, rowA.Values[f]), m.displayField(f, rowB.Values[f]))
+	}
+
+	// 根据策略决定
+	choice := m.resolveConflict(key, manualDiffFields, rowA, rowB)
+
+	diffStr := m.formatDiffFields(diffFields)
+
+	if choice == deferChoice {
+		// 延后决定：先构建两种结果，待统一询问后再选用
+		rowUseA := m.withBValues(m.buildCRowMerged(merged, "MERGE_A", true, diffStr), rowB, manualDiffFields)
+		rowUseB := m.withBValues(m.buildCRowMerged(m.applyBValues(merged, rowB, manualDiffFields, jsonUseB), "MERGE_B", true, diffStr), rowB, manualDiffFields)
+		rowUseA = m.withResolution(rowUseA, rowB, diffFields, manualDiffFields, "A")
+		rowUseB = m.withResolution(rowUseB, rowB, diffFields, manualDiffFields, "B")
+		m.pending = append(m.pending, &pendingDecision{key: key, fields: manualDiffFields, rowA: rowA, rowB: rowB, useA: rowUseA, useB: rowUseB})
+		m.conflictf("    [延后] 该冲突将在对比完成后统一确认\n")
+		return rowUseA
+	}
+
+	if choice == UseA {
+		m.incStat(&m.stats.ConflictUseA)
+		m.printChosen(m.conflictf, manualDiffFields, rowA, rowB, UseA)
+		m.conflictf("    [结果] 以A表数据写入C表\n")
+		row := m.buildCRowMerged(merged, "MERGE_A", true, diffStr)
+		row = m.withResolution(row, rowB, diffFields, manualDiffFields, "A")
+		return m.withBValues(row, rowB, manualDiffFields)
+	}
+
+	// 以B为准：用B的值覆盖冲突字段
+	m.incStat(&m.stats.ConflictUseB)
+	m.printChosen(m.conflictf, manualDiffFields, rowA, rowB, UseB)
+	m.conflictf("  [结果] 以B表数据写入C表\n")
+	row := m.buildCRowMerged(m.applyBValues(merged, rowB, manualDiffFields, jsonUseB), "MERGE_B", true, diffStr)
+	row = m.withResolution(row, rowB, diffFields, manualDiffFields, "B")
+	return m.withBValues(row, rowB, manualDiffFields)
+}
+
+// applyBValues 用B的值覆盖合并行中的冲突字段（JSON字段使用子键合并结果）
+func (m *Merger) applyBValues(merged, rowB *rowData, fields []string, jsonUseB map[string]*string) *rowData {
+	for _, f := range fields {
+		if v, ok := jsonUseB[f]; ok {
+			merged.Values[f] = v
+			continue
+		}
+		if valB, ok := rowB.Values[f]; ok {
+			merged.Values[f] = copyStringPtr(valB)
+		}
+	}
+	return merged
+}
+
+// resolvePending Deferred 模式下统一询问收集到的冲突，并将决定应用到结果行；
+// 提前终止后剩余未询问的冲突不做决定，从结果中移除（不写入C表），计入 Undecided
+func (m *Merger) resolvePending(rows []rowData) []rowData {
+	if len(m.pending) == 0 {
+		return rows
+	}
+	fmt.Printf("\n========================================\n")
+	fmt.Printf("[待决汇总] 对比完成，共 %d 条冲突需要确认\n", len(m.pending))
+	undecided := make(map[int]bool)
+	for i, p := range m.pending {
+		if m.stopped.Load() {
+			undecided[p.index] = true
+			continue
+		}
+		fmt.Printf("\n[待决 %d/%d] 关键字段 [%v] = [%s]\n", i+1, len(m.pending), strings.Join(m.config.KeyFields, ","), p.key)
+		for _, f := range p.fields {
+			fmt.Printf("    字段[%s]: A=%-30s B=%s\n", f, m.displayField(f, p.rowA.Values[f]), m.displayField(f, p.rowB.Values[f]))
+		}
+		choice := m.askUser(p.key, p.fields, p.rowA, p.rowB)
+		if !m.stopped.Load() {
+			m.printChosen(func(format string, args ...interface{}) { fmt.Printf(format, args...) }, p.fields, p.rowA, p.rowB, choice)
+		}
+		row := p.useA
+		if choice == UseB {
+			m.incStat(&m.stats.ConflictUseB)
+			row = p.useB
+		} else {
+			m.incStat(&m.stats.ConflictUseA)
+		}
+		m.traceSourceIDs(row, p.rowA, p.rowB)
+		rows[p.index] = *m.finishRow(row)
+	}
+	m.pending = nil
+	if len(undecided) == 0 {
+		return rows
+	}
+	m.setStats(func(s *MergeStats) { s.Undecided = len(undecided) })
+	fmt.Printf("[终止] %d 条冲突尚未决定，未写入C表\n", len(undecided))
+	kept := rows[:0]
+	for i := range rows {
+		if !undecided[i] {
+			kept = append(kept, rows[i])
+		}
+	}
+	return kept
+}
+
+// printChosen 决定之后逐个字段打印A、B的值，并在采用的一方后标记 ✓
+func (m *Merger) printChosen(printf func(format string, args ...interface{}), fields []string, rowA, rowB *rowData, choice ConflictStrategy) {
+	markA, markB := " ✓", ""
+	if choice == UseB {
+		markA, markB = "", " ✓"
+	}
+	printf("    [采用] 各字段最终取值:\n")
+	for _, f := range fields {
+		printf("    字段[%s]: A=%-30s B=%s\n", f, m.displayField(f, rowA.Values[f])+markA, m.displayField(f, rowB.Values[f])+markB)
+	}
+}
+
+// conflictf 打印冲突处理过程信息，开启 QuietConflicts 或 LogLevel 低于 LogInfo 且无需询问用户时不打印
+func (m *Merger) conflictf(format string, args ...interface{}) {
+	if (m.config.QuietConflicts || !m.logEnabled(LogInfo)) && !m.asksUser() {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// asksUser 判断生效的策略中是否包含交互式询问用户
+func (m *Merger) asksUser() bool {
+	for _, s := range m.strategies() {
+		if s == AskUser {
+			return true
+		}
+	}
+	return false
+}
+
+// strategies 返回生效的策略链：配置了 StrategyChain 时使用策略链，否则仅使用 Strategy
+func (m *Merger) strategies() []ConflictStrategy {
+	if len(m.config.StrategyChain) > 0 {
+		return m.config.StrategyChain
+	}
+	return []ConflictStrategy{m.config.Strategy}
+}
+
+// resolveConflict 按策略链依次尝试，返回第一个明确的选择（UseA 或 UseB）；全部弃权时以A为准
+func (m *Merger) resolveConflict(key string, diffFields []string, rowA, rowB *rowData) ConflictStrategy {
+	m.conflictf("\n")
+	for _, s := range m.strategies() {
+		if choice, ok := m.applyStrategy(s, key, diffFields, rowA, rowB); ok {
+			return choice
+		}
+	}
+	m.conflictf("    [策略] 所有策略均未给出选择，默认以A表数据为准\n")
+	return UseA
+}
+
+// applyStrategy 执行单个策略，ok 为 false 表示该策略弃权
+func (m *Merger) applyStrategy(s ConflictStrategy, key string, diffFields []string, rowA, rowB *rowData) (ConflictStrategy, bool) {
+	switch s {
+	case UseA:
+		m.conflictf("    [策略] 配置为自动以A表数据为准\n")
+		return UseA, true
+	case UseB:
+		m.conflictf("    [策略] 配置为自动以B表数据为准\n")
+		return UseB, true
+	case AskUser:
+		if choice, ok := m.loggedDecision(key); ok {
+			return choice, true
+		}
+		if m.config.DecisionMode == Deferred {
+			return deferChoice, true
+		}
+		// 交互式询问用户
+		return m.askUser(key, diffFields, rowA, rowB), true
+	case PreferNewer:
+		f := m.config.VersionField
+		cmp, ok := compareVersion(rowA.Values[f], rowB.Values[f])
+		if !ok || cmp == 0 {
+			m.conflictf("    [策略] 版本字段[%s]相同或无法比较(A=%s B=%s)，尝试下一策略\n",
+				f, m.displayField(f, rowA.Values[f]), m.displayField(f, rowB.Values[f]))
+			return UseA, false
+		}
+		if cmp > 0 {
+			m.conflictf("    [策略] 版本字段[%s]: A较新，以A表数据为准\n", f)
+			return UseA, true
+		}
+		m.conflictf("    [策略] 版本字段[%s]: B较新，以B表数据为准\n", f)
+		return UseB, true
+	case PreferNonNull:
+		nonNullA, nonNullB := 0, 0
+		for _, f := range diffFields {
+			if !isNullOrEmpty(rowA.Values[f]) {
+				nonNullA++
+			}
+			if !isNullOrEmpty(rowB.Values[f]) {
+				nonNullB++
+			}
+		}
+		if nonNullA == nonNullB {
+			m.conflictf("    [策略] 两表非空值数量相同(%d)，尝试下一策略\n", nonNullA)
+			return UseA, false
+		}
+		if nonNullA > nonNullB {
+			m.conflictf("    [策略] A表非空值较多(%d>%d)，以A表数据为准\n", nonNullA, nonNullB)
+			return UseA, true
+		}
+		m.conflictf("    [策略] B表非空值较多(%d>%d)，以B表数据为准\n", nonNullB, nonNullA)
+		return UseB, true
+	case UseNewest:
+		f := m.config.TimestampField
+		tA, okA := parseTimestamp(rowA.Values[f], m.config.TimestampLayout)
+		tB, okB := parseTimestamp(rowB.Values[f], m.config.TimestampLayout)
+		if !okA || !okB || tA.Equal(tB) {
+			m.conflictf("    [策略] 时间戳字段[%s]相同或无法解析(A=%s B=%s)，尝试下一策略\n",
+				f, m.displayField(f, rowA.Values[f]), m.displayField(f, rowB.Values[f]))
+			return UseA, false
+		}
+		m.incStat(&m.stats.ConflictUseNewest)
+		if tA.After(tB) {
+			m.conflictf("    [策略] 时间戳字段[%s]: A较新，以A表数据为准\n", f)
+			return UseA, true
+		}
+		m.conflictf("    [策略] 时间戳字段[%s]: B较新，以B表数据为准\n", f)
+		return UseB, true
+	case UseResolver:
+		return m.callResolver(key, diffFields, rowA, rowB)
+	}
+	return UseA, false
+}
+
+// callResolver 调用 ConflictResolver；出错时按 ResolverErrorPolicy 记录中止错误或弃权
+func (m *Merger) callResolver(key string, diffFields []string, rowA, rowB *rowData) (ConflictStrategy, bool) {
+	if m.config.ConflictResolver == nil {
+		m.conflictf("    [策略] 未配置 ConflictResolver，尝试下一策略\n")
+		return UseA, false
+	}
+	choice, err := m.config.ConflictResolver(key, diffFields, Row(rowA.Values), Row(rowB.Values))
+	if err != nil {
+		logx.Errorf("ConflictResolver 处理key[%s]失败: %v", key, err)
+		if m.config.ResolverErrorPolicy == ResolverErrorAbort {
+			if m.resolverErr == nil {
+				m.resolverErr = fmt.Errorf("ConflictResolver 处理key[%s]失败，任务中止: %v", key, err)
+			}
+			return UseA, true
+		}
+		m.conflictf("    [策略] ConflictResolver 出错(%v)，尝试下一策略\n", err)
+		return UseA, false
+	}
+	switch choice {
+	case UseA:
+		m.conflictf("    [策略] ConflictResolver 选择以A表数据为准\n")
+		return UseA, true
+	case UseB:
+		m.conflictf("    [策略] ConflictResolver 选择以B表数据为准\n")
+		return UseB, true
+	}
+	m.conflictf("    [策略] ConflictResolver 弃权，尝试下一策略\n")
+	return UseA, false
+}
+
+// askUserChoice 交互式询问用户选择，等待用户输入后才继续；answered 表示用户明确选择了A或B
+func (m *Merger) askUserChoice(diffFields []string, rowA, rowB *rowData) (choice ConflictStrategy, answered bool) {
+	fmt.Println("  ┌────────────────────────────────────────────┐")
+	fmt.Println("  │请选择以哪个表的数据为准                    │")
+	fmt.Println("  │                                            │")
+	fmt.Println("  │  输入 A : 使用 A 表的值                    │")
+	fmt.Println("  │  输入 B : 使用 B 表的值                    │")
+	fmt.Println("  │  输入 Q : 终止（当前记录按A处理）          │")
+	fmt.Println("  └────────────────────────────────────────────┘")
+
+	for {
+		fmt.Printf("  >>> 请输入您的选择 (A/B/Q): ")
+
+		// 使用全局的 stdinReader 读取，确保不会因多次创建丢失缓冲区
+		input, err := m.stdinReader.ReadString('\n')
+		// 脚本输入的最后一行可能没有换行符
+		if err != nil && !(err == io.EOF && strings.TrimSpace(input) != "") {
+			logx.Errorf("读取用户输入失败: %v", err)
+			fmt.Printf("  [错误] 读取输入失败: %v，默认使用A表数据\n", err)
+			return UseA, false
+		}
+
+		input = strings.TrimSpace(input)
+		input = strings.TrimRight(input, "\r\n")
+		input = strings.ToUpper(strings.TrimSpace(input))
+
+		switch input {
+		case "A":
+			fmt.Printf("  [用户选择] ✓ 以A表数据为准\n")
+			return UseA, true
+		case "B":
+			fmt.Printf("  [用户选择] ✓ 以B表数据为准\n")
+			return UseB, true
+		case "Q":
+			fmt.Printf("  [用户选择] ✓ 终止任务，当前记录以A表数据为准\n")
+			m.Stop()
+			return UseA, false
+		default:
+			fmt.Printf("  [提示] 无效输入 \"%s\"，请输入 A、B 或 Q\n", input)
+		}
+	}
+}
+
+// buildCRowFromAWithMeta 从A表数据构建C表行，带元数据
+func (m *Merger) buildCRowFromAWithMeta(rowA *rowData, source string, conflict bool, diffFields string) *rowData {
+	result := &rowData{Values: make(map[string]*string)}
+	for _, f := range m.fieldNamesC {
+		if v, ok := rowA.Values[f]; ok {
+			result.Values[f] = copyStringPtr(v)
+		} else {
+			result.Values[f] = nil
+		}
 	}
-	if err = rows.Err(); err != nil {
-		logx.Errorf("遍历列信息出错: %v", err)
-		return nil, fmt.Errorf("遍历列信息出错: %v", err)
+	result.Values["_source"] = strPtr(source)
+	if conflict {
+		result.Values["_conflict"] = strPtr("1")
+	} else {
+		result.Values["_conflict"] = strPtr("0")
 	}
-	if len(columns) == 0 {
-		logx.Errorf("表%s没有找到列（或表不存在）", tableName)
-		return nil, fmt.Errorf("表%s没有找到列（或表不存在）", tableName)
+	if diffFields != "" {
+		result.Values["_diff_fields"] = strPtr(diffFields)
+	} else {
+		result.Values["_diff_fields"] = nil
 	}
-	return columns, nil
+	return result
 }
 
-// buildColumnDef 构建列的DDL定义（C表中所有字段都允许NULL）
-func (m *Merger) buildColumnDef(col columnInfo) string {
-	def := fmt.Sprintf("`%s` %s", col.Name, col.ColumnType)
-	// C表中所有字段都允许为空（因为B表写入时可能缺少字段）
-	def += " NULL"
-	if col.ColumnDefault.Valid {
-		def += fmt.Sprintf(" DEFAULT '%s'", col.ColumnDefault.String)
-	} else {
-		def += " DEFAULT NULL"
+// buildCRowFromB 从B表数据构建C表行
+func (m *Merger) buildCRowFromB(rowB *rowData) *rowData {
+	result := &rowData{Values: make(map[string]*string)}
+	for _, col := range m.columnsC {
+		f := col.Name
+		// B表中忽略的字段不写入
+		if m.ignoreSetB[f] {
+			result.Values[f] = m.bOnlyFillValue(col)
+			continue
+		}
+		if v, ok := rowB.Values[f]; ok && m.bFieldInC[f] {
+			result.Values[f] = copyStringPtr(v)
+		} else {
+			result.Values[f] = m.bOnlyFillValue(col)
+		}
 	}
-	return def
+	result.Values["_source"] = strPtr("B")
+	result.Values["_conflict"] = strPtr("0")
+	result.Values["_diff_fields"] = nil
+	return result
 }
 
-// recreateTableC 重新创建C表
-func (m *Merger) recreateTableC() error {
-	dropSQL := fmt.Sprintf("DROP TABLE IF EXISTS `%s`", m.config.TableC)
-	if _, err := m.db.Exec(dropSQL); err != nil {
-		logx.Errorf("删除C表失败: %v", err)
-		return fmt.Errorf("删除C表失败: %v", err)
+// bOnlyFillValue 按 BOnlyFillPolicy 返回仅在B表中的记录在B表缺失列上的填充值
+func (m *Merger) bOnlyFillValue(col ColumnInfo) *string {
+	switch m.config.BOnlyFillPolicy {
+	case BOnlyFillDefault:
+		if col.ColumnDefault.Valid {
+			return strPtr(col.ColumnDefault.String)
+		}
+	case BOnlyFillCustom:
+		if v, ok := m.config.BOnlyFillValues[col.Name]; ok {
+			return strPtr(v)
+		}
 	}
+	return nil
+}
 
-	var colDefs []string
-	colDefs = append(colDefs, "`id` INT NOT NULL AUTO_INCREMENT PRIMARY KEY")
-	for _, col := range m.columnsC {
-		colDefs = append(colDefs, col.FullDefinition)
+// buildCRowMerged 从合并数据构建C表行
+func (m *Merger) buildCRowMerged(merged *rowData, source string, conflict bool, diffFields string) *rowData {
+	result := &rowData{Values: make(map[string]*string)}
+	for _, f := range m.fieldNamesC {
+		if v, ok := merged.Values[f]; ok {
+			result.Values[f] = copyStringPtr(v)
+		} else {
+			result.Values[f] = nil
+		}
 	}
-	// 添加来源标记字段和冲突标记字段
-	colDefs = append(colDefs, "`_source` VARCHAR(10) NULL DEFAULT NULL COMMENT '数据来源: A/B/MERGE_A/MERGE_B'")
-	colDefs = append(colDefs, "`_conflict` TINYINT(1) NULL DEFAULT 0 COMMENT '是否冲突记录: 0-否, 1-是'")
-	colDefs = append(colDefs, "`_diff_fields` TEXT NULL DEFAULT NULL COMMENT '不同的字段列表'")
-
-	createSQL := fmt.Sprintf("CREATE TABLE `%s` (\n  %s\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
-		m.config.TableC, strings.Join(colDefs, ",\n  "))
-
-	if _, err := m.db.Exec(createSQL); err != nil {
-		logx.Errorf("创建C表失败: %v\nSQL: %s", err, createSQL)
-		return fmt.Errorf("创建C表失败: %v", err)
+	result.Values["_source"] = strPtr(source)
+	if conflict {
+		result.Values["_conflict"] = strPtr("1")
+	} else {
+		result.Values["_conflict"] = strPtr("0")
 	}
-	fmt.Printf("[信息] C表(%s)已重新创建\n", m.config.TableC)
-	return nil
+	if diffFields != "" {
+		result.Values["_diff_fields"] = strPtr(diffFields)
+	} else {
+		result.Values["_diff_fields"] = nil
+	}
+	return result
 }
 
-// readTable 读取表的所有数据
-func (m *Merger) readTable(tableName string, fieldNames []string) ([]rowData, error) {
-	quotedFields := make([]string, len(fieldNames))
-	for i, f := range fieldNames {
-		quotedFields[i] = fmt.Sprintf("`%s`", f)
+// applyPreInsert 写入前对每个结果行调用 PreInsert，回调修改C表字段后重新计算行哈希
+func (m *Merger) applyPreInsert(rows []rowData) error {
+	if m.config.PreInsert == nil {
+		return nil
 	}
-	query := fmt.Sprintf("SELECT %s FROM `%s`", strings.Join(quotedFields, ", "), tableName)
-	rows, err := m.db.Query(query)
-	if err != nil {
-		logx.Errorf("查询表%s数据失败: %v", tableName, err)
-		return nil, fmt.Errorf("查询表%s数据失败: %v", tableName, err)
+	for i := range rows {
+		source := ""
+		if v := rows[i].Values["_source"]; v != nil {
+			source = *v
+		}
+		if err := m.config.PreInsert(rows[i].Values, source); err != nil {
+			logx.Errorf("PreInsert 处理第%d行失败: %v", i+1, err)
+			return fmt.Errorf("PreInsert 处理第%d行失败: %v", i+1, err)
+		}
+		if m.config.RowHash {
+			rows[i].Values["_row_hash"] = strPtr(m.rowHash(&rows[i]))
+		}
 	}
-	defer rows.Close()
+	return nil
+}
 
-	var result []rowData
-	for rows.Next() {
-		scanArgs := make([]interface{}, len(fieldNames))
-		nullStrings := make([]sql.NullString, len(fieldNames))
-		for i := range scanArgs {
-			scanArgs[i] = &nullStrings[i]
+// finishRow 对即将写入C表的行做最后处理：填充默认值、计算行哈希
+func (m *Merger) finishRow(row *rowData) *rowData {
+	if m.config.NormalizeLeadingZeros {
+		for f := range m.zeroSet {
+			if v := row.Values[f]; v != nil {
+				row.Values[f] = strPtr(stripLeadingZeros(*v))
+			}
 		}
-		if err := rows.Scan(scanArgs...); err != nil {
-			logx.Errorf("扫描数据行失败: %v", err)
-			return nil, fmt.Errorf("扫描数据行失败: %v", err)
+	}
+	m.fillDefaults(row)
+	if m.config.TombstoneTable != "" && m.config.TombstoneMark {
+		if key, excluded := m.rowKey(row); !excluded && m.tombstones[key] {
+			row.Values["_deleted"] = strPtr("1")
+		} else {
+			row.Values["_deleted"] = strPtr("0")
 		}
-		rd := rowData{Values: make(map[string]*string)}
-		for i, f := range fieldNames {
-			if nullStrings[i].Valid {
-				val := nullStrings[i].String
-				rd.Values[f] = &val
-			} else {
-				rd.Values[f] = nil // NULL
+	}
+	if len(m.config.ExtraColumns) > 0 {
+		for name, v := range m.config.ExtraColumns {
+			row.Values[name] = strPtr(v)
+		}
+		if m.config.ExtraColumnFunc != nil {
+			source := ""
+			if v := row.Values["_source"]; v != nil {
+				source = *v
+			}
+			for name, v := range m.config.ExtraColumnFunc(Row(row.Values), source) {
+				if _, ok := m.config.ExtraColumns[name]; ok {
+					row.Values[name] = strPtr(v)
+				}
 			}
 		}
-		result = append(result, rd)
 	}
-	if err = rows.Err(); err != nil {
-		logx.Errorf("遍历数据出错: %v", err)
-		return nil, fmt.Errorf("遍历数据出错: %v", err)
+	if m.config.RowHash {
+		row.Values["_row_hash"] = strPtr(m.rowHash(row))
 	}
-	return result, nil
+	return row
 }
 
-// buildKey 根据关键字段构建唯一key
-func (m *Merger) buildKey(row *rowData) string {
-	parts := make([]string, len(m.config.KeyFields))
-	for i, kf := range m.config.KeyFields {
-		val := row.Values[kf]
-		if val == nil {
-			parts[i] = "\x00<NULL>\x00"
+// rowHash 计算行中C表字段值的MD5（NULL与空字符串区分），不含元数据字段
+func (m *Merger) rowHash(row *rowData) string {
+	h := md5.New()
+	for _, f := range m.fieldNamesC {
+		if v := row.Values[f]; v != nil {
+			h.Write([]byte{1})
+			h.Write([]byte(*v))
 		} else {
-			parts[i] = *val
+			h.Write([]byte{0})
 		}
+		h.Write([]byte{0x1f})
 	}
-	return strings.Join(parts, "\x01@@\x01")
+	return hex.EncodeToString(h.Sum(nil))
 }
 
-// compareAndMerge 比较两行数据并合并
-func (m *Merger) compareAndMerge(rowA, rowB *rowData, key string) *rowData {
-	// 第一遍：找出所有不同的字段
-	var diffFields []string
+// outputFields 写入C表的所有字段：C表字段、元数据字段及影子列
+func (m *Merger) outputFields() []string {
+	allFields := make([]string, 0, len(m.fieldNamesC)+len(m.metaFields()))
+	allFields = append(allFields, m.fieldNamesC...)
+	allFields = append(allFields, m.metaFields()...)
+	for _, col := range m.shadowColumns() {
+		allFields = append(allFields, col.Name)
+	}
+	return allFields
+}
 
-	for _, f := range m.compareFields {
-		// B表中忽略的字段不参与对比
-		if m.ignoreSetB[f] {
-			continue
-		}
-		valA := rowA.Values[f]
-		// B表中可能没有此字段
-		valB, bHasField := rowB.Values[f]
-		if !bHasField {
-			continue
+// metaFields 返回C表中的元数据字段
+func (m *Merger) metaFields() []string {
+	fields := append([]string{}, baseMetaFields...)
+	if m.config.RecordAutoFill {
+		fields = append(fields, "_autofill")
+	}
+	if m.config.RowHash {
+		fields = append(fields, "_row_hash")
+	}
+	if m.config.TombstoneTable != "" && m.config.TombstoneMark {
+		fields = append(fields, "_deleted")
+	}
+	if m.config.TraceSourceIDs {
+		fields = append(fields, "_src_id_a", "_src_id_b")
+	}
+	if m.config.RecordResolution {
+		fields = append(fields, "_resolution")
+	}
+	return append(fields, m.extraColumnNames()...)
+}
+
+// extraColumnNames 返回 ExtraColumns 中的附加列名（按名称排序）
+func (m *Merger) extraColumnNames() []string {
+	names := make([]string, 0, len(m.config.ExtraColumns))
+	for name := range m.config.ExtraColumns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// skipUnchanged 追加模式下跳过C表中已有同key且行哈希相同的记录；
+// 哈希不同的记录照常写入，由 REPLACE INTO 替换C表中的旧行（见 Validate）
+func (m *Merger) skipUnchanged(rows []rowData) ([]rowData, error) {
+	if !m.config.RowHash || !m.config.AppendMode || len(m.config.KeyFields) == 0 || len(rows) == 0 {
+		return rows, nil
+	}
+	existing := make(map[string]map[string]bool) // key -> C表中该key已有的行哈希
+	fields := append(append([]string{}, m.config.KeyFields...), "_row_hash")
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		quoted[i] = fmt.Sprintf("`%s`", f)
+	}
+	if m.config.SkipUnchangedVsC {
+		// 按本次结果行的关键字段分批查询，只读取相关key的哈希
+		for start := 0; start < len(rows); start += windowLookupBatch {
+			end := min(start+windowLookupBatch, len(rows))
+			batch := make([]*rowData, 0, end-start)
+			for i := start; i < end; i++ {
+				batch = append(batch, &rows[i])
+			}
+			cond, args := m.keyTupleCond(batch)
+			query := fmt.Sprintf("SELECT %s FROM %s WHERE `_row_hash` IS NOT NULL AND %s",
+				strings.Join(quoted, ", "), m.qualifiedTableC(), cond)
+			if err := m.scanHashesC(query, args, len(fields), existing); err != nil {
+				return nil, err
+			}
 		}
-		if !valuesEqual(valA, valB) {
-			diffFields = append(diffFields, f)
+	} else {
+		query := fmt.Sprintf("SELECT %s FROM %s WHERE `_row_hash` IS NOT NULL",
+			strings.Join(quoted, ", "), m.qualifiedTableC())
+		if err := m.scanHashesC(query, nil, len(fields), existing); err != nil {
+			return nil, err
 		}
 	}
 
-	// 完全相同
-	if len(diffFields) == 0 {
-		m.stats.ExactMatch++
-		return m.buildCRowFromAWithMeta(rowA, "A", false, "")
+	var result []rowData
+	for _, row := range rows {
+		if h := row.Values["_row_hash"]; h != nil && existing[m.keyTuple(row.Values)][*h] {
+			m.incStat(&m.stats.SkippedUnchanged)
+			continue
+		}
+		result = append(result, row)
 	}
+	m.infof("[信息] 与C表同key记录对比，内容未变化跳过 %d 条记录\n", m.stats.SkippedUnchanged)
+	return result, nil
+}
 
-	// 有差异，打印冲突信息
-	m.stats.Conflict++
-	fmt.Printf("\n[冲突 #%d] 关键字段 [%v] = [%s]\n", m.stats.Conflict, strings.Join(m.config.KeyFields, ","), key)
-	fmt.Printf("不同的字段共 %d 个:\n\n", len(diffFields))
-	for _, f := range diffFields {
-		aVal := displayValue(rowA.Values[f])
-		bVal := "<字段不存在>"
-		if v, ok := rowB.Values[f]; ok {
-			bVal = displayValue(v)
+// scanHashesC 执行查询并按 key 收集C表行哈希，查询的列依次为关键字段和 _row_hash
+func (m *Merger) scanHashesC(query string, args []interface{}, n int, existing map[string]map[string]bool) error {
+	dbRows, err := m.db.QueryContext(m.runCtx(), query, args...)
+	if err != nil {
+		logx.Errorf("查询C表行哈希失败: %v", err)
+		return fmt.Errorf("查询C表行哈希失败: %v", err)
+	}
+	defer dbRows.Close()
+	for dbRows.Next() {
+		vals := make([]sql.NullString, n)
+		scanArgs := make([]interface{}, n)
+		for i := range vals {
+			scanArgs[i] = &vals[i]
+		}
+		if err = dbRows.Scan(scanArgs...); err != nil {
+			logx.Errorf("扫描C表行哈希失败: %v", err)
+			return fmt.Errorf("扫描C表行哈希失败: %v", err)
+		}
+		values := make(map[string]*string, n-1)
+		for i, k := range m.config.KeyFields {
+			if vals[i].Valid {
+				values[k] = strPtr(vals[i].String)
+			} else {
+				values[k] = nil
+			}
 		}
-		fmt.Printf("    字段[%s]: A=%-30s B=%s\n", f, aVal, bVal)
+		key := m.keyTuple(values)
+		if existing[key] == nil {
+			existing[key] = make(map[string]bool)
+		}
+		existing[key][vals[n-1].String] = true
+	}
+	if err = dbRows.Err(); err != nil {
+		logx.Errorf("遍历C表行哈希出错: %v", err)
+		return fmt.Errorf("遍历C表行哈希出错: %v", err)
 	}
+	return nil
+}
 
-	// 第二遍：构建合并行，先以A为基础
-	merged := &rowData{Values: make(map[string]*string)}
-	for _, f := range m.fieldNamesC {
-		if v, ok := rowA.Values[f]; ok {
-			merged.Values[f] = copyStringPtr(v)
+// keyTuple 按关键字段的原始值拼接key（不经过 KeyFunc/KeyNormalize），用于与C表中写入的值比对
+func (m *Merger) keyTuple(values map[string]*string) string {
+	parts := make([]string, len(m.config.KeyFields))
+	for i, k := range m.config.KeyFields {
+		if v := values[k]; v != nil {
+			parts[i] = *v
 		} else {
-			merged.Values[f] = nil
+			parts[i] = "\x00<NULL>\x00"
 		}
 	}
+	return strings.Join(parts, "\x01@@\x01")
+}
 
-	// 第三遍：分类差异字段——哪些可以自动解决，哪些需要人工干预
-	var manualDiffFields []string // 两者都有值且不同，需人工决定
-	autoResolvedCount := 0
-
-	for _, f := range diffFields {
-		valA := rowA.Values[f]
-		valB, bHas := rowB.Values[f]
-		if !bHas {
+// fillDefaults 对值为空/NULL的字段写入 DefaultFill 中配置的默认值
+func (m *Merger) fillDefaults(row *rowData) *rowData {
+	for _, f := range m.fieldNamesC {
+		def, ok := m.config.DefaultFill[f]
+		if !ok || !isNullOrEmpty(row.Values[f]) {
 			continue
 		}
+		row.Values[f] = strPtr(def)
+		m.incStat(&m.stats.DefaultFilled)
+	}
+	return row
+}
 
-		aIsEmpty := isNullOrEmpty(valA)
-		bIsEmpty := isNullOrEmpty(valB)
-
-		if aIsEmpty && !bIsEmpty {
-			// A为空/NULL，B有值 => 自动用B的值
-			merged.Values[f] = copyStringPtr(valB)
-			m.stats.NullAutoFilled++
-			autoResolvedCount++
-			fmt.Printf("  [自动填充] 字段[%s]: A为空/NULL, 自动使用B的值: %s\n", f, displayValue(valB))
-		} else if !aIsEmpty && bIsEmpty {
-			// A有值，B为空/NULL => 自动保留A的值
-			autoResolvedCount++
-			fmt.Printf("  [自动保留] 字段[%s]: B为空/NULL, 自动保留A的值: %s\n", f, displayValue(valA))
-		} else {
-			// 两者都有值且不同 => 需要根据策略决定
-			manualDiffFields = append(manualDiffFields, f)
+// formatDiffFields 按 DiffFieldsFormat 格式化差异字段列表
+func (m *Merger) formatDiffFields(fields []string) string {
+	if m.config.DiffFieldsFormat == DiffFieldsJSON {
+		b, err := json.Marshal(fields)
+		if err == nil {
+			return string(b)
 		}
 	}
+	return strings.Join(fields, ",")
+}
 
-	// 如果所有差异都已自动解决，无需人工干预
-	if len(manualDiffFields) == 0 {
-		fmt.Printf("  [结果] 所有差异已自动解决（共 %d 个自动处理）\n", autoResolvedCount)
-		diffStr := strings.Join(diffFields, ",")
-		return m.buildCRowMerged(merged, "MERGE_A", true, diffStr)
+// withAutoFill 开启 RecordAutoFill 时在C表行中记录自动填充的字段列表（_autofill），
+// 只用于全部差异都已自动解决的记录
+func (m *Merger) withAutoFill(row *rowData, autoFilledFields []string) *rowData {
+	if !m.config.RecordAutoFill {
+		return row
 	}
-
-	// 存在需要人工决定的差异字段
-	fmt.Printf("\n[待决] 以下 %d 个字段两者都有值但不同，需根据策略决定:\n\n", len(manualDiffFields))
-	for _, f := range manualDiffFields {
-		fmt.Printf("    字段[%s]: A=%-30s B=%s\n", f, displayValue(rowA.Values[f]), displayValue(rowB.Values[f]))
+	if len(autoFilledFields) > 0 {
+		row.Values["_autofill"] = strPtr(strings.Join(autoFilledFields, ","))
+	} else {
+		row.Values["_autofill"] = nil
 	}
+	return row
+}
 
-	// 根据策略决定
-	var choice ConflictStrategy
-	switch m.config.Strategy {
-	case UseA:
-		choice = UseA
-		fmt.Printf("\n    [策略] 配置为自动以A表数据为准\n")
-	case UseB:
-		choice = UseB
-		fmt.Printf("\n    [策略] 配置为自动以B表数据为准\n")
-	case AskUser:
-		// 交互式询问用户
-		choice = m.askUserChoice(manualDiffFields, rowA, rowB)
+// withResolution 开启 RecordResolution 时写入 _resolution 列：各差异字段最终采用的一方，
+// 按策略决定的字段为 winner（A/B），自动处理的字段为 auto，B表中不存在的字段为 A
+func (m *Merger) withResolution(row, rowB *rowData, diffFields, manualFields []string, winner string) *rowData {
+	if !m.config.RecordResolution {
+		return row
 	}
-
-	diffStr := strings.Join(diffFields, ",")
-
-	if choice == UseA {
-		m.stats.ConflictUseA++
-		fmt.Printf("    [结果] 以A表数据写入C表\n")
-		return m.buildCRowMerged(merged, "MERGE_A", true, diffStr)
+	resolution := make(map[string]string, len(diffFields))
+	for _, f := range diffFields {
+		if _, ok := rowB.Values[f]; ok {
+			resolution[f] = "auto"
+		} else {
+			resolution[f] = "A"
+		}
 	}
+	for _, f := range manualFields {
+		resolution[f] = winner
+	}
+	data, _ := json.Marshal(resolution)
+	row.Values["_resolution"] = strPtr(string(data))
+	return row
+}
 
-	// 以B为准：用B的值覆盖冲突字段
-	m.stats.ConflictUseB++
-	for _, f := range manualDiffFields {
-		if valB, ok := rowB.Values[f]; ok {
-			merged.Values[f] = copyStringPtr(valB)
+// withBValues 在C表行的影子列中保留冲突字段的B表原值（需配置 KeepBValuesColumnSuffix）
+func (m *Merger) withBValues(row *rowData, rowB *rowData, conflictFields []string) *rowData {
+	suffix := m.config.KeepBValuesColumnSuffix
+	if suffix == "" {
+		return row
+	}
+	for _, f := range conflictFields {
+		row.Values[f+suffix] = copyStringPtr(rowB.Values[f])
+		m.shadowSet[f] = true
+		if m.binarySet[f] {
+			m.binarySet[f+suffix] = true
 		}
 	}
-	fmt.Printf("  [结果] 以B表数据写入C表\n")
-	return m.buildCRowMerged(merged, "MERGE_B", true, diffStr)
+	return row
 }
 
-// askUserChoice 交互式询问用户选择，等待用户输入后才继续
-func (m *Merger) askUserChoice(diffFields []string, rowA, rowB *rowData) ConflictStrategy {
-	fmt.Println()
-	fmt.Println("  ┌────────────────────────────────────────────┐")
-	fmt.Println("  │请选择以哪个表的数据为准                    │")
-	fmt.Println("  │                                            │")
-	fmt.Println("  │  输入 A : 使用 A 表的值                    │")
-	fmt.Println("  │  输入 B : 使用 B 表的值                    │")
-	fmt.Println("  └────────────────────────────────────────────┘")
-
-	for {
-		fmt.Printf("  >>> 请输入您的选择 (A/B): ")
-
-		// 使用全局的 stdinReader 读取，确保不会因多次创建丢失缓冲区
-		input, err := m.stdinReader.ReadString('\n')
-		if err != nil {
-			logx.Errorf("读取用户输入失败: %v", err)
-			fmt.Printf("  [错误] 读取输入失败: %v，默认使用A表数据\n", err)
-			return UseA
+// shadowColumns 返回需要追加到C表的影子列（按对比字段顺序）
+func (m *Merger) shadowColumns() []ColumnInfo {
+	var cols []ColumnInfo
+	for _, col := range m.columnsC {
+		if m.shadowSet[col.Name] {
+			col.Name += m.config.KeepBValuesColumnSuffix
+			col.FullDefinition = m.buildColumnDef(col)
+			cols = append(cols, col)
 		}
+	}
+	return cols
+}
 
-		input = strings.TrimSpace(input)
-		input = strings.TrimRight(input, "\r\n")
-		input = strings.ToUpper(strings.TrimSpace(input))
-
-		switch input {
-		case "A":
-			fmt.Printf("  [用户选择] ✓ 以A表数据为准\n")
-			return UseA
-		case "B":
-			fmt.Printf("  [用户选择] ✓ 以B表数据为准\n")
-			return UseB
-		default:
-			fmt.Printf("  [提示] 无效输入 \"%s\"，请输入 A 或 B\n", input)
+// checkInsertColumnsC 写入前重新读取C表结构，核对 batchInsertC 将写入的每一列都存在，
+// 缺失时列出全部缺失的列，避免INSERT报出难以定位的错误
+func (m *Merger) checkInsertColumnsC() error {
+	existing, err := m.existingColumns(m.config.TableCSchema, m.config.TableC)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, f := range m.outputFields() {
+		if !existing[f] {
+			missing = append(missing, f)
 		}
 	}
+	if len(missing) > 0 {
+		logx.Errorf("C表%s缺少将要写入的字段: %s", m.config.TableC, strings.Join(missing, ","))
+		return fmt.Errorf("C表%s缺少将要写入的字段: %s", m.config.TableC, strings.Join(missing, ","))
+	}
+	return nil
 }
 
-// buildCRowFromAWithMeta 从A表数据构建C表行，带元数据
-func (m *Merger) buildCRowFromAWithMeta(rowA *rowData, source string, conflict bool, diffFields string) *rowData {
-	result := &rowData{Values: make(map[string]*string)}
-	for _, f := range m.fieldNamesC {
-		if v, ok := rowA.Values[f]; ok {
-			result.Values[f] = copyStringPtr(v)
-		} else {
-			result.Values[f] = nil
+// addShadowColumnsC 为发生冲突的字段在C表中追加影子列
+func (m *Merger) addShadowColumnsC() error {
+	cols := m.shadowColumns()
+	if len(cols) == 0 {
+		return nil
+	}
+	var adds []string
+	var names []string
+	for _, col := range cols {
+		if m.existingColsC[col.Name] {
+			continue // 追加模式下影子列可能已存在
 		}
+		adds = append(adds, "ADD COLUMN "+col.FullDefinition)
+		names = append(names, col.Name)
 	}
-	result.Values["_source"] = strPtr(source)
-	if conflict {
-		result.Values["_conflict"] = strPtr("1")
-	} else {
-		result.Values["_conflict"] = strPtr("0")
+	if len(adds) == 0 {
+		return nil
 	}
-	if diffFields != "" {
-		result.Values["_diff_fields"] = strPtr(diffFields)
-	} else {
-		result.Values["_diff_fields"] = nil
+	alterSQL := fmt.Sprintf("ALTER TABLE %s %s", m.qualifiedTableC(), strings.Join(adds, ", "))
+	if _, err := m.db.ExecContext(m.runCtx(), alterSQL); err != nil {
+		logx.Errorf("C表追加影子列失败: %v\nSQL: %s", err, alterSQL)
+		return fmt.Errorf("C表追加影子列失败: %v", err)
 	}
-	return result
+	m.infof("[信息] C表已追加B表原值影子列(%d): %v\n", len(names), strings.Join(names, ","))
+	return nil
 }
 
-// buildCRowFromB 从B表数据构建C表行
-func (m *Merger) buildCRowFromB(rowB *rowData) *rowData {
-	result := &rowData{Values: make(map[string]*string)}
-	for _, f := range m.fieldNamesC {
-		// B表中忽略的字段不写入
-		if m.ignoreSetB[f] {
-			result.Values[f] = nil
-			continue
-		}
-		if v, ok := rowB.Values[f]; ok && m.bFieldInC[f] {
-			result.Values[f] = copyStringPtr(v)
-		} else {
-			result.Values[f] = nil
-		}
+// countTableC 查询C表当前记录数
+func (m *Merger) countTableC() (int, error) {
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", m.qualifiedTableC())
+	if err := m.db.QueryRowContext(m.runCtx(), query).Scan(&count); err != nil {
+		logx.Errorf("查询C表记录数失败: %v", err)
+		return 0, fmt.Errorf("查询C表记录数失败: %v", err)
 	}
-	result.Values["_source"] = strPtr("B")
-	result.Values["_conflict"] = strPtr("0")
-	result.Values["_diff_fields"] = nil
-	return result
+	return count, nil
 }
 
-// buildCRowMerged 从合并数据构建C表行
-func (m *Merger) buildCRowMerged(merged *rowData, source string, conflict bool, diffFields string) *rowData {
-	result := &rowData{Values: make(map[string]*string)}
-	for _, f := range m.fieldNamesC {
-		if v, ok := merged.Values[f]; ok {
-			result.Values[f] = copyStringPtr(v)
-		} else {
-			result.Values[f] = nil
-		}
+// verifyTableC 核对C表：记录数增量须等于写入行数，并抽样检查关键字段能否查回
+func (m *Merger) verifyTableC(rows []rowData, countBefore int) error {
+	countAfter, err := m.countTableC()
+	if err != nil {
+		return err
 	}
-	result.Values["_source"] = strPtr(source)
-	if conflict {
-		result.Values["_conflict"] = strPtr("1")
-	} else {
-		result.Values["_conflict"] = strPtr("0")
+	if countAfter-countBefore != len(rows) {
+		logx.Errorf("C表核对失败: 应写入 %d 条, 实际新增 %d 条", len(rows), countAfter-countBefore)
+		return fmt.Errorf("C表核对失败: 应写入 %d 条, 实际新增 %d 条", len(rows), countAfter-countBefore)
 	}
-	if diffFields != "" {
-		result.Values["_diff_fields"] = strPtr(diffFields)
-	} else {
-		result.Values["_diff_fields"] = nil
+
+	// 抽样核对关键字段（NULL安全比较）
+	const sampleSize = 10
+	if len(rows) > 0 && len(m.config.KeyFields) > 0 {
+		conds := make([]string, len(m.config.KeyFields))
+		for i, k := range m.config.KeyFields {
+			conds[i] = fmt.Sprintf("`%s` <=> ?", k)
+		}
+		query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", m.qualifiedTableC(), strings.Join(conds, " AND "))
+		step := len(rows)/sampleSize + 1
+		for i := 0; i < len(rows); i += step {
+			args := make([]interface{}, len(m.config.KeyFields))
+			for j, k := range m.config.KeyFields {
+				if v := rows[i].Values[k]; v != nil {
+					args[j] = *v
+				}
+			}
+			var found int
+			if err = m.db.QueryRowContext(m.runCtx(), query, args...).Scan(&found); err != nil {
+				logx.Errorf("抽样核对C表失败: %v", err)
+				return fmt.Errorf("抽样核对C表失败: %v", err)
+			}
+			if found == 0 {
+				key := m.buildKey(&rows[i])
+				logx.Errorf("C表核对失败: 关键字段 [%s] 的记录未写入", key)
+				return fmt.Errorf("C表核对失败: 关键字段 [%s] 的记录未写入", key)
+			}
+		}
 	}
-	return result
+	m.infof("[核对] C表记录数与抽样关键字段核对通过\n")
+	return nil
 }
 
 // batchInsertC 批量插入数据到C表
-func (m *Merger) batchInsertC(rows []rowData) error {
+func (m *Merger) batchInsertC(rows []rowData) ([]rowData, error) {
 	if len(rows) == 0 {
-		fmt.Printf("[信息] 没有数据需要写入\n")
-		return nil
+		m.infof("[信息] 没有数据需要写入\n")
+		return rows, nil
 	}
 
-	// C表的所有字段（包括元数据字段）
-	allFields := make([]string, 0, len(m.fieldNamesC)+3)
-	allFields = append(allFields, m.fieldNamesC...)
-	allFields = append(allFields, "_source", "_conflict", "_diff_fields")
-
+	allFields := m.outputFields()
 	quotedFields := make([]string, len(allFields))
 	for i, f := range allFields {
 		quotedFields[i] = fmt.Sprintf("`%s`", f)
@@ -726,44 +4421,155 @@ func (m *Merger) batchInsertC(rows []rowData) error {
 	}
 	singleRow := "(" + strings.Join(placeholders, ", ") + ")"
 
-	batchSize := m.config.BatchSize
+	maxBytes, err := m.maxBatchBytes()
+	if err != nil {
+		return nil, err
+	}
+	batches := m.splitBatches(rows, allFields, maxBytes)
 	total := len(rows)
-	inserted := 0
+	workers := m.config.InsertConcurrency
+	if workers < 1 {
+		workers = 1
+	}
 
-	for i := 0; i < total; i += batchSize {
-		end := i + batchSize
-		if end > total {
-			end = total
+	// 按批次分发给写入协程，任一批次失败即取消其余批次
+	ctx, cancel := context.WithCancel(m.runCtx())
+	defer cancel()
+	starts := make(chan [2]int)
+	var (
+		inserted atomic.Int64
+		rejects  []rejectedRow
+		firstErr error
+		errOnce  sync.Once
+		printMu  sync.Mutex
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range starts {
+				if ctx.Err() != nil {
+					continue
+				}
+				i, end := b[0], b[1]
+				err := m.insertBatch(ctx, rows[i:end], allFields, fieldStr, singleRow)
+				var rejected []rejectedRow
+				if err != nil && m.config.ContinueOnInsertError && ctx.Err() == nil {
+					// 整批失败时逐行重试，仍失败的行记为拒绝，不中止写入
+					rejected, err = m.retryRowsC(ctx, rows, i, end, allFields, fieldStr, singleRow)
+				}
+				if err != nil {
+					errOnce.Do(func() {
+						logx.Errorf("批量插入C表失败(行 %d-%d): %v", i+1, end, err)
+						firstErr = fmt.Errorf("批量插入C表失败: %v", err)
+						cancel()
+					})
+					continue
+				}
+				n := inserted.Add(int64(end - i - len(rejected)))
+				m.metricInc(MetricBatchesWritten)
+				printMu.Lock()
+				rejects = append(rejects, rejected...)
+				m.infof("\r[写入] 已写入 %d/%d 条记录", n, total)
+				printMu.Unlock()
+			}
+		}()
+	}
+	for _, b := range batches {
+		if ctx.Err() != nil {
+			break
 		}
-		batch := rows[i:end]
+		select {
+		case starts <- b:
+		case <-ctx.Done():
+		}
+	}
+	close(starts)
+	wg.Wait()
+	m.infof("\n")
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if len(rejects) == 0 {
+		return rows, nil
+	}
+	return m.handleRejects(rows, rejects)
+}
 
-		rowPlaceholders := make([]string, len(batch))
-		args := make([]interface{}, 0, len(batch)*len(allFields))
+// maxBatchBytes 返回单个INSERT语句的字节上限：MaxBatchBytes 与（开启 AutoPacketSize 时）
+// max_allowed_packet 的一半中较小者，0 表示不限制
+func (m *Merger) maxBatchBytes() (int, error) {
+	limit := m.config.MaxBatchBytes
+	if !m.config.AutoPacketSize {
+		return limit, nil
+	}
+	var packet int
+	if err := m.db.QueryRowContext(m.runCtx(), "SELECT @@max_allowed_packet").Scan(&packet); err != nil {
+		logx.Errorf("查询max_allowed_packet失败: %v", err)
+		return 0, fmt.Errorf("查询max_allowed_packet失败: %v", err)
+	}
+	auto := packet / 2 // 留出语句本身和协议开销的余量
+	m.infof("[信息] max_allowed_packet=%d，单批写入上限 %d 字节\n", packet, auto)
+	if limit <= 0 || auto < limit {
+		limit = auto
+	}
+	return limit, nil
+}
 
-		for j, row := range batch {
-			rowPlaceholders[j] = singleRow
+// splitBatches 按 BatchSize 和字节上限划分批次，返回每批的 [起始, 结束) 下标；单行超过上限时独占一批
+func (m *Merger) splitBatches(rows []rowData, allFields []string, maxBytes int) [][2]int {
+	var batches [][2]int
+	start, size := 0, 0
+	for i := range rows {
+		rowBytes := 0
+		if maxBytes > 0 {
 			for _, f := range allFields {
-				val := row.Values[f]
-				if val == nil {
-					args = append(args, nil)
-				} else {
-					args = append(args, *val)
+				rowBytes += 8 // 占位符和参数的协议开销（近似值）
+				if v := rows[i].Values[f]; v != nil {
+					rowBytes += len(*v)
 				}
 			}
 		}
+		if i > start && (i-start >= m.config.BatchSize || (maxBytes > 0 && size+rowBytes > maxBytes)) {
+			batches = append(batches, [2]int{start, i})
+			start, size = i, 0
+		}
+		size += rowBytes
+	}
+	if start < len(rows) {
+		batches = append(batches, [2]int{start, len(rows)})
+	}
+	return batches
+}
 
-		insertSQL := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES %s",
-			m.config.TableC, fieldStr, strings.Join(rowPlaceholders, ", "))
+// insertBatch 将一批行以单条多值 INSERT 语句写入C表
+func (m *Merger) insertBatch(ctx context.Context, batch []rowData, allFields []string, fieldStr, singleRow string) error {
+	rowPlaceholders := make([]string, len(batch))
+	args := make([]interface{}, 0, len(batch)*len(allFields))
 
-		if _, err := m.db.Exec(insertSQL, args...); err != nil {
-			logx.Errorf("批量插入C表失败(行 %d-%d): %v", i+1, end, err)
-			return fmt.Errorf("批量插入C表失败: %v", err)
+	for j, row := range batch {
+		rowPlaceholders[j] = singleRow
+		for _, f := range allFields {
+			val := row.Values[f]
+			if val == nil {
+				args = append(args, nil)
+			} else if m.binarySet[f] {
+				args = append(args, []byte(*val)) // 二进制字段按字节写入
+			} else {
+				args = append(args, *val)
+			}
 		}
-		inserted += len(batch)
-		fmt.Printf("\r[写入] 已写入 %d/%d 条记录", inserted, total)
 	}
-	fmt.Println()
-	return nil
+
+	verb := "INSERT"
+	if m.config.InsertMode == ReplaceInto {
+		verb = "REPLACE"
+	}
+	insertSQL := fmt.Sprintf("%s INTO %s (%s) VALUES %s",
+		verb, m.qualifiedTableC(), fieldStr, strings.Join(rowPlaceholders, ", "))
+	_, err := m.db.ExecContext(ctx, insertSQL, args...)
+	return err
 }
 
 // ==================== 工具函数 ====================
@@ -779,6 +4585,11 @@ func valuesEqual(a, b *string) bool {
 	return *a == *b
 }
 
+// collapseWhitespace 去除首尾空白，并将连续的空白字符替换为一个空格
+func collapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
 // isNullOrEmpty 判断值是否为 NULL 或空字符串
 func isNullOrEmpty(v *string) bool {
 	if v == nil {
@@ -787,6 +4598,198 @@ func isNullOrEmpty(v *string) bool {
 	return *v == ""
 }
 
+// bothEmptyValue 按 BothEmptyPrefer 返回A、B都为空时C表的取值
+func (m *Merger) bothEmptyValue(valA, valB *string) *string {
+	switch m.config.BothEmptyPrefer {
+	case BothEmptyNull:
+		return nil
+	case BothEmptyEmpty:
+		return strPtr("")
+	case BothEmptyPreferB:
+		return copyStringPtr(valB)
+	default:
+		return copyStringPtr(valA)
+	}
+}
+
+// isEmptyValue 判断字段值是否为"无值"：NULL、空字符串，或配置的占位值（NullSentinels/FieldNullSentinels）
+func (m *Merger) isEmptyValue(field string, v *string) bool {
+	if isNullOrEmpty(v) {
+		return true
+	}
+	return m.isSentinel(field, *v)
+}
+
+// isSentinel 判断值是否为该字段配置的占位值
+func (m *Merger) isSentinel(field, v string) bool {
+	if m.sentinels[v] {
+		return true
+	}
+	for _, s := range m.config.FieldNullSentinels[field] {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// keptEmptyValue 返回自动处理时保留的空值：开启 NullifySentinels 时占位值写为 NULL
+func (m *Merger) keptEmptyValue(field string, v *string) *string {
+	if m.config.NullifySentinels && v != nil && m.isSentinel(field, *v) {
+		return nil
+	}
+	return copyStringPtr(v)
+}
+
+// parseJSONObject 将值解析为JSON对象，失败返回false
+func parseJSONObject(v string) (map[string]interface{}, bool) {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(v), &obj); err != nil || obj == nil {
+		return nil, false
+	}
+	return obj, true
+}
+
+// jsonValuesEqual 判断两个JSON对象在语义上是否相等（忽略空白和键顺序）
+func jsonValuesEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	objA, okA := parseJSONObject(*a)
+	objB, okB := parseJSONObject(*b)
+	if !okA || !okB {
+		return false
+	}
+	return reflect.DeepEqual(objA, objB)
+}
+
+// mergeJSONValues 按顶层子键合并两个JSON对象
+// mergedA: 以A为基础、B补全缺失子键，冲突子键取A的值
+// mergedB: 同上，但冲突子键取B的值
+// diffKeys: 两者都有但值不同的子键（已排序）
+func mergeJSONValues(a, b string) (mergedA, mergedB string, diffKeys []string, ok bool) {
+	objA, okA := parseJSONObject(a)
+	objB, okB := parseJSONObject(b)
+	if !okA || !okB {
+		return "", "", nil, false
+	}
+	resA := make(map[string]interface{}, len(objA))
+	resB := make(map[string]interface{}, len(objA))
+	for k, v := range objA {
+		resA[k] = v
+		resB[k] = v
+	}
+	for k, vb := range objB {
+		va, has := objA[k]
+		if !has {
+			resA[k] = vb
+			resB[k] = vb
+			continue
+		}
+		if !reflect.DeepEqual(va, vb) {
+			resB[k] = vb
+			diffKeys = append(diffKeys, k)
+		}
+	}
+	sort.Strings(diffKeys)
+	bytesA, err := json.Marshal(resA)
+	if err != nil {
+		return "", "", nil, false
+	}
+	bytesB, err := json.Marshal(resB)
+	if err != nil {
+		return "", "", nil, false
+	}
+	return string(bytesA), string(bytesB), diffKeys, true
+}
+
+// compareVersion 比较两个版本值：均为数值时按数值比较，否则按字符串比较
+// 返回 1 表示a较新，-1 表示b较新，0 表示相同；任一为空时 ok 为 false
+func compareVersion(a, b *string) (int, bool) {
+	if isNullOrEmpty(a) || isNullOrEmpty(b) {
+		return 0, false
+	}
+	fa, errA := strconv.ParseFloat(*a, 64)
+	fb, errB := strconv.ParseFloat(*b, 64)
+	if errA == nil && errB == nil {
+		switch {
+		case fa > fb:
+			return 1, true
+		case fa < fb:
+			return -1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(*a, *b), true
+}
+
+// normalizeNumeric 规范化数值字符串：去除首尾空白、前导零和小数部分末尾的零（如 " 05" -> "5"，"5.10" -> "5.1"），
+// 不是十进制数值的字符串原样返回
+func normalizeNumeric(v string) string {
+	s := strings.TrimSpace(v)
+	sign := ""
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		if s[0] == '-' {
+			sign = "-"
+		}
+		s = s[1:]
+	}
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return v
+	}
+	for _, part := range []string{intPart, fracPart} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return v
+			}
+		}
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if hasDot {
+		fracPart = strings.TrimRight(fracPart, "0")
+	}
+	if fracPart != "" {
+		intPart += "." + fracPart
+	}
+	if intPart == "0" {
+		sign = "" // -0 与 0 相同
+	}
+	return sign + intPart
+}
+
+// parseTimestamp 按 layout（为空时使用 "2006-01-02 15:04:05"）解析时间戳，失败时再按 RFC3339 解析
+// （DSN 开启 parseTime 时时间列读出为该格式），空值或无法解析时 ok 为 false
+func parseTimestamp(v *string, layout string) (time.Time, bool) {
+	if isNullOrEmpty(v) {
+		return time.Time{}, false
+	}
+	if layout == "" {
+		layout = time.DateTime
+	}
+	s := strings.TrimSpace(*v)
+	if t, err := time.Parse(layout, s); err == nil {
+		return t, true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// firstNonEmpty 返回第一个非空字符串
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
 // copyStringPtr 复制字符串指针
 func copyStringPtr(v *string) *string {
 	if v == nil {
@@ -801,6 +4804,123 @@ func strPtr(s string) *string {
 	return &s
 }
 
+// displayField 格式化显示字段值，二进制字段以十六进制显示
+func (m *Merger) displayField(field string, v *string) string {
+	if v != nil && *v != "" && m.binarySet[field] {
+		const maxBytes = 32
+		if len(*v) > maxBytes {
+			return fmt.Sprintf("0x%s...(%d字节)", hex.EncodeToString([]byte((*v)[:maxBytes])), len(*v))
+		}
+		return "0x" + hex.EncodeToString([]byte(*v))
+	}
+	return displayValue(v)
+}
+
+// parseEnumValues 解析 enum('a','b') 或 set('a','b') 中的取值列表，” 表示转义的单引号
+func parseEnumValues(columnType string) []string {
+	start := strings.Index(columnType, "(")
+	end := strings.LastIndex(columnType, ")")
+	if start < 0 || end <= start {
+		return nil
+	}
+	body := columnType[start+1 : end]
+	var values []string
+	var cur strings.Builder
+	inQuote := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\'' && inQuote && i+1 < len(body) && body[i+1] == '\'':
+			cur.WriteByte('\'')
+			i++
+		case c == '\'':
+			if inQuote {
+				values = append(values, cur.String())
+				cur.Reset()
+			}
+			inQuote = !inQuote
+		case inQuote:
+			cur.WriteByte(c)
+		}
+	}
+	return values
+}
+
+// enumValueAllowed 判断值是否在取值范围内；SET 的值为逗号分隔的多个成员，空字符串合法
+func enumValueAllowed(v string, allowed map[string]bool, isSet bool) bool {
+	if !isSet {
+		return allowed[strings.ToLower(v)]
+	}
+	if v == "" {
+		return true
+	}
+	for _, part := range strings.Split(v, ",") {
+		if !allowed[strings.ToLower(part)] {
+			return false
+		}
+	}
+	return true
+}
+
+// stripLeadingZeros 去除整数部分的前导零，保留正负号，整数部分全为零时保留一个 "0"
+// （如 "00123" -> "123"，"000" -> "0"，"-007" -> "-7"，"00.50" -> "0.50"）
+func stripLeadingZeros(v string) string {
+	sign := ""
+	if strings.HasPrefix(v, "-") || strings.HasPrefix(v, "+") {
+		sign, v = v[:1], v[1:]
+	}
+	digits := strings.TrimLeft(v, "0")
+	if len(digits) < len(v) && (digits == "" || digits[0] < '0' || digits[0] > '9') {
+		// 整数部分只有零（后面是小数点、其它字符或结尾）时保留一个 "0"
+		digits = "0" + digits
+	}
+	return sign + digits
+}
+
+// isBoolType 判断列类型是否按布尔值使用：tinyint(1) 或 bit(1)
+func isBoolType(columnType string) bool {
+	t := strings.ToLower(columnType)
+	return strings.HasPrefix(t, "tinyint(1)") || t == "bit(1)"
+}
+
+// defaultTruthyValues、defaultFalsyValues 布尔对比时默认识别的真/假值（不区分大小写）
+var (
+	defaultTruthyValues = []string{"1", "true", "t", "yes", "y", "on", "\x01"}
+	defaultFalsyValues  = []string{"0", "false", "f", "no", "n", "off", "\x00"}
+)
+
+// parseBool 按 TruthyValues/FalsyValues（为空时使用默认值）解析布尔值，无法识别时 ok 为 false
+func (m *Merger) parseBool(v string) (value, ok bool) {
+	truthy, falsy := m.config.TruthyValues, m.config.FalsyValues
+	if len(truthy) == 0 {
+		truthy = defaultTruthyValues
+	}
+	if len(falsy) == 0 {
+		falsy = defaultFalsyValues
+	}
+	v = strings.TrimSpace(v)
+	for _, t := range truthy {
+		if strings.EqualFold(v, t) {
+			return true, true
+		}
+	}
+	for _, f := range falsy {
+		if strings.EqualFold(v, f) {
+			return false, true
+		}
+	}
+	return false, false
+}
+
+// isBinaryType 判断列的数据类型是否为二进制类型
+func isBinaryType(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return true
+	}
+	return false
+}
+
 // displayValue 格式化显示值（处理NULL和空字符串）
 func displayValue(v *string) string {
 	if v == nil {
@@ -811,3 +4931,175 @@ func displayValue(v *string) string {
 	}
 	return *v
 }
+
+// statsColumn 统计表中的一列
+type statsColumn struct {
+	name  string
+	def   string
+	value interface{}
+}
+
+// statsColumns 返回写入统计表的列及本次运行的取值
+func (m *Merger) statsColumns() []statsColumn {
+	s := m.Stats()
+	counter := func(name string, v int) statsColumn {
+		return statsColumn{name, "INT NOT NULL DEFAULT 0", v}
+	}
+	return []statsColumn{
+		{"run_id", "VARCHAR(32) NOT NULL", s.RunID},
+		{"table_a", "VARCHAR(255) NOT NULL", m.config.TableA},
+		{"table_b", "VARCHAR(255) NOT NULL", m.config.TableB},
+		{"table_c", "VARCHAR(255) NOT NULL", m.config.TableC},
+		counter("total_a", s.TotalA),
+		counter("total_b", s.TotalB),
+		counter("total_c", s.TotalC),
+		counter("exact_match", s.ExactMatch),
+		counter("only_in_a", s.OnlyInA),
+		counter("only_in_b", s.OnlyInB),
+		counter("conflict", s.Conflict),
+		counter("null_auto_filled", s.NullAutoFilled),
+		counter("silent_backfilled", s.SilentBackfilled),
+		counter("default_filled", s.DefaultFilled),
+		counter("skipped_unchanged", s.SkippedUnchanged),
+		counter("conflict_use_a", s.ConflictUseA),
+		counter("conflict_use_b", s.ConflictUseB),
+		counter("conflict_use_newest", s.ConflictUseNewest),
+		counter("tombstoned", s.Tombstoned),
+		counter("enum_violations", s.EnumViolations),
+		counter("type_mismatches", len(s.TypeMismatches)),
+		counter("orphans", s.Orphans),
+		counter("resumed", s.Resumed),
+		counter("longer_wins_resolved", s.LongerWinsResolved),
+		counter("leading_zero_matched", s.LeadingZeroMatched),
+		counter("uncompared", s.Uncompared),
+		counter("filtered_a", s.FilteredA),
+		counter("filtered_b", s.FilteredB),
+		counter("rejected", s.Rejected),
+		{"stopped", "TINYINT(1) NOT NULL DEFAULT 0", s.Stopped},
+		{"start_time", "DATETIME(6) NOT NULL", s.StartTime},
+		{"end_time", "DATETIME(6) NOT NULL", s.EndTime},
+		{"duration_ms", "BIGINT NOT NULL DEFAULT 0", s.EndTime.Sub(s.StartTime).Milliseconds()},
+	}
+}
+
+// writeStatsTable 将本次运行的统计写入 StatsTable，表不存在时自动创建
+func (m *Merger) writeStatsTable() error {
+	if m.config.StatsTable == "" {
+		return nil
+	}
+	name := fmt.Sprintf("`%s`", m.config.StatsTable)
+	if m.config.TableCSchema != "" {
+		name = fmt.Sprintf("`%s`.%s", m.config.TableCSchema, name)
+	}
+	cols := m.statsColumns()
+	defs := []string{"`id` BIGINT NOT NULL AUTO_INCREMENT"}
+	names := make([]string, len(cols))
+	holders := make([]string, len(cols))
+	values := make([]interface{}, len(cols))
+	for i, col := range cols {
+		defs = append(defs, fmt.Sprintf("`%s` %s", col.name, col.def))
+		names[i] = fmt.Sprintf("`%s`", col.name)
+		holders[i] = "?"
+		values[i] = col.value
+	}
+	defs = append(defs, "PRIMARY KEY (`id`)", "KEY `idx_run_id` (`run_id`)")
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  %s\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		name, strings.Join(defs, ",\n  "))
+	if _, err := m.db.ExecContext(m.runCtx(), createSQL); err != nil {
+		logx.Errorf("创建统计表%s失败: %v", m.config.StatsTable, err)
+		return fmt.Errorf("创建统计表%s失败: %v", m.config.StatsTable, err)
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(names, ", "), strings.Join(holders, ", "))
+	if _, err := m.db.ExecContext(m.runCtx(), insertSQL, values...); err != nil {
+		logx.Errorf("写入统计表%s失败: %v", m.config.StatsTable, err)
+		return fmt.Errorf("写入统计表%s失败: %v", m.config.StatsTable, err)
+	}
+	m.infof("[信息] 本次运行统计已写入 %s (run_id=%s)\n", m.config.StatsTable, m.stats.RunID)
+	return nil
+}
+
+// rejectedRow 逐行重试后仍写入C表失败的行
+type rejectedRow struct {
+	index int // 在待写入行中的下标
+	err   error
+}
+
+// retryRowsC 逐行写入 rows[start:end]，返回写入失败的行；只有上下文被取消时返回错误
+func (m *Merger) retryRowsC(ctx context.Context, rows []rowData, start, end int, allFields []string, fieldStr, singleRow string) ([]rejectedRow, error) {
+	var rejected []rejectedRow
+	for i := start; i < end; i++ {
+		if err := m.insertBatch(ctx, rows[i:i+1], allFields, fieldStr, singleRow); err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			rejected = append(rejected, rejectedRow{index: i, err: err})
+		}
+	}
+	return rejected, nil
+}
+
+// handleRejects 记录写入失败的行（配置 RejectTable 时写入拒绝表），返回实际写入C表的行
+func (m *Merger) handleRejects(rows []rowData, rejects []rejectedRow) ([]rowData, error) {
+	sort.Slice(rejects, func(i, j int) bool { return rejects[i].index < rejects[j].index })
+	m.setStats(func(s *MergeStats) { s.Rejected += len(rejects) })
+	m.infof("[警告] %d 条记录写入C表失败，已跳过\n", len(rejects))
+	for _, r := range rejects {
+		logx.Errorf("写入C表失败(行 %d): %v", r.index+1, r.err)
+	}
+	if m.config.RejectTable != "" {
+		if err := m.writeRejectTable(rows, rejects); err != nil {
+			return nil, err
+		}
+	}
+	rejected := make(map[int]bool, len(rejects))
+	for _, r := range rejects {
+		rejected[r.index] = true
+	}
+	written := make([]rowData, 0, len(rows)-len(rejects))
+	for i := range rows {
+		if !rejected[i] {
+			written = append(written, rows[i])
+		}
+	}
+	return written, nil
+}
+
+// writeRejectTable 将写入失败的行写入 RejectTable，表不存在时自动创建；行数据保存为JSON，
+// 不受C表列类型和约束限制（二进制字段以十六进制显示）
+func (m *Merger) writeRejectTable(rows []rowData, rejects []rejectedRow) error {
+	name := fmt.Sprintf("`%s`", m.config.RejectTable)
+	if m.config.TableCSchema != "" {
+		name = fmt.Sprintf("`%s`.%s", m.config.TableCSchema, name)
+	}
+	createSQL := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  `id` BIGINT NOT NULL AUTO_INCREMENT,\n"+
+		"  `run_id` VARCHAR(32) NOT NULL,\n"+
+		"  `table_c` VARCHAR(255) NOT NULL,\n"+
+		"  `row_data` LONGTEXT NOT NULL,\n"+
+		"  `error_message` TEXT NOT NULL,\n"+
+		"  `created_at` DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,\n"+
+		"  PRIMARY KEY (`id`),\n"+
+		"  KEY `idx_run_id` (`run_id`)\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", name)
+	if _, err := m.db.ExecContext(m.runCtx(), createSQL); err != nil {
+		logx.Errorf("创建拒绝表%s失败: %v", m.config.RejectTable, err)
+		return fmt.Errorf("创建拒绝表%s失败: %v", m.config.RejectTable, err)
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (`run_id`, `table_c`, `row_data`, `error_message`) VALUES (?, ?, ?, ?)", name)
+	for _, r := range rejects {
+		values := make(map[string]*string, len(rows[r.index].Values))
+		for f, v := range rows[r.index].Values {
+			values[f] = m.displayPtr(f, v)
+		}
+		data, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+		if _, err = m.db.ExecContext(m.runCtx(), insertSQL, m.stats.RunID, m.config.TableC, string(data), r.err.Error()); err != nil {
+			logx.Errorf("写入拒绝表%s失败: %v", m.config.RejectTable, err)
+			return fmt.Errorf("写入拒绝表%s失败: %v", m.config.RejectTable, err)
+		}
+	}
+	m.infof("[信息] %d 条写入失败的记录已保存到拒绝表 %s\n", len(rejects), m.config.RejectTable)
+	return nil
+}
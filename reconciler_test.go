@@ -0,0 +1,1560 @@
+package reconciler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestStripLeadingZeros(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"0", "0"},
+		{"000", "0"},
+		{"00123", "123"},
+		{"123", "123"},
+		{"100", "100"},
+		{"0.5", "0.5"},
+		{"000.5", "0.5"},
+		{".5", ".5"},
+		{"-007", "-7"},
+		{"+007", "+7"},
+		{"-000", "-0"},
+		{"-0.50", "-0.50"},
+		{"00AB", "0AB"},
+	}
+	for _, tt := range tests {
+		if got := stripLeadingZeros(tt.in); got != tt.want {
+			t.Errorf("stripLeadingZeros(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSkipUnchangedMatchesKeyAndHash(t *testing.T) {
+	for _, byKey := range []bool{false, true} {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+		db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Ann"})
+		db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Ann"})
+		config := fakeConfig(db, "k")
+		config.AppendMode, config.RowHash, config.SkipUnchangedVsC = true, true, byKey
+		config.InsertMode, config.NoSurrogateKey = ReplaceInto, true
+		runFake(t, config)
+
+		// 第二次运行时 k=2 的内容变化，k=1 未变化
+		db.table("a").find("k", "2")["name"] = strPtr("Anna")
+		db.table("b").find("k", "2")["name"] = strPtr("Anna")
+		stats, _ := runFake(t, config)
+		if stats.SkippedUnchanged != 1 {
+			t.Errorf("SkipUnchangedVsC=%v: SkippedUnchanged = %d, want 1", byKey, stats.SkippedUnchanged)
+		}
+		c := db.table("c")
+		if len(c.rows) != 2 {
+			t.Fatalf("SkipUnchangedVsC=%v: C表 %d 行, want 2", byKey, len(c.rows))
+		}
+		if got := value(c.find("k", "2"), "name"); got != "Anna" {
+			t.Errorf("SkipUnchangedVsC=%v: k=2 name = %q, want Anna", byKey, got)
+		}
+	}
+}
+
+func TestValidateRowHashAppendRequiresReplace(t *testing.T) {
+	config := MergeConfig{TableA: "a", TableB: "b", TableC: "c", KeyFields: []string{"k"},
+		AppendMode: true, RowHash: true}
+	if err := NewMerger(config).Validate(); err == nil {
+		t.Error("追加模式下的 RowHash 未使用 ReplaceInto 时 Validate 应返回错误")
+	}
+	config.InsertMode = ReplaceInto
+	if err := NewMerger(config).Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+	config.KeyFields = nil
+	if err := NewMerger(config).Validate(); err == nil {
+		t.Error("追加模式下的 RowHash 未配置 KeyFields 时 Validate 应返回错误")
+	}
+}
+
+func TestRunContextCancelsQueries(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"})
+	db.insert("b", vals{"k": "1", "name": "Tom"})
+	reading := make(chan struct{})
+	db.hook = func(ctx context.Context, query string) error {
+		if strings.HasPrefix(query, "SELECT `k`, `name` FROM `a`") {
+			// 读取A表时阻塞，直到 ctx 取消
+			close(reading)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		_, err := NewMerger(fakeConfig(db, "k")).RunContext(ctx)
+		done <- err
+	}()
+	<-reading
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("RunContext err = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ctx 取消后 RunContext 未返回")
+	}
+	if stmts := db.statements("INTO `c`"); len(stmts) != 0 {
+		t.Errorf("ctx 取消后仍写入了C表: %v", stmts)
+	}
+}
+
+func TestReadChunkSizeKeysetPagination(t *testing.T) {
+	db := newFakeSources(t, "k int pk", "name varchar(50)")
+	for _, k := range []string{"5", "3", "1", "4", "2"} {
+		db.insert("a", vals{"k": k, "name": "a" + k})
+		db.insert("b", vals{"k": k, "name": "a" + k})
+	}
+	config := fakeConfig(db, "k")
+	config.ReadChunkSize = 2
+	stats, _ := runFake(t, config)
+	if stats.TotalA != 5 || stats.TotalB != 5 || stats.ExactMatch != 5 {
+		t.Errorf("TotalA=%d TotalB=%d ExactMatch=%d, want 5/5/5", stats.TotalA, stats.TotalB, stats.ExactMatch)
+	}
+	pages := db.statements("FROM `a`")
+	if len(pages) != 3 {
+		t.Fatalf("A表读取 %d 次, want 3: %v", len(pages), pages)
+	}
+	if strings.Contains(pages[0].query, "OFFSET") || !strings.HasSuffix(pages[0].query, "ORDER BY `k` LIMIT 2") {
+		t.Errorf("第一页查询 = %q", pages[0].query)
+	}
+	for i, want := range []string{"2", "4"} {
+		p := pages[i+1]
+		if !strings.Contains(p.query, "WHERE (`k`) > (?) ORDER BY `k` LIMIT 2") || len(p.args) != 1 || fakeString(p.args[0]) != want {
+			t.Errorf("第 %d 页查询 = %q %v, want 从 k > %s 开始", i+2, p.query, p.args, want)
+		}
+	}
+	if n := len(db.table("c").rows); n != 5 {
+		t.Errorf("C表 %d 行, want 5", n)
+	}
+}
+
+func TestReadChunkSizeRequiresUniqueKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"无唯一索引", "k int notnull"},
+		{"关键字段可为NULL", "k int unique"},
+	}
+	for _, tt := range tests {
+		db := newFakeSources(t, tt.spec, "name varchar(50)")
+		config := fakeConfig(db, "k")
+		config.ReadChunkSize = 2
+		if _, err := NewMerger(config).Run(); err == nil || !strings.Contains(err.Error(), "ReadChunkSize") {
+			t.Errorf("%s: err = %v, want ReadChunkSize 相关错误", tt.name, err)
+		}
+	}
+}
+
+func TestTimestampOnUpdateKeepsSourceValue(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "updated_at timestamp default=CURRENT_TIMESTAMP onupdate")
+	db.insert("a", vals{"k": "1", "updated_at": "2020-01-02 03:04:05"})
+	db.insert("b", vals{"k": "1", "updated_at": "2020-01-02 03:04:05"})
+	runFake(t, fakeConfig(db, "k"))
+
+	create := db.statements("CREATE TABLE `c`")
+	if len(create) != 1 || !strings.Contains(create[0].query,
+		"`updated_at` timestamp NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP") {
+		t.Errorf("C表建表语句 = %v", create)
+	}
+	if got := value(db.table("c").find("k", "1"), "updated_at"); got != "2020-01-02 03:04:05" {
+		t.Errorf("C表 updated_at = %q, want 源表的值", got)
+	}
+}
+
+func TestOnUpdateClause(t *testing.T) {
+	tests := []struct{ extra, want string }{
+		{"", ""},
+		{"auto_increment", ""},
+		{"DEFAULT_GENERATED on update CURRENT_TIMESTAMP", "ON UPDATE CURRENT_TIMESTAMP"},
+		{"on update CURRENT_TIMESTAMP(3)", "ON UPDATE CURRENT_TIMESTAMP(3)"},
+	}
+	for _, tt := range tests {
+		if got := onUpdateClause(tt.extra); got != tt.want {
+			t.Errorf("onUpdateClause(%q) = %q, want %q", tt.extra, got, tt.want)
+		}
+	}
+	m := NewMerger(MergeConfig{TypeMap: map[string]string{"timestamp": "varchar(30)"}})
+	col := ColumnInfo{Name: "t", DataType: "timestamp", ColumnType: "timestamp", Extra: "on update CURRENT_TIMESTAMP"}
+	if def := m.buildColumnDef(col); strings.Contains(def, "ON UPDATE") {
+		t.Errorf("映射为非时间类型后不应复制 ON UPDATE: %s", def)
+	}
+}
+
+func TestRecordAutoFill(t *testing.T) {
+	cols := textCols("k", "name", "email")
+	dataA := []rowData{
+		row("k", "1", "name", nil, "email", "a@x"),
+		row("k", "2", "name", nil, "email", "a@x"),
+	}
+	dataB := []rowData{
+		row("k", "1", "name", "Tom", "email", "a@x"),
+		row("k", "2", "name", "Ann", "email", "b@x"),
+	}
+	rows, m := mergeMem(t, MergeConfig{KeyFields: []string{"k"}, RecordAutoFill: true}, cols, cols, dataA, dataB)
+	if got := value(findRow(rows, "k", "1").Values, "_autofill"); got != "name" {
+		t.Errorf("只有自动填充的记录 _autofill = %q, want name", got)
+	}
+	if got := value(findRow(rows, "k", "2").Values, "_autofill"); got != "<NULL>" {
+		t.Errorf("需按策略决定的记录 _autofill = %q, want NULL", got)
+	}
+	if !strings.Contains(strings.Join(m.metaFields(), ","), "_autofill") {
+		t.Error("开启 RecordAutoFill 时元数据字段应包含 _autofill")
+	}
+
+	rows, m = mergeMem(t, MergeConfig{KeyFields: []string{"k"}}, cols, cols, dataA, dataB)
+	if strings.Contains(strings.Join(m.metaFields(), ","), "_autofill") {
+		t.Error("未开启 RecordAutoFill 时元数据字段不应包含 _autofill")
+	}
+	if _, ok := findRow(rows, "k", "1").Values["_autofill"]; ok {
+		t.Error("未开启 RecordAutoFill 时不应写入 _autofill")
+	}
+}
+
+func TestAppendToCWithoutAutoFillColumn(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": nil})
+	db.insert("b", vals{"k": "1", "name": "Tom"})
+	// 此前版本创建的C表没有 _autofill 列
+	db.create("c", "id int ai pk", "k varchar(10)", "name varchar(50)",
+		"_source varchar(10)", "_conflict tinyint(1)", "_diff_fields text")
+	config := fakeConfig(db, "k")
+	config.AppendMode = true
+	runFake(t, config)
+	if got := value(db.table("c").find("k", "1"), "name"); got != "Tom" {
+		t.Errorf("C表 name = %q, want Tom", got)
+	}
+}
+
+func TestAutoAddColumnsIsAliasOfAutoMigrateC(t *testing.T) {
+	for _, name := range []string{"AutoMigrateC", "AutoAddColumns"} {
+		t.Run(name, func(t *testing.T) {
+			db := newFakeSources(t, "k varchar(10)", "name varchar(50) notnull default=x")
+			db.insert("a", vals{"k": "1", "name": "Tom"})
+			db.insert("b", vals{"k": "1", "name": "Tom"})
+			// 此前的C表还没有 name 列
+			db.create("c", "id int ai pk", "k varchar(10)",
+				"_source varchar(10)", "_conflict tinyint(1)", "_diff_fields text")
+			db.insert("c", vals{"k": "0"})
+			config := fakeConfig(db, "k")
+			config.AppendMode = true
+			config.AutoMigrateC = name == "AutoMigrateC"
+			config.AutoAddColumns = name == "AutoAddColumns"
+			runFake(t, config)
+			alters := db.statements("ALTER TABLE")
+			if len(alters) != 1 || !strings.Contains(alters[0].query, "`name` varchar(50) NULL DEFAULT NULL") {
+				t.Fatalf("ALTER 语句 = %v", alters)
+			}
+			if got := value(db.table("c").find("k", "0"), "name"); got != "<NULL>" {
+				t.Errorf("已有记录 name = %q, want NULL", got)
+			}
+			if got := value(db.table("c").find("k", "1"), "name"); got != "Tom" {
+				t.Errorf("新记录 name = %q, want Tom", got)
+			}
+		})
+	}
+}
+
+func TestManyDiffFieldsMetaColumnType(t *testing.T) {
+	specs := []string{"k varchar(10) pk"}
+	valsA, valsB := vals{"k": "1"}, vals{"k": "1"}
+	for i := 0; i < 40; i++ {
+		f := fmt.Sprintf("field_with_long_name_%02d", i)
+		specs = append(specs, f+" varchar(20)")
+		valsA[f], valsB[f] = "a", "b"
+	}
+	newDB := func() *fakeDB {
+		db := newFakeSources(t, specs...)
+		db.insert("a", valsA)
+		db.insert("b", valsB)
+		return db
+	}
+
+	// 类型容量不足时返回明确的错误
+	db := newDB()
+	config := fakeConfig(db, "k")
+	config.MetaColumnTypes = map[string]string{"_diff_fields": "VARCHAR(64)"}
+	_, err := NewMerger(config).Run()
+	if err == nil || !strings.Contains(err.Error(), "_diff_fields") || !strings.Contains(err.Error(), "MetaColumnTypes") {
+		t.Fatalf("Run 错误 = %v, want 提示 _diff_fields 容量不足", err)
+	}
+
+	// 使用更大的类型（带字符集属性）时完整写入
+	db = newDB()
+	config = fakeConfig(db, "k")
+	config.MetaColumnTypes = map[string]string{"_diff_fields": "MEDIUMTEXT CHARACTER SET utf8mb4"}
+	runFake(t, config)
+	creates := db.statements("CREATE TABLE")
+	if len(creates) != 1 || !strings.Contains(creates[0].query,
+		"`_diff_fields` MEDIUMTEXT CHARACTER SET utf8mb4 NULL DEFAULT NULL COMMENT '不同的字段列表'") {
+		t.Fatalf("CREATE TABLE 语句 = %v", creates)
+	}
+	if got := value(db.table("c").find("k", "1"), "_diff_fields"); strings.Count(got, "field_with_long_name_") != 40 {
+		t.Errorf("_diff_fields = %q, want 40 个字段", got)
+	}
+}
+
+func TestStopLeavesPendingConflictsUndecided(t *testing.T) {
+	cols := textCols("k", "name")
+	dataA := []rowData{row("k", "1", "name", "a1"), row("k", "2", "name", "a2"), row("k", "3", "name", "a3")}
+	dataB := []rowData{row("k", "1", "name", "b1"), row("k", "2", "name", "b2"), row("k", "3", "name", "b3")}
+	config := MergeConfig{KeyFields: []string{"k"}, Strategy: AskUser, DecisionMode: Deferred,
+		InputReader: strings.NewReader("B\nQ\n")}
+	var rows []rowData
+	var m *Merger
+	captureStdout(t, func() { rows, m = mergeMem(t, config, cols, cols, dataA, dataB) })
+
+	// 第1条选B，第2条输入Q（按A处理），第3条未询问，不写入
+	if len(rows) != 2 {
+		t.Fatalf("结果行数 = %d, want 2", len(rows))
+	}
+	if r := findRow(rows, "k", "1"); r == nil || value(r.Values, "name") != "b1" {
+		t.Errorf("k=1 应采用B的值")
+	}
+	if r := findRow(rows, "k", "2"); r == nil || value(r.Values, "name") != "a2" {
+		t.Errorf("k=2 应采用A的值")
+	}
+	if findRow(rows, "k", "3") != nil {
+		t.Errorf("k=3 未决定，不应写入")
+	}
+	s := m.stats
+	if !s.Stopped || s.ConflictUseA != 1 || s.ConflictUseB != 1 || s.Undecided != 1 {
+		t.Errorf("stats = Stopped:%v UseA:%d UseB:%d Undecided:%d, want true 1 1 1",
+			s.Stopped, s.ConflictUseA, s.ConflictUseB, s.Undecided)
+	}
+}
+
+func TestValidateTableCCollisionIsSchemaQualified(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  MergeConfig
+		collide bool
+	}{
+		{"同库同名", MergeConfig{DSN: "u:p@tcp(h:3306)/test", TableA: "a", TableB: "b", TableC: "A"}, true},
+		{"TableCSchema 为默认库", MergeConfig{DSN: "u:p@tcp(h:3306)/test", TableA: "a", TableB: "b", TableC: "b", TableCSchema: "test"}, true},
+		{"TableCSchema 为其他库", MergeConfig{DSN: "u:p@tcp(h:3306)/test", TableA: "a", TableB: "b", TableC: "a", TableCSchema: "archive"}, false},
+		{"DSNC 默认库不同", MergeConfig{DSN: "u:p@tcp(h:3306)/test", DSNC: "u:p@tcp(h:3306)/archive", TableA: "a", TableB: "b", TableC: "a"}, false},
+		{"B表在C表所在库", MergeConfig{DSN: "u:p@tcp(h:3306)/test", DSNB: "u:p@tcp(h:3306)/archive", TableA: "a", TableB: "c", TableC: "c", TableCSchema: "archive"}, true},
+	}
+	for _, tt := range tests {
+		err := NewMerger(tt.config).Validate()
+		if got := errors.Is(err, ErrTableCCollision); got != tt.collide {
+			t.Errorf("%s: Validate = %v, want collision=%v", tt.name, err, tt.collide)
+		}
+	}
+}
+
+func TestColumnDefaultClause(t *testing.T) {
+	def := func(v, extra string) ColumnInfo {
+		return ColumnInfo{ColumnDefault: sql.NullString{String: v, Valid: true}, Extra: extra}
+	}
+	tests := []struct {
+		col  ColumnInfo
+		want string
+	}{
+		{ColumnInfo{}, "DEFAULT NULL"},
+		{def("abc", ""), "DEFAULT 'abc'"},
+		{def("it's", ""), "DEFAULT 'it''s'"},
+		{def(`C:\tmp`, ""), `DEFAULT 'C:\\tmp'`},
+		{def("CURRENT_TIMESTAMP", "DEFAULT_GENERATED"), "DEFAULT CURRENT_TIMESTAMP"},
+		{def("CURRENT_TIMESTAMP(3)", "DEFAULT_GENERATED"), "DEFAULT CURRENT_TIMESTAMP(3)"},
+		{def("(uuid())", "DEFAULT_GENERATED"), "DEFAULT ((uuid()))"},
+	}
+	for _, tt := range tests {
+		if got := columnDefaultClause(tt.col); got != tt.want {
+			t.Errorf("columnDefaultClause(%q) = %q, want %q", tt.col.ColumnDefault.String, got, tt.want)
+		}
+	}
+}
+
+func TestCreateTableCCopiesDefaults(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "note varchar(50) default=it's",
+		"created_at datetime(3) default=CURRENT_TIMESTAMP(3)")
+	db.insert("a", vals{"k": "1", "created_at": "2020-01-02 03:04:05"})
+	db.insert("b", vals{"k": "1", "created_at": "2020-01-02 03:04:05"})
+	runFake(t, fakeConfig(db, "k"))
+
+	create := db.statements("CREATE TABLE `c`")
+	if len(create) != 1 ||
+		!strings.Contains(create[0].query, "`note` varchar(50) NULL DEFAULT 'it''s'") ||
+		!strings.Contains(create[0].query, "`created_at` datetime(3) NULL DEFAULT CURRENT_TIMESTAMP(3)") {
+		t.Fatalf("C表建表语句 = %v", create)
+	}
+	if col := db.table("c").column("note"); col.def == nil || *col.def != "it's" {
+		t.Errorf("C表 note 默认值 = %v, want it's", col.def)
+	}
+}
+
+// workersData 生成对比用的数据：code 带前导零，doc 为键顺序不同的JSON，部分记录的 name 不同
+func workersData(n int) (dataA, dataB []rowData) {
+	for i := 0; i < n; i++ {
+		k := fmt.Sprint(i)
+		dataA = append(dataA, row("k", k, "code", fmt.Sprintf("%05d", i), "name", "a"+k,
+			"doc", fmt.Sprintf(`{"id":%d,"tags":["x","y"],"n":{"a":1,"b":2}}`, i)))
+		name := "a" + k
+		if i%3 == 0 {
+			name = "b" + k
+		}
+		dataB = append(dataB, row("k", k, "code", k, "name", name,
+			"doc", fmt.Sprintf(`{"n":{"b":2,"a":1},"tags":["x","y"],"id":%d}`, i)))
+	}
+	return dataA, dataB
+}
+
+func TestParallelDiffsMatchSerial(t *testing.T) {
+	cols := textCols("k", "code", "name", "doc")
+	dataA, dataB := workersData(200)
+	merge := func(workers int) ([]rowData, MergeStats) {
+		config := MergeConfig{KeyFields: []string{"k"}, Workers: workers,
+			StripLeadingZeros: []string{"code"}, JSONMergeFields: []string{"doc"},
+			ShouldCompare: func(key string, rowA, rowB Row) bool { return !strings.HasSuffix(key, "7") }}
+		m := newMemMerger(t, config, cols, cols)
+		m.tombstones = map[string]bool{"5": true, "10": true, "15": true}
+		a := make([]rowData, len(dataA))
+		for i := range dataA {
+			a[i] = rowData{Values: cloneValues(dataA[i].Values)}
+		}
+		b := make([]rowData, len(dataB))
+		for i := range dataB {
+			b[i] = rowData{Values: cloneValues(dataB[i].Values)}
+		}
+		rows, err := m.mergeRows(a, b)
+		if err != nil {
+			t.Fatalf("Workers=%d: %v", workers, err)
+		}
+		return rows, m.Stats()
+	}
+	serialRows, serialStats := merge(1)
+	parallelRows, parallelStats := merge(4)
+	if !reflect.DeepEqual(serialStats, parallelStats) {
+		t.Errorf("统计不一致:\n串行 %+v\n并行 %+v", serialStats, parallelStats)
+	}
+	if serialStats.LeadingZeroMatched == 0 || serialStats.Uncompared == 0 || serialStats.Tombstoned == 0 {
+		t.Errorf("测试数据未覆盖前导零、ShouldCompare 和墓碑: %+v", serialStats)
+	}
+	if !reflect.DeepEqual(serialRows, parallelRows) {
+		t.Error("串行与并行合并的结果行不一致")
+	}
+}
+
+func cloneValues(values map[string]*string) map[string]*string {
+	c := make(map[string]*string, len(values))
+	for k, v := range values {
+		c[k] = copyStringPtr(v)
+	}
+	return c
+}
+
+func BenchmarkMergeJSON(b *testing.B) {
+	cols := textCols("k", "code", "name", "doc")
+	dataA, dataB := workersData(2000)
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			config := MergeConfig{KeyFields: []string{"k"}, Workers: workers, QuietConflicts: true,
+				StripLeadingZeros: []string{"code"}, JSONMergeFields: []string{"doc"}}
+			m := newMemMerger(b, config, cols, cols)
+			for i := 0; i < b.N; i++ {
+				if _, err := m.mergeRows(dataA, dataB); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowedTablesCoversAllTables(t *testing.T) {
+	base := MergeConfig{TableA: "tmp_a", TableB: "tmp_b", TableC: "tmp_c", AllowedTablePrefix: "tmp_"}
+	if err := NewMerger(base).Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(c *MergeConfig)
+	}{
+		{"A表", func(c *MergeConfig) { c.TableA = "users" }},
+		{"统计表", func(c *MergeConfig) { c.StatsTable = "merge_stats" }},
+		{"拒绝表", func(c *MergeConfig) { c.RejectTable = "merge_rejects" }},
+		{"墓碑表", func(c *MergeConfig) { c.TombstoneTable = "deleted_users" }},
+		{"变更日志表", func(c *MergeConfig) { c.ChangelogMode, c.ChangelogTable = true, "changelog" }},
+	}
+	for _, tt := range tests {
+		config := base
+		tt.modify(&config)
+		if err := NewMerger(config).Validate(); err == nil {
+			t.Errorf("%s不以允许的前缀开头时 Validate 应返回错误", tt.name)
+		}
+	}
+
+	// 默认的变更日志表名 C表名_changelog 同样要在 AllowedTables 中
+	config := MergeConfig{TableA: "a", TableB: "b", TableC: "c", AllowedTables: []string{"a", "b", "c"}, ChangelogMode: true}
+	if err := NewMerger(config).Validate(); err == nil || !strings.Contains(err.Error(), "c_changelog") {
+		t.Errorf("err = %v, want c_changelog 不在允许的表名单中", err)
+	}
+	config.AllowedTables = append(config.AllowedTables, "c_changelog")
+	if err := NewMerger(config).Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestParseConflictStrategyRoundTrip(t *testing.T) {
+	for _, s := range []ConflictStrategy{UseA, UseB, AskUser, PreferNewer, PreferNonNull, UseNewest, UseResolver} {
+		got, err := ParseConflictStrategy(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseConflictStrategy(%q) = %v, %v, want %v", s.String(), got, err, s)
+		}
+	}
+	if got, err := ParseConflictStrategy(" USE_B "); err != nil || got != UseB {
+		t.Errorf("ParseConflictStrategy(\" USE_B \") = %v, %v, want use_b", got, err)
+	}
+	if _, err := ParseConflictStrategy("use_c"); err == nil {
+		t.Error("未知的策略应返回错误")
+	}
+}
+
+func TestKeepBValuesColumnSuffix(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "email varchar(50)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "email": "a@x.com", "name": "Tom"})
+	db.insert("b", vals{"k": "1", "email": "b@x.com", "name": "Tom"})
+	config := fakeConfig(db, "k")
+	config.KeepBValuesColumnSuffix = "_b"
+	runFake(t, config)
+
+	c := db.table("c")
+	if c.column("email_b") == nil {
+		t.Fatal("C表缺少影子列 email_b")
+	}
+	if c.column("name_b") != nil {
+		t.Error("未冲突的字段不应有影子列")
+	}
+	r := c.find("k", "1")
+	if got := value(r, "email"); got != "a@x.com" {
+		t.Errorf("email = %q, want A的值", got)
+	}
+	if got := value(r, "email_b"); got != "b@x.com" {
+		t.Errorf("email_b = %q, want B的值", got)
+	}
+}
+
+func TestAutoFillPolicyNeverUsesStrategy(t *testing.T) {
+	cols := textCols("k", "email")
+	dataA := []rowData{row("k", "1", "email", nil)}
+	dataB := []rowData{row("k", "1", "email", "b@x.com")}
+	var asked []string
+	config := MergeConfig{KeyFields: []string{"k"}, AutoFillPolicy: Never, Strategy: UseResolver,
+		ConflictResolver: func(key string, diffFields []string, rowA, rowB Row) (ConflictStrategy, error) {
+			asked = append(asked, diffFields...)
+			return UseA, nil
+		}}
+	rows, m := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	if !reflect.DeepEqual(asked, []string{"email"}) {
+		t.Fatalf("策略收到的差异字段 = %v, want [email]", asked)
+	}
+	if got := value(rows[0].Values, "email"); got != "<NULL>" {
+		t.Errorf("email = %q, want 按策略保留A的NULL", got)
+	}
+	if m.stats.NullAutoFilled != 0 || m.stats.Conflict != 1 {
+		t.Errorf("NullAutoFilled = %d, Conflict = %d, want 0, 1", m.stats.NullAutoFilled, m.stats.Conflict)
+	}
+
+	// 默认策略下自动填充，不经过策略
+	asked = nil
+	config.AutoFillPolicy = FillFromNonEmpty
+	rows, _ = mergeMem(t, config, cols, cols, dataA, dataB)
+	if len(asked) != 0 || value(rows[0].Values, "email") != "b@x.com" {
+		t.Errorf("FillFromNonEmpty: asked = %v, email = %q", asked, value(rows[0].Values, "email"))
+	}
+}
+
+func TestConnConfigDSN(t *testing.T) {
+	conn := &ConnConfig{Host: "db.local", User: "app", Password: "p@ss:w/d", Database: "crm",
+		ParseTime: true, Params: map[string]string{"loc": "Local"}}
+	dsn, err := NewMerger(MergeConfig{Conn: conn}).dsn()
+	if err != nil {
+		t.Fatalf("dsn: %v", err)
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatalf("ParseDSN(%q): %v", dsn, err)
+	}
+	if cfg.User != "app" || cfg.Passwd != "p@ss:w/d" || cfg.Net != "tcp" || cfg.Addr != "db.local:3306" ||
+		cfg.DBName != "crm" || !cfg.ParseTime || cfg.Loc != time.Local {
+		t.Errorf("解析结果 = %+v", cfg)
+	}
+	if !strings.Contains(dsn, "charset=utf8mb4") {
+		t.Errorf("DSN %q 缺少默认字符集", dsn)
+	}
+
+	// DSN 优先于 Conn
+	if got, _ := NewMerger(MergeConfig{DSN: "u:p@tcp(h:3306)/x", Conn: conn}).dsn(); got != "u:p@tcp(h:3306)/x" {
+		t.Errorf("dsn = %q, want 使用 DSN", got)
+	}
+	for _, c := range []ConnConfig{
+		{User: "app", Database: "crm"},
+		{Host: "db.local", Database: "crm"},
+		{Host: "db.local", User: "app"},
+		{Host: "db.local", User: "app", Database: "crm", Port: 70000},
+	} {
+		if _, err := c.FormatDSN(); err == nil {
+			t.Errorf("FormatDSN(%+v) 应返回错误", c)
+		}
+	}
+}
+
+func TestAutoMigrateCAddsNewSourceColumn(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"})
+	db.insert("b", vals{"k": "1", "name": "Tom"})
+	config := fakeConfig(db, "k")
+	config.AppendMode = true
+	config.AutoMigrateC = true
+	runFake(t, config)
+
+	// 上次运行后A、B表新增了 phone 列
+	for _, tb := range []string{"a", "b"} {
+		if err := db.alterTable("ALTER TABLE `" + tb + "` ADD COLUMN `phone` varchar(20) NULL DEFAULT NULL"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.insert("a", vals{"k": "2", "name": "Anna", "phone": "123"})
+	db.insert("b", vals{"k": "2", "name": "Anna", "phone": "123"})
+	runFake(t, config)
+
+	c := db.table("c")
+	if c.column("phone") == nil {
+		t.Fatal("C表未补充 phone 列")
+	}
+	if got := value(c.find("k", "2"), "phone"); got != "123" {
+		t.Errorf("k=2 phone = %q, want 123", got)
+	}
+}
+
+func TestNonAutoIncrementIDIsKept(t *testing.T) {
+	for _, byName := range []bool{false, true} {
+		db := newFakeSources(t, "seq int ai pk", "id varchar(10)", "k varchar(10)", "name varchar(50)")
+		db.insert("a", vals{"id": "A-1", "k": "1", "name": "Tom"})
+		db.insert("b", vals{"id": "A-1", "k": "1", "name": "Tom"})
+		config := fakeConfig(db, "k")
+		config.SurrogateKeyName = "row_id"
+		config.ExcludeIDByName = byName
+		runFake(t, config)
+
+		c := db.table("c")
+		if c.column("seq") != nil {
+			t.Errorf("ExcludeIDByName=%v: 自增列 seq 应被排除", byName)
+		}
+		if kept := c.column("id") != nil; kept == byName {
+			t.Errorf("ExcludeIDByName=%v: C表是否有 id 列 = %v", byName, kept)
+		}
+		if !byName {
+			if got := value(c.find("k", "1"), "id"); got != "A-1" {
+				t.Errorf("id = %q, want A-1", got)
+			}
+		}
+	}
+}
+
+func TestAskUserChoiceScriptedInput(t *testing.T) {
+	m := NewMerger(MergeConfig{LogLevel: LogSilent, InputReader: strings.NewReader("x\n b \r\nA")})
+	var got []ConflictStrategy
+	var answered []bool
+	out := captureStdout(t, func() {
+		for i := 0; i < 3; i++ {
+			choice, ok := m.askUserChoice([]string{"name"}, &rowData{}, &rowData{})
+			got, answered = append(got, choice), append(answered, ok)
+		}
+	})
+	// 无效输入后重新询问；最后一行没有换行符也能读取；输入读完后默认以A为准且视为未回答
+	if want := []ConflictStrategy{UseB, UseA, UseA}; !reflect.DeepEqual(got, want) {
+		t.Errorf("选择 = %v, want %v", got, want)
+	}
+	if want := []bool{true, true, false}; !reflect.DeepEqual(answered, want) {
+		t.Errorf("answered = %v, want %v", answered, want)
+	}
+	if !strings.Contains(out, `无效输入 "X"`) {
+		t.Errorf("输出中缺少无效输入提示: %s", out)
+	}
+}
+
+func TestStrategyChainFallsThrough(t *testing.T) {
+	cols := textCols("k", "version", "name", "email")
+	dataA := []rowData{
+		row("k", "1", "version", "2", "name", "a1", "email", "a@x.com"),
+		row("k", "2", "version", "1", "name", "a2", "email", nil),
+		row("k", "3", "version", "1", "name", "a3", "email", "a@x.com"),
+	}
+	dataB := []rowData{
+		row("k", "1", "version", "1", "name", "b1", "email", "b@x.com"),
+		row("k", "2", "version", "1", "name", "b2", "email", "b@x.com"),
+		row("k", "3", "version", "1", "name", "b3", "email", "b@x.com"),
+	}
+	config := MergeConfig{KeyFields: []string{"k"}, VersionField: "version", AutoFillPolicy: Never,
+		StrategyChain: []ConflictStrategy{PreferNewer, PreferNonNull, UseB}}
+	rows, m := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	// k=1 A版本较新；k=2 版本相同，B非空值较多；k=3 前两个策略都弃权，由 UseB 决定
+	for k, want := range map[string]string{"1": "a1", "2": "b2", "3": "b3"} {
+		if r := findRow(rows, "k", k); r == nil || value(r.Values, "name") != want {
+			t.Errorf("k=%s name 应为 %s", k, want)
+		}
+	}
+	if m.stats.ConflictUseA != 1 || m.stats.ConflictUseB != 2 {
+		t.Errorf("ConflictUseA = %d, ConflictUseB = %d, want 1, 2", m.stats.ConflictUseA, m.stats.ConflictUseB)
+	}
+}
+
+func TestSeparateConnectionForB(t *testing.T) {
+	dbA, dbB := newFakeDB(t), newFakeDB(t)
+	dbA.create("a", "k varchar(10)", "name varchar(50)")
+	dbB.create("b", "k varchar(10)", "name varchar(50)", "phone varchar(20)")
+	dbA.insert("a", vals{"k": "1", "name": "Tom"})
+	dbB.insert("b", vals{"k": "1", "name": "Tom", "phone": "123"}, vals{"k": "2", "name": "Anna"})
+	config := fakeConfig(dbA, "k")
+	config.DSN = ""
+	config.DSNA, config.DSNB, config.DSNC = dbA.dsn, dbB.dsn, dbA.dsn
+	runFake(t, config)
+
+	// B表的列信息和数据都从B的连接读取，A的连接上没有访问B表
+	if len(dbB.statements("FROM `b`")) == 0 || len(dbB.statements("INFORMATION_SCHEMA.COLUMNS")) == 0 {
+		t.Error("B表未从第二个连接读取")
+	}
+	for _, s := range dbA.log {
+		if len(s.args) > 0 && s.args[0] == "b" || strings.Contains(s.query, "`b`") {
+			t.Errorf("A的连接上执行了B表的语句: %s %v", s.query, s.args)
+		}
+	}
+	if len(dbB.statements("CREATE TABLE")) != 0 {
+		t.Error("C表不应写入B的连接")
+	}
+	if dbA.table("c").find("k", "2") == nil {
+		t.Error("C表缺少仅在B表中的记录 k=2")
+	}
+}
+
+func TestQuietConflictsSuppressesConflictOutput(t *testing.T) {
+	cols := textCols("k", "name")
+	dataA := []rowData{row("k", "1", "name", "Tom"), row("k", "2", "name", "Anna")}
+	dataB := []rowData{row("k", "1", "name", "Tomas"), row("k", "2", "name", "Anne")}
+	run := func(quiet bool) (string, *Merger) {
+		m := NewMerger(MergeConfig{KeyFields: []string{"k"}, Strategy: UseA, QuietConflicts: quiet, LogLevel: LogInfo})
+		m.columnsA, m.columnsB = cols, cols
+		if err := m.initFields(); err != nil {
+			t.Fatal(err)
+		}
+		out := captureStdout(t, func() {
+			if _, err := m.mergeRows(dataA, dataB); err != nil {
+				t.Error(err)
+			}
+		})
+		return out, m
+	}
+
+	out, _ := run(false)
+	if !strings.Contains(out, "Tomas") {
+		t.Fatalf("未开启 QuietConflicts 时应打印冲突详情: %s", out)
+	}
+	out, m := run(true)
+	if strings.Contains(out, "Tomas") || strings.Contains(out, "Anne") {
+		t.Errorf("开启 QuietConflicts 后仍打印了冲突详情: %s", out)
+	}
+	if m.stats.Conflict != 2 || m.stats.ConflictUseA != 2 {
+		t.Errorf("Conflict = %d, ConflictUseA = %d, want 2, 2", m.stats.Conflict, m.stats.ConflictUseA)
+	}
+}
+
+func TestBOnlyFillDefault(t *testing.T) {
+	colsA := textCols("k", "name", "status", "note")
+	colsA[2].ColumnDefault = sql.NullString{String: "active", Valid: true}
+	colsB := textCols("k", "name")
+	dataB := []rowData{row("k", "1", "name", "Tom")}
+
+	rows, _ := mergeMem(t, MergeConfig{KeyFields: []string{"k"}, BOnlyFillPolicy: BOnlyFillDefault}, colsA, colsB, nil, dataB)
+	if got := value(rows[0].Values, "status"); got != "active" {
+		t.Errorf("Default: status = %q, want A表列默认值 active", got)
+	}
+	if got := value(rows[0].Values, "note"); got != "<NULL>" {
+		t.Errorf("Default: 无默认值的 note = %q, want NULL", got)
+	}
+
+	rows, _ = mergeMem(t, MergeConfig{KeyFields: []string{"k"}}, colsA, colsB, nil, dataB)
+	if got := value(rows[0].Values, "status"); got != "<NULL>" {
+		t.Errorf("Null: status = %q, want NULL", got)
+	}
+}
+
+func TestDiffFieldsJSONRoundTrip(t *testing.T) {
+	cols := textCols("k", "name", "a,b")
+	dataA := []rowData{row("k", "1", "name", "Tom", "a,b", "1")}
+	dataB := []rowData{row("k", "1", "name", "Tomas", "a,b", "2")}
+	config := MergeConfig{KeyFields: []string{"k"}, DiffFieldsFormat: DiffFieldsJSON, DiffFieldsColumnType: "JSON"}
+	rows, m := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	var fields []string
+	if err := json.Unmarshal([]byte(value(rows[0].Values, "_diff_fields")), &fields); err != nil {
+		t.Fatalf("_diff_fields 不是合法的JSON: %v", err)
+	}
+	if want := []string{"name", "a,b"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("_diff_fields = %v, want %v", fields, want)
+	}
+	if def := m.metaColumnDef("_diff_fields"); !strings.HasPrefix(def, "`_diff_fields` JSON NULL") {
+		t.Errorf("_diff_fields 列定义 = %s", def)
+	}
+}
+
+func TestTombstoneTableExcludesKey(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"})
+	db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"}, vals{"k": "3", "name": "Lily"})
+	db.create("t", "k varchar(10)", "deleted_at datetime")
+	db.insert("t", vals{"k": "2"}, vals{"k": "3"})
+	config := fakeConfig(db, "k")
+	config.TombstoneTable = "t"
+	stats, _ := runFake(t, config)
+
+	c := db.table("c")
+	if c.find("k", "1") == nil {
+		t.Error("C表缺少 k=1")
+	}
+	if c.find("k", "2") != nil || c.find("k", "3") != nil {
+		t.Error("墓碑表中的 k=2、k=3 不应写入C表")
+	}
+	if stats.Tombstoned != 2 || stats.TotalC != 1 {
+		t.Errorf("Tombstoned = %d, TotalC = %d, want 2, 1", stats.Tombstoned, stats.TotalC)
+	}
+	// 只读取墓碑表的关键字段
+	for _, s := range db.statements("FROM `t`") {
+		if strings.Contains(s.query, "deleted_at") || strings.Contains(s.query, "*") {
+			t.Errorf("读取墓碑表的语句 = %s, want 只读取关键字段", s.query)
+		}
+	}
+}
+
+func TestEstimateMemory(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	for i := 0; i < 30; i++ {
+		db.insert("a", vals{"k": fmt.Sprint(i), "name": "name-" + fmt.Sprint(i)})
+		if i < 20 {
+			db.insert("b", vals{"k": fmt.Sprint(i), "name": "name-" + fmt.Sprint(i)})
+		}
+	}
+	config := fakeConfig(db, "k")
+	config.MemoryLimit = 1 << 20
+	result, err := NewMerger(config).EstimateMemory()
+	if err != nil {
+		t.Fatalf("EstimateMemory: %v", err)
+	}
+	if result.RowsA != 30 || result.RowsB != 20 || result.AvgRowBytesA <= 0 || result.AvgRowBytesB <= 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	if want := estimatePeakBytes(30, 20, result.AvgRowBytesA, result.AvgRowBytesB); result.EstimatedBytes != want {
+		t.Errorf("EstimatedBytes = %d, want %d", result.EstimatedBytes, want)
+	}
+	if result.ExceedsLimit {
+		t.Errorf("预估 %d 字节未超过上限 %d", result.EstimatedBytes, result.Limit)
+	}
+
+	config.MemoryLimit = result.EstimatedBytes - 1
+	if result, err = NewMerger(config).EstimateMemory(); err != nil || !result.ExceedsLimit {
+		t.Errorf("上限低于预估值时 ExceedsLimit = %v, err = %v", result.ExceedsLimit, err)
+	}
+	if len(db.statements("CREATE TABLE")) != 0 {
+		t.Error("EstimateMemory 不应创建C表")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	config := fakeConfig(db, "k")
+	if err := NewMerger(config).SelfTest(); err != nil {
+		t.Fatalf("SelfTest: %v", err)
+	}
+	if len(db.statements("CREATE TABLE")) != 1 || len(db.statements("DROP TABLE")) != 1 || len(db.tables) != 2 {
+		t.Errorf("应创建并删除一个临时表，当前表: %v", db.tables)
+	}
+
+	config.TableB = "missing"
+	err := NewMerger(config).SelfTest()
+	if err == nil || !strings.Contains(err.Error(), "读取B表(missing)结构") {
+		t.Errorf("B表不存在时 SelfTest = %v, want 指明B表结构检查失败", err)
+	}
+
+	// 没有建表权限
+	config.TableB = "b"
+	db.hook = func(ctx context.Context, query string) error {
+		if strings.HasPrefix(query, "CREATE TABLE") {
+			return errors.New("Error 1142: CREATE command denied")
+		}
+		return nil
+	}
+	err = NewMerger(config).SelfTest()
+	if err == nil || !strings.Contains(err.Error(), "创建并删除临时表") || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("无建表权限时 SelfTest = %v", err)
+	}
+}
+
+func TestBooleanAwareCompare(t *testing.T) {
+	cols := textCols("k", "active")
+	cols[1].DataType, cols[1].ColumnType = "tinyint", "tinyint(1)"
+	dataA := []rowData{row("k", "1", "active", "1"), row("k", "2", "active", "0"), row("k", "3", "active", "1")}
+	dataB := []rowData{row("k", "1", "active", "true"), row("k", "2", "active", "FALSE"), row("k", "3", "active", "false")}
+	_, m := mergeMem(t, MergeConfig{KeyFields: []string{"k"}, BooleanAwareCompare: true}, cols, cols, dataA, dataB)
+	if m.stats.ExactMatch != 2 || m.stats.Conflict != 1 {
+		t.Errorf("ExactMatch = %d, Conflict = %d, want 2, 1", m.stats.ExactMatch, m.stats.Conflict)
+	}
+
+	// 自定义真/假值
+	dataA = []rowData{row("k", "1", "active", "1")}
+	dataB = []rowData{row("k", "1", "active", "是")}
+	config := MergeConfig{KeyFields: []string{"k"}, BooleanAwareCompare: true, TruthyValues: []string{"1", "是"}, FalsyValues: []string{"0", "否"}}
+	if _, m = mergeMem(t, config, cols, cols, dataA, dataB); m.stats.ExactMatch != 1 {
+		t.Errorf("自定义真值: ExactMatch = %d, want 1", m.stats.ExactMatch)
+	}
+
+	// 未开启时按字符串对比
+	dataB = []rowData{row("k", "1", "active", "true")}
+	if _, m = mergeMem(t, MergeConfig{KeyFields: []string{"k"}}, cols, cols, dataA, dataB); m.stats.Conflict != 1 {
+		t.Errorf("未开启 BooleanAwareCompare: Conflict = %d, want 1", m.stats.Conflict)
+	}
+}
+
+func TestStaticExtraColumn(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"})
+	db.insert("b", vals{"k": "2", "name": "Anne"}, vals{"k": "3", "name": "Lily"})
+	config := fakeConfig(db, "k")
+	config.ExtraColumns = map[string]string{"batch_id": "20261015-01"}
+	runFake(t, config)
+
+	c := db.table("c")
+	if c.column("batch_id") == nil {
+		t.Fatal("C表缺少附加列 batch_id")
+	}
+	if len(c.rows) != 3 {
+		t.Fatalf("C表 %d 行, want 3", len(c.rows))
+	}
+	for _, r := range c.rows {
+		if got := value(r, "batch_id"); got != "20261015-01" {
+			t.Errorf("k=%s batch_id = %q, want 20261015-01", value(r, "k"), got)
+		}
+	}
+}
+
+func TestEnumViolationFromB(t *testing.T) {
+	cols := textCols("k", "level")
+	cols[1].DataType, cols[1].ColumnType = "enum", "enum('low','high')"
+	dataA := []rowData{row("k", "1", "level", "low")}
+	dataB := []rowData{row("k", "1", "level", "low"), row("k", "2", "level", "medium"), row("k", "3", "level", "HIGH")}
+	rows, m := mergeMem(t, MergeConfig{KeyFields: []string{"k"}}, cols, cols, dataA, dataB)
+	if len(rows) != 3 || m.stats.EnumViolations != 1 {
+		t.Errorf("结果 %d 行, EnumViolations = %d, want 3, 1", len(rows), m.stats.EnumViolations)
+	}
+
+	m = newMemMerger(t, MergeConfig{KeyFields: []string{"k"}, StrictEnum: true}, cols, cols)
+	if _, err := m.mergeRows(dataA, dataB); err == nil || !strings.Contains(err.Error(), `level="medium"(key=2)`) {
+		t.Errorf("StrictEnum: mergeRows = %v, want 指出越界值", err)
+	}
+}
+
+func TestOrderSourcesByKeyStableConflictNumbers(t *testing.T) {
+	// 两次运行时数据库返回记录的顺序不同（模拟没有 ORDER BY 时不保证的扫描顺序）
+	run := func(keys []string) []string {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+		for _, k := range keys {
+			db.insert("a", vals{"k": k, "name": "a" + k})
+			db.insert("b", vals{"k": k, "name": "b" + k})
+		}
+		config := fakeConfig(db, "k")
+		config.OrderSourcesByKey = true
+		config.LogLevel = LogInfo
+		out := captureStdout(t, func() { runFake(t, config) })
+		if len(db.statements("ORDER BY `k`")) < 2 {
+			t.Errorf("读取A、B表时应按关键字段排序")
+		}
+		var numbering []string
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, "[冲突 #") {
+				numbering = append(numbering, line)
+			}
+		}
+		return numbering
+	}
+	first := run([]string{"3", "1", "2"})
+	second := run([]string{"2", "3", "1"})
+	if len(first) != 3 || !reflect.DeepEqual(first, second) {
+		t.Errorf("两次运行的冲突编号不同:\n%v\n%v", first, second)
+	}
+}
+
+func TestSummarizeMatchesRun(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "email varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom", "email": "t@x.com"}, vals{"k": "2", "name": "Anna", "email": nil},
+		vals{"k": "3", "name": "Lily", "email": "l@x.com"}, vals{"k": "4", "name": "Jack", "email": "j@x.com"})
+	db.insert("b", vals{"k": "1", "name": "Tom", "email": "t@x.com"}, vals{"k": "2", "name": "Anna", "email": "a@x.com"},
+		vals{"k": "3", "name": "Lilly", "email": "l@x.com"}, vals{"k": "5", "name": "Rose", "email": nil})
+	config := fakeConfig(db, "k")
+
+	summary, err := NewMerger(config).Summarize()
+	if err != nil {
+		t.Fatalf("Summarize: %v", err)
+	}
+	if len(db.statements("CREATE TABLE")) != 0 || len(db.statements("INSERT")) != 0 {
+		t.Error("Summarize 不应读写C表")
+	}
+	stats, _ := runFake(t, config)
+	got := [6]int{summary.TotalA, summary.TotalB, summary.ExactMatch, summary.OnlyInA, summary.OnlyInB, summary.Conflict}
+	want := [6]int{stats.TotalA, stats.TotalB, stats.ExactMatch, stats.OnlyInA, stats.OnlyInB, stats.Conflict}
+	if got != want || want != [6]int{4, 4, 1, 1, 1, 2} {
+		t.Errorf("Summarize = %v, Run = %v", got, want)
+	}
+}
+
+func TestRecreateTableCDropsViewOrTable(t *testing.T) {
+	newDB := func() *fakeDB {
+		db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+		db.insert("a", vals{"k": "1", "name": "Tom"})
+		return db
+	}
+
+	// 已存在同名视图，未开启 DropViewC 时报错且不删除
+	db := newDB()
+	db.view("c")
+	config := fakeConfig(db, "k")
+	_, err := NewMerger(config).Run()
+	if err == nil || !strings.Contains(err.Error(), "视图") || !strings.Contains(err.Error(), "DropViewC") {
+		t.Errorf("Run = %v, want 提示C表为视图", err)
+	}
+	if len(db.statements("DROP")) != 0 {
+		t.Errorf("未开启 DropViewC 时不应执行 DROP: %v", db.statements("DROP"))
+	}
+
+	// 开启 DropViewC 时使用 DROP VIEW
+	config.DropViewC = true
+	runFake(t, config)
+	if drops := db.statements("DROP"); len(drops) != 1 || drops[0].query != "DROP VIEW IF EXISTS `c`" {
+		t.Errorf("DROP 语句 = %v, want DROP VIEW", drops)
+	}
+	if c := db.table("c"); c.view || c.find("k", "1") == nil {
+		t.Error("C表应重新创建为表并写入数据")
+	}
+
+	// 已存在同名表时使用 DROP TABLE
+	db = newDB()
+	db.create("c", "k varchar(10)")
+	runFake(t, fakeConfig(db, "k"))
+	if drops := db.statements("DROP"); len(drops) != 1 || drops[0].query != "DROP TABLE IF EXISTS `c`" {
+		t.Errorf("DROP 语句 = %v, want DROP TABLE", drops)
+	}
+}
+
+func TestRecordResolutionMixedWinners(t *testing.T) {
+	cols := textCols("k", "name", "email", "phone")
+	dataA := []rowData{row("k", "1", "name", "Tom", "email", nil, "phone", "1"), row("k", "2", "name", "Anna", "email", "a@x.com", "phone", "2")}
+	dataB := []rowData{row("k", "1", "name", "Tomas", "email", "t@x.com", "phone", "1"), row("k", "2", "name", "Anne", "email", "a@x.com", "phone", "3")}
+	config := MergeConfig{KeyFields: []string{"k"}, RecordResolution: true, Strategy: UseResolver,
+		ConflictResolver: func(key string, diffFields []string, rowA, rowB Row) (ConflictStrategy, error) {
+			if key == "1" {
+				return UseB, nil
+			}
+			return UseA, nil
+		}}
+	rows, _ := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	want := map[string]map[string]string{
+		"1": {"name": "B", "email": "auto"},
+		"2": {"name": "A", "phone": "A"},
+	}
+	for k, w := range want {
+		r := findRow(rows, "k", k)
+		var got map[string]string
+		if err := json.Unmarshal([]byte(value(r.Values, "_resolution")), &got); err != nil {
+			t.Fatalf("k=%s _resolution 不是合法的JSON: %v", k, err)
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("k=%s _resolution = %v, want %v", k, got, w)
+		}
+	}
+}
+
+func TestReadWriteDSNRouting(t *testing.T) {
+	replica := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	replica.insert("a", vals{"k": "1", "name": "Tom"})
+	replica.insert("b", vals{"k": "2", "name": "Anna"})
+	primary := newFakeDB(t)
+	config := fakeConfig(replica, "k")
+	config.DSN = ""
+	config.ReadDSN, config.WriteDSN = replica.dsn, primary.dsn
+	runFake(t, config)
+
+	if len(replica.statements("FROM `a`")) == 0 || len(replica.statements("FROM `b`")) == 0 {
+		t.Error("A、B表应从 ReadDSN 读取")
+	}
+	for _, s := range []string{"CREATE", "DROP", "INSERT"} {
+		if n := len(replica.statements(s)); n != 0 {
+			t.Errorf("ReadDSN 上执行了 %d 条 %s 语句", n, s)
+		}
+	}
+	// C表的结构查询和写入使用 WriteDSN
+	var introspected bool
+	for _, s := range primary.statements("INFORMATION_SCHEMA") {
+		for _, arg := range s.args {
+			introspected = introspected || arg == "c"
+		}
+	}
+	if !introspected {
+		t.Error("C表的结构应在 WriteDSN 上查询")
+	}
+	if c := primary.table("c"); c == nil || len(c.rows) != 2 {
+		t.Error("C表应写入 WriteDSN")
+	}
+}
+
+func TestPreInsertComputedColumn(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "city varchar(50)", "street varchar(50)")
+	db.insert("a", vals{"k": "1", "city": "hangzhou", "street": " west lake rd "})
+	db.insert("b", vals{"k": "2", "city": "ningbo", "street": "main st"})
+	config := fakeConfig(db, "k")
+	config.ExtraColumns = map[string]string{"address": ""}
+	var sources []string
+	config.PreInsert = func(row map[string]*string, source string) error {
+		sources = append(sources, source)
+		row["address"] = strPtr(strings.ToUpper(strings.TrimSpace(*row["street"]) + ", " + *row["city"]))
+		return nil
+	}
+	runFake(t, config)
+
+	c := db.table("c")
+	for k, want := range map[string]string{"1": "WEST LAKE RD, HANGZHOU", "2": "MAIN ST, NINGBO"} {
+		if got := value(c.find("k", k), "address"); got != want {
+			t.Errorf("k=%s address = %q, want %q", k, got, want)
+		}
+	}
+	if !reflect.DeepEqual(sources, []string{"A", "B"}) {
+		t.Errorf("PreInsert 收到的 source = %v, want [A B]", sources)
+	}
+
+	// 回调返回错误时中止且不写入
+	db = newFakeSources(t, "k varchar(10)", "city varchar(50)", "street varchar(50)")
+	db.insert("a", vals{"k": "1", "city": "hangzhou", "street": "x"})
+	config = fakeConfig(db, "k")
+	config.PreInsert = func(map[string]*string, string) error { return errors.New("bad address") }
+	if _, err := NewMerger(config).Run(); err == nil || !strings.Contains(err.Error(), "bad address") {
+		t.Errorf("Run = %v, want PreInsert 的错误", err)
+	}
+	if len(db.statements("INSERT")) != 0 {
+		t.Error("PreInsert 返回错误时不应写入C表")
+	}
+}
+
+func TestKeyFilterSingleKey(t *testing.T) {
+	db := newFakeSources(t, "k1 varchar(10)", "k2 varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k1": "1", "k2": "x", "name": "Tom"}, vals{"k1": "1", "k2": "y", "name": "Anna"},
+		vals{"k1": "2", "k2": "x", "name": "Lily"})
+	db.insert("b", vals{"k1": "1", "k2": "x", "name": "Tomas"}, vals{"k1": "2", "k2": "y", "name": "Rose"})
+	config := fakeConfig(db, "k1", "k2")
+	config.KeyFilter = []map[string]string{{"k1": "1", "k2": "x"}}
+	stats, _ := runFake(t, config)
+
+	c := db.table("c")
+	if len(c.rows) != 1 || value(c.rows[0], "k1") != "1" || value(c.rows[0], "k2") != "x" {
+		t.Fatalf("C表 = %v, want 只有 k1=1,k2=x", c.rows)
+	}
+	if stats.TotalA != 1 || stats.TotalB != 1 || stats.Conflict != 1 {
+		t.Errorf("TotalA = %d, TotalB = %d, Conflict = %d, want 1, 1, 1", stats.TotalA, stats.TotalB, stats.Conflict)
+	}
+	// 过滤条件在数据库中执行
+	for _, tb := range []string{"a", "b"} {
+		if len(db.statements("FROM `"+tb+"` WHERE")) == 0 {
+			t.Errorf("读取%s表时应带 WHERE 条件", tb)
+		}
+	}
+}
+
+func TestStatsTableRow(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"}, vals{"k": "3", "name": "Lily"})
+	db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anne"}, vals{"k": "4", "name": "Rose"})
+	config := fakeConfig(db, "k")
+	config.StatsTable = "merge_stats"
+	stats, _ := runFake(t, config)
+	runFake(t, config)
+
+	st := db.table("merge_stats")
+	if st == nil || len(st.rows) != 2 {
+		t.Fatal("每次运行应在统计表中写入一行")
+	}
+	r := st.rows[0]
+	want := map[string]string{"run_id": stats.RunID, "table_a": "a", "table_b": "b", "table_c": "c",
+		"total_a": "3", "total_b": "3", "total_c": "4", "exact_match": "1", "only_in_a": "1", "only_in_b": "1",
+		"conflict": "1", "conflict_use_a": "1", "conflict_use_b": "0"}
+	for f, w := range want {
+		if got := value(r, f); got != w {
+			t.Errorf("%s = %q, want %q", f, got, w)
+		}
+	}
+	if value(r, "start_time") == "<NULL>" || value(r, "end_time") == "<NULL>" {
+		t.Error("统计行缺少开始/结束时间")
+	}
+	if value(st.rows[1], "run_id") == stats.RunID {
+		t.Error("两次运行的 run_id 应不同")
+	}
+}
+
+func TestCompareButNotOutputFields(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "id_card varchar(20)")
+	db.insert("a", vals{"k": "1", "name": "Tom", "id_card": "110"}, vals{"k": "2", "name": "Anna", "id_card": "220"})
+	db.insert("b", vals{"k": "1", "name": "Tom", "id_card": "111"}, vals{"k": "2", "name": "Anna", "id_card": "220"})
+	config := fakeConfig(db, "k")
+	config.CompareButNotOutputFields = []string{"id_card"}
+	stats, _ := runFake(t, config)
+
+	// id_card 参与对比，k=1 计为冲突
+	if stats.Conflict != 1 || stats.ExactMatch != 1 {
+		t.Errorf("Conflict = %d, ExactMatch = %d, want 1, 1", stats.Conflict, stats.ExactMatch)
+	}
+	c := db.table("c")
+	if c.column("id_card") != nil {
+		t.Error("id_card 不应出现在C表结构中")
+	}
+	for _, s := range db.statements("INSERT INTO `c`") {
+		if strings.Contains(s.query, "id_card") {
+			t.Errorf("写入C表的语句包含 id_card: %s", s.query)
+		}
+	}
+	if got := value(c.find("k", "1"), "_diff_fields"); got != "id_card" {
+		t.Errorf("k=1 _diff_fields = %q, want id_card", got)
+	}
+}
+
+func TestConsistentReadUsesOneTransaction(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"})
+	db.insert("b", vals{"k": "1", "name": "Tomas"})
+	config := fakeConfig(db, "k")
+	config.ConsistentRead = true
+	runFake(t, config)
+
+	begin, commit, conn := -1, -1, -1
+	for i, s := range db.log {
+		switch {
+		case strings.HasPrefix(s.query, "START TRANSACTION WITH CONSISTENT SNAPSHOT"):
+			begin, conn = i, s.conn
+		case s.query == "COMMIT" && begin >= 0 && s.conn == conn && commit < 0:
+			commit = i
+		}
+	}
+	if begin < 0 || commit < 0 {
+		t.Fatalf("未找到一致性读事务: begin=%d commit=%d", begin, commit)
+	}
+	// A、B表的数据都在同一个连接的事务中读取
+	reads := 0
+	for i, s := range db.log {
+		if !strings.HasPrefix(s.query, "SELECT") || (!strings.Contains(s.query, "FROM `a`") && !strings.Contains(s.query, "FROM `b`")) {
+			continue
+		}
+		reads++
+		if s.conn != conn || i < begin || i > commit {
+			t.Errorf("读取语句不在一致性读事务中: %s", s.query)
+		}
+	}
+	if reads < 2 {
+		t.Errorf("事务中只有 %d 条读取语句, want 至少2条", reads)
+	}
+
+	dbB := newFakeDB(t)
+	dbB.create("b", "k varchar(10)", "name varchar(50)")
+	config.DSNB = dbB.dsn
+	if _, err := NewMerger(config).Run(); err == nil || !strings.Contains(err.Error(), "ConsistentRead") {
+		t.Errorf("A、B表使用不同连接时 Run = %v, want ConsistentRead 错误", err)
+	}
+}
+
+func TestEmptyKeyExcludeCountsAsOnlyIn(t *testing.T) {
+	cols := textCols("k1", "k2", "name")
+	dataA := []rowData{row("k1", "1", "k2", "", "name", "Tom"), row("k1", "2", "k2", "x", "name", "Anna"),
+		row("k1", "", "k2", "", "name", "Lily")}
+	dataB := []rowData{row("k1", "1", "k2", "", "name", "Tomas"), row("k1", "2", "k2", "x", "name", "Anna"),
+		row("k1", "", "k2", "", "name", "Rose")}
+	config := MergeConfig{KeyFields: []string{"k1", "k2"}, EmptyKeyPolicy: EmptyKeyExclude}
+	rows, m := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	// 关键字段为空的记录不参与匹配，各自计为仅在A/B表中
+	if s := m.stats; s.ExactMatch != 1 || s.Conflict != 0 || s.OnlyInA != 2 || s.OnlyInB != 2 {
+		t.Errorf("ExactMatch = %d, Conflict = %d, OnlyInA = %d, OnlyInB = %d, want 1, 0, 2, 2",
+			s.ExactMatch, s.Conflict, s.OnlyInA, s.OnlyInB)
+	}
+	if len(rows) != 5 {
+		t.Errorf("结果 %d 行, want 5", len(rows))
+	}
+
+	config.EmptyKeyPolicy = EmptyKeyError
+	m = newMemMerger(t, config, cols, cols)
+	if err := m.checkEmptyKeys("A", dataA); err == nil || !strings.Contains(err.Error(), "k2") {
+		t.Errorf("EmptyKeyError: checkEmptyKeys = %v, want 指出空的关键字段", err)
+	}
+}
+
+func TestReplaceIntoUpdatesExistingKey(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"})
+	config := fakeConfig(db, "k")
+	config.AppendMode = true
+	config.NoSurrogateKey = true
+	config.InsertMode = ReplaceInto
+	runFake(t, config)
+
+	// 重跑时 k=1 的值变化，k=3 为新记录
+	db.table("a").find("k", "1")["name"] = strPtr("Tomas")
+	db.insert("a", vals{"k": "3", "name": "Lily"})
+	runFake(t, config)
+
+	if len(db.statements("REPLACE INTO `c`")) != 2 || len(db.statements("INSERT INTO `c`")) != 0 {
+		t.Error("写入C表应使用 REPLACE INTO")
+	}
+	c := db.table("c")
+	if len(c.rows) != 3 {
+		t.Fatalf("C表 %d 行, want 3（重复的key应被替换）", len(c.rows))
+	}
+	if got := value(c.find("k", "1"), "name"); got != "Tomas" {
+		t.Errorf("k=1 name = %q, want Tomas", got)
+	}
+}
+
+func TestResolverErrorPolicy(t *testing.T) {
+	cols := textCols("k", "name", "city")
+	var dataA, dataB []rowData
+	for _, k := range []string{"1", "2", "3"} {
+		dataA = append(dataA, row("k", k, "name", "a"+k, "city", "hz"))
+		dataB = append(dataB, row("k", k, "name", "b"+k, "city", "hz"))
+	}
+	resolver := func(key string, diffFields []string, rowA, rowB Row) (ConflictStrategy, error) {
+		if rowA["city"] == nil || rowB["city"] == nil {
+			t.Errorf("key=%s: 解析器应收到完整的行", key)
+		}
+		if key == "2" {
+			return UseA, errors.New("service unavailable")
+		}
+		return UseB, nil
+	}
+
+	// 默认中止
+	m := newMemMerger(t, MergeConfig{KeyFields: []string{"k"}, Strategy: UseResolver, ConflictResolver: resolver}, cols, cols)
+	if _, err := m.mergeRows(dataA, dataB); err == nil || !strings.Contains(err.Error(), "key[2]") ||
+		!strings.Contains(err.Error(), "service unavailable") {
+		t.Errorf("ResolverErrorAbort: mergeRows = %v", err)
+	}
+
+	// 跳过：弃权后由策略链中的下一个策略决定
+	config := MergeConfig{KeyFields: []string{"k"}, StrategyChain: []ConflictStrategy{UseResolver, UseA},
+		ConflictResolver: resolver, ResolverErrorPolicy: ResolverErrorSkip}
+	rows, _ := mergeMem(t, config, cols, cols, dataA, dataB)
+	for k, want := range map[string]string{"1": "b1", "2": "a2", "3": "b3"} {
+		if got := value(findRow(rows, "k", k).Values, "name"); got != want {
+			t.Errorf("ResolverErrorSkip: k=%s name = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestModifiedSinceReadsOnlyModifiedRows(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "updated_at datetime")
+	old, recent := "2026-01-01 00:00:00", "2026-10-01 12:00:00"
+	db.insert("a", vals{"k": "1", "name": "Tom", "updated_at": old}, vals{"k": "2", "name": "Anna", "updated_at": recent},
+		vals{"k": "3", "name": "Lily", "updated_at": recent}, vals{"k": "4", "name": "Jack", "updated_at": old})
+	db.insert("b", vals{"k": "1", "name": "Tomas", "updated_at": old}, vals{"k": "2", "name": "Anne", "updated_at": old},
+		vals{"k": "3", "name": "Lily", "updated_at": recent}, vals{"k": "5", "name": "Rose", "updated_at": recent})
+	config := fakeConfig(db, "k")
+	config.IgnoreFieldsA = []string{"updated_at"}
+	config.ModifiedColumn = "updated_at"
+	config.ModifiedSince = time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	stats, _ := runFake(t, config)
+
+	// k=1、k=4 不在时间窗口内；k=2 只有A被修改，仍按key补读B表参与匹配
+	c := db.table("c")
+	if len(c.rows) != 3 || c.find("k", "1") != nil || c.find("k", "4") != nil {
+		t.Errorf("C表 = %v, want k=2,3,5", c.rows)
+	}
+	if stats.ExactMatch != 1 || stats.Conflict != 1 || stats.OnlyInA != 0 || stats.OnlyInB != 1 {
+		t.Errorf("ExactMatch = %d, Conflict = %d, OnlyInA = %d, OnlyInB = %d, want 1, 1, 0, 1",
+			stats.ExactMatch, stats.Conflict, stats.OnlyInA, stats.OnlyInB)
+	}
+	for _, tb := range []string{"a", "b"} {
+		if len(db.statements("FROM `"+tb+"` WHERE `updated_at` >= ?")) == 0 {
+			t.Errorf("读取%s表时应按 updated_at 过滤", tb)
+		}
+	}
+}
+
+func TestGenerateAlignmentDDLAddsMissingColumn(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)", "phone varchar(20)")
+	// 已存在的C表缺少 phone 列和 _diff_fields 元数据列
+	db.create("c", "id int ai pk", "k varchar(10)", "name varchar(50)", "_source varchar(10)", "_conflict tinyint(1)")
+	ddl, err := NewMerger(fakeConfig(db, "k")).GenerateAlignmentDDL()
+	if err != nil {
+		t.Fatalf("GenerateAlignmentDDL: %v", err)
+	}
+	want := []string{
+		"ALTER TABLE `c` ADD COLUMN `phone` varchar(20) NULL DEFAULT NULL",
+		"ALTER TABLE `c` ADD COLUMN `_diff_fields` TEXT NULL DEFAULT NULL COMMENT '不同的字段列表'",
+	}
+	if !reflect.DeepEqual(ddl, want) {
+		t.Errorf("DDL = %q, want %q", ddl, want)
+	}
+	// 只生成不执行
+	if len(db.statements("ALTER")) != 0 || db.table("c").column("phone") != nil {
+		t.Error("GenerateAlignmentDDL 不应执行 ALTER")
+	}
+	// 生成的语句可以直接执行
+	for _, stmt := range ddl {
+		if err := db.alterTable(stmt); err != nil {
+			t.Errorf("执行 %s: %v", stmt, err)
+		}
+	}
+	if ddl, err = NewMerger(fakeConfig(db, "k")).GenerateAlignmentDDL(); err != nil || len(ddl) != 0 {
+		t.Errorf("对齐后 DDL = %q, %v, want 空", ddl, err)
+	}
+}
+
+func TestCollapseWhitespaceKeepsAValue(t *testing.T) {
+	cols := textCols("k", "name")
+	dataA := []rowData{row("k", "1", "name", "John  Doe "), row("k", "2", "name", "Ann\tLee")}
+	dataB := []rowData{row("k", "1", "name", " John Doe"), row("k", "2", "name", "Ann Li")}
+	rows, m := mergeMem(t, MergeConfig{KeyFields: []string{"k"}, CollapseWhitespace: true}, cols, cols, dataA, dataB)
+	if m.stats.ExactMatch != 1 || m.stats.Conflict != 1 {
+		t.Errorf("ExactMatch = %d, Conflict = %d, want 1, 1", m.stats.ExactMatch, m.stats.Conflict)
+	}
+	// 只影响对比，C表保留A的原值
+	if got := value(findRow(rows, "k", "1").Values, "name"); got != "John  Doe " {
+		t.Errorf("k=1 name = %q, want A的原值", got)
+	}
+
+	if _, m = mergeMem(t, MergeConfig{KeyFields: []string{"k"}}, cols, cols, dataA, dataB); m.stats.Conflict != 2 {
+		t.Errorf("未开启 CollapseWhitespace: Conflict = %d, want 2", m.stats.Conflict)
+	}
+}
+
+func TestLogSilentWritesNothing(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": nil})
+	db.insert("b", vals{"k": "1", "name": "Tomas"}, vals{"k": "2", "name": "Anna"}, vals{"k": "3", "name": "Lily"})
+	config := fakeConfig(db, "k")
+	config.LogLevel = LogSilent
+	if out := captureStdout(t, func() { runFake(t, config) }); out != "" {
+		t.Errorf("LogSilent 时输出了 %d 字节: %s", len(out), out)
+	}
+
+	// LogError 时成功运行也不输出
+	config.LogLevel = LogError
+	if out := captureStdout(t, func() { runFake(t, config) }); out != "" {
+		t.Errorf("LogError 时成功运行输出了: %s", out)
+	}
+	// 对照：LogInfo 时有输出
+	config.LogLevel = LogInfo
+	if out := captureStdout(t, func() { runFake(t, config) }); out == "" {
+		t.Error("LogInfo 时应有输出")
+	}
+}
+
+func TestChangelogModeAgainstExistingC(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anne"}, vals{"k": "4", "name": "Rose"})
+	db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anne"}, vals{"k": "4", "name": "Rose"})
+	db.create("c", "k varchar(10)", "name varchar(50)")
+	db.insert("c", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"}, vals{"k": "3", "name": "Lily"})
+	config := fakeConfig(db, "k")
+	config.ChangelogMode = true
+	_, m := runFake(t, config)
+
+	// 新增 k=4、更新 k=2、删除 k=3，k=1 未变化
+	changes := m.Changes()
+	if len(changes) != 3 {
+		t.Fatalf("变更数 = %d, want 3: %+v", len(changes), changes)
+	}
+	byType := make(map[ChangeType]ChangeEvent)
+	for _, c := range changes {
+		byType[c.Type] = c
+	}
+	if c := byType[ChangeInsert]; value(c.NewValues, "k") != "4" || value(c.NewValues, "name") != "Rose" {
+		t.Errorf("insert = %+v, want k=4 Rose", c)
+	}
+	if c := byType[ChangeUpdate]; !reflect.DeepEqual(c.ChangedFields, []string{"name"}) ||
+		value(c.OldValues, "name") != "Anna" || value(c.NewValues, "name") != "Anne" {
+		t.Errorf("update = %+v, want k=2 name Anna -> Anne", c)
+	}
+	if c := byType[ChangeDelete]; value(c.OldValues, "k") != "3" || c.NewValues != nil {
+		t.Errorf("delete = %+v, want k=3", c)
+	}
+
+	// 变更写入 c_changelog，C表不变
+	logTable := db.table("c_changelog")
+	if logTable == nil {
+		t.Fatal("未创建变更日志表 c_changelog")
+	}
+	var types []string
+	for _, r := range logTable.rows {
+		types = append(types, value(r, "change_type"))
+	}
+	// 按结果顺序的 insert/update，随后是 delete
+	if want := []string{"update", "insert", "delete"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("change_type = %v, want %v", types, want)
+	}
+	c := db.table("c")
+	if len(c.rows) != 3 || value(c.find("k", "2"), "name") != "Anna" || c.find("k", "3") == nil {
+		t.Errorf("C表被改动: %d 行", len(c.rows))
+	}
+}
+
+func TestChangelogModeSkipsEmptyKeyRows(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "", "name": "Ghost"})
+	db.insert("b", vals{"k": "1", "name": "Tom"}, vals{"k": "", "name": "Ghost"})
+	db.create("c", "k varchar(10)", "name varchar(50)")
+	db.insert("c", vals{"k": "1", "name": "Tom"}, vals{"k": "", "name": "Ghost"})
+	config := fakeConfig(db, "k")
+	config.ChangelogMode = true
+	config.EmptyKeyPolicy = EmptyKeyExclude
+	_, m := runFake(t, config)
+
+	// 关键字段为空的记录不参与匹配，C表中已有的同一记录不应产生 delete+insert
+	if changes := m.Changes(); len(changes) != 0 {
+		t.Errorf("变更 = %+v, want 无变更", changes)
+	}
+	if tb := db.table("c_changelog"); tb == nil || len(tb.rows) != 0 {
+		t.Errorf("变更日志表应已创建且为空")
+	}
+}
+
+func TestEmptyKeyExcludeKeyIsStable(t *testing.T) {
+	m := newMemMerger(t, MergeConfig{KeyFields: []string{"k"}, EmptyKeyPolicy: EmptyKeyExclude}, textCols("k"), textCols("k"))
+	r1, r2 := row("k", ""), row("k", "")
+	key1, excluded := m.rowKey(&r1)
+	if !excluded {
+		t.Fatal("关键字段为空的记录应被排除")
+	}
+	// 同一记录每次得到相同的key，不依赖记录地址
+	if key2, _ := m.rowKey(&r2); key1 != key2 || key1 != m.buildKey(&r1) {
+		t.Errorf("key 不稳定: %q, %q", key1, key2)
+	}
+	if r := row("k", "1"); isExcludedKey(m.buildKey(&r)) {
+		t.Error("非空key不应被排除")
+	}
+}
@@ -0,0 +1,82 @@
+package reconciler
+
+import (
+	"strings"
+)
+
+// defaultOrphanSampleSize 每项引用检查默认保留的孤儿值样例数
+const defaultOrphanSampleSize = 10
+
+// ReferenceCheck 引用完整性检查：A表字段 Field 的值应当在B表字段 RefField 中存在（类似外键）
+type ReferenceCheck struct {
+	Field    string // A表中的引用字段
+	RefField string // B表中被引用的字段，通常为B表的关键字段
+}
+
+// OrphanReport 一项引用检查的结果
+type OrphanReport struct {
+	Field    string   // A表中的引用字段
+	RefField string   // B表中被引用的字段
+	Count    int      // 引用值在B表中不存在的A表记录数
+	Samples  []string // 不存在的引用值样例（去重，最多 OrphanSampleSize 个）
+}
+
+// Orphans 返回最近一次运行的引用完整性检查结果，与 ReferenceChecks 一一对应
+func (m *Merger) Orphans() []OrphanReport {
+	return m.orphans
+}
+
+// checkReferences 按 ReferenceChecks 检查A表记录引用的值是否在B表中存在；
+// 引用值为 NULL 或空字符串的记录不检查，孤儿只计入统计并打印警告，不影响合并
+func (m *Merger) checkReferences(dataA []rowData, bIndex rowIndex) error {
+	m.orphans = nil
+	if len(m.config.ReferenceChecks) == 0 {
+		return nil
+	}
+	sampleSize := m.config.OrphanSampleSize
+	if sampleSize <= 0 {
+		sampleSize = defaultOrphanSampleSize
+	}
+
+	// 收集B表中被引用字段的全部取值
+	refValues := make([]map[string]bool, len(m.config.ReferenceChecks))
+	for i := range refValues {
+		refValues[i] = make(map[string]bool)
+	}
+	err := bIndex.each(func(_ string, row *rowData) bool {
+		for i, rc := range m.config.ReferenceChecks {
+			if v := row.Values[rc.RefField]; v != nil {
+				refValues[i][*v] = true
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for i, rc := range m.config.ReferenceChecks {
+		report := OrphanReport{Field: rc.Field, RefField: rc.RefField}
+		sampled := make(map[string]bool)
+		for j := range dataA {
+			v := dataA[j].Values[rc.Field]
+			if isNullOrEmpty(v) || refValues[i][*v] {
+				continue
+			}
+			report.Count++
+			if !sampled[*v] && len(report.Samples) < sampleSize {
+				sampled[*v] = true
+				report.Samples = append(report.Samples, *v)
+			}
+		}
+		if report.Count > 0 {
+			m.infof("[警告] 引用检查 A.%s -> B.%s: %d 条记录引用的值在B表中不存在，例如: %s\n",
+				rc.Field, rc.RefField, report.Count, strings.Join(report.Samples, ", "))
+		}
+		total += report.Count
+		m.orphans = append(m.orphans, report)
+	}
+	m.setStats(func(s *MergeStats) { s.Orphans = total })
+	return nil
+}
@@ -0,0 +1,34 @@
+package reconciler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReferenceChecksCountOrphans(t *testing.T) {
+	cols := textCols("k", "parent_id")
+	dataA := []rowData{
+		row("k", "1", "parent_id", "10"),
+		row("k", "2", "parent_id", "20"),
+		row("k", "3", "parent_id", "20"),
+		row("k", "4", "parent_id", "30"),
+		row("k", "5", "parent_id", nil),
+	}
+	dataB := []rowData{row("k", "10", "parent_id", nil), row("k", "1", "parent_id", "10")}
+	config := MergeConfig{KeyFields: []string{"k"}, ReferenceChecks: []ReferenceCheck{{Field: "parent_id", RefField: "k"}},
+		OrphanSampleSize: 1}
+	rows, m := mergeMem(t, config, cols, cols, dataA, dataB)
+
+	// 引用 20、30 的记录在B表中没有对应的父记录；NULL 不检查
+	want := []OrphanReport{{Field: "parent_id", RefField: "k", Count: 3, Samples: []string{"20"}}}
+	if got := m.Orphans(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Orphans = %+v, want %+v", got, want)
+	}
+	if m.stats.Orphans != 3 {
+		t.Errorf("stats.Orphans = %d, want 3", m.stats.Orphans)
+	}
+	// 孤儿只做统计，不影响合并结果
+	if len(rows) != 6 {
+		t.Errorf("结果 %d 行, want 6", len(rows))
+	}
+}
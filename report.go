@@ -0,0 +1,128 @@
+package reconciler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ConflictRecord 一条冲突记录：关键字段相同但其他字段不同的A、B记录
+type ConflictRecord struct {
+	Key    string          // 关键字段拼接的key
+	Fields []ConflictField // 不同的字段（含已自动处理的字段）
+}
+
+// ConflictField 冲突中一个字段的A、B值，nil 表示 NULL
+type ConflictField struct {
+	Field string
+	A     *string
+	B     *string
+}
+
+// Conflicts 返回最近一次运行中收集的冲突记录
+func (m *Merger) Conflicts() []ConflictRecord {
+	return m.conflicts
+}
+
+// recordConflict 收集一条冲突记录，字段值按 displayField 转换为可读形式（二进制显示为十六进制）
+func (m *Merger) recordConflict(key string, rowA, rowB *rowData, diffFields []string) {
+	rec := ConflictRecord{Key: key, Fields: make([]ConflictField, len(diffFields))}
+	for i, f := range diffFields {
+		rec.Fields[i] = ConflictField{Field: f, A: m.displayPtr(f, rowA.Values[f])}
+		if v, ok := rowB.Values[f]; ok {
+			rec.Fields[i].B = m.displayPtr(f, v)
+		}
+	}
+	m.conflicts = append(m.conflicts, rec)
+}
+
+// displayPtr 二进制字段转换为可读形式，其余字段原样复制
+func (m *Merger) displayPtr(field string, v *string) *string {
+	if v != nil && m.binarySet[field] {
+		return strPtr(m.displayField(field, v))
+	}
+	return copyStringPtr(v)
+}
+
+// WriteTextReport 将收集的冲突写成列对齐的文本报告（每个不同的字段一行，同一冲突的key只在首行显示），
+// NULL 和空字符串分别显示为 <NULL>、<空字符串>，适合人工审阅或邮件发送
+func (m *Merger) WriteTextReport(w io.Writer) error {
+	header := []string{"关键字段", "字段", "A表的值", "B表的值"}
+	var lines [][]string
+	for _, c := range m.conflicts {
+		for i, f := range c.Fields {
+			key := ""
+			if i == 0 {
+				key = c.Key
+			}
+			lines = append(lines, []string{key, f.Field, reportValue(f.A), reportValue(f.B)})
+		}
+	}
+	widths := make([]int, len(header))
+	for _, line := range append([][]string{header}, lines...) {
+		for i, cell := range line {
+			widths[i] = max(widths[i], textWidth(cell))
+		}
+	}
+	sep := make([]string, len(widths))
+	for i, n := range widths {
+		sep[i] = strings.Repeat("-", n)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "冲突报告：关键字段 [%s]，共 %d 条冲突\n\n", strings.Join(m.config.KeyFields, ","), len(m.conflicts))
+	writeReportLine(&sb, header, widths)
+	writeReportLine(&sb, sep, widths)
+	for i, line := range lines {
+		if i > 0 && line[0] != "" {
+			writeReportLine(&sb, sep, widths)
+		}
+		writeReportLine(&sb, line, widths)
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeReportLine 写入一行，各列按显示宽度补齐空格，列之间以 " | " 分隔
+func writeReportLine(sb *strings.Builder, cells []string, widths []int) {
+	for i, cell := range cells {
+		if i > 0 {
+			sb.WriteString(" | ")
+		}
+		sb.WriteString(cell)
+		if i < len(cells)-1 {
+			sb.WriteString(strings.Repeat(" ", widths[i]-textWidth(cell)))
+		}
+	}
+	sb.WriteString("\n")
+}
+
+// reportValue 报告中的单元格内容，换行和制表符替换为空格以免破坏对齐
+func reportValue(v *string) string {
+	return strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ").Replace(displayValue(v))
+}
+
+// textWidth 文本在等宽字体中的显示宽度，中日韩文字及全角字符按2计算
+func textWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		if isWideRune(r) {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// isWideRune 判断字符是否为宽字符（中日韩文字、全角符号等）
+func isWideRune(r rune) bool {
+	return (r >= 0x1100 && r <= 0x115F) || // 韩文字母
+		(r >= 0x2E80 && r <= 0xA4CF && r != 0x303F) || // 中日韩部首、符号、汉字
+		(r >= 0xAC00 && r <= 0xD7A3) || // 韩文音节
+		(r >= 0xF900 && r <= 0xFAFF) || // 中日韩兼容汉字
+		(r >= 0xFE30 && r <= 0xFE4F) || // 中日韩兼容标点
+		(r >= 0xFF00 && r <= 0xFF60) || // 全角字符
+		(r >= 0xFFE0 && r <= 0xFFE6) ||
+		(r >= 0x20000 && r <= 0x3FFFD)
+}
@@ -0,0 +1,68 @@
+package reconciler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteTextReportAlignsColumns(t *testing.T) {
+	cols := textCols("k", "name", "city")
+	dataA := []rowData{
+		row("k", "1", "name", "Tom", "city", "杭州"),
+		row("k", "22", "name", "Anna", "city", "line1\nline2"),
+		row("k", "3", "name", "Lily", "city", "x"),
+	}
+	dataB := []rowData{
+		row("k", "1", "name", "Thomas", "city", "宁波"),
+		row("k", "22", "name", "", "city", "y"),
+		row("k", "3", "name", "Lily", "city", "x"),
+	}
+	_, m := mergeMem(t, MergeConfig{KeyFields: []string{"k"}, AutoFillPolicy: Never}, cols, cols, dataA, dataB)
+	var buf bytes.Buffer
+	if err := m.WriteTextReport(&buf); err != nil {
+		t.Fatal(err)
+	}
+	report := buf.String()
+
+	var table []string
+	for _, line := range strings.Split(report, "\n") {
+		if strings.Contains(line, " | ") || strings.HasPrefix(line, "---") {
+			table = append(table, line)
+		}
+	}
+	// 表头 + 分隔线 + 4个字段行 + 2个冲突之间的分隔线
+	if len(table) != 7 {
+		t.Fatalf("报告表格 %d 行, want 7:\n%s", len(table), report)
+	}
+	// 各行的列分隔符位于相同的显示位置
+	positions := func(line string) []int {
+		var pos []int
+		for i := strings.Index(line, "|"); i >= 0; {
+			pos = append(pos, textWidth(line[:i]))
+			next := strings.Index(line[i+1:], "|")
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+		return pos
+	}
+	want := positions(table[0])
+	for _, line := range table[2:] {
+		if strings.HasPrefix(line, "---") {
+			continue
+		}
+		if got := positions(line); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+			t.Errorf("列未对齐: %q", line)
+		}
+	}
+	for _, s := range []string{"Thomas", "<空字符串>", "line1 line2", "宁波"} {
+		if !strings.Contains(report, s) {
+			t.Errorf("报告缺少 %q:\n%s", s, report)
+		}
+	}
+	if strings.Contains(report, "Lily") {
+		t.Error("完全相同的记录不应出现在报告中")
+	}
+}
@@ -0,0 +1,53 @@
+package reconciler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zituocn/logx"
+)
+
+// ResultSink 结果输出目标：合并结果写入C表（或C文件）后，依次交给 MergeConfig.Sinks 中的每个目标
+type ResultSink interface {
+	// WriteRows 写入全部结果行，fields 为输出字段的顺序（C表字段、元数据字段及影子列）
+	WriteRows(fields []string, rows []Row) error
+}
+
+// SinkFunc 函数形式的输出目标，例如用于回调通知或在内存中收集结果
+type SinkFunc func(fields []string, rows []Row) error
+
+// WriteRows 调用函数本身
+func (f SinkFunc) WriteRows(fields []string, rows []Row) error {
+	return f(fields, rows)
+}
+
+// CSVSink 将结果行写入CSV文件（首行为表头，NULL写为空单元格）
+type CSVSink struct {
+	Path string
+}
+
+// WriteRows 写入CSV文件
+func (s CSVSink) WriteRows(fields []string, rows []Row) error {
+	return writeCSVFile(s.Path, fields, rows)
+}
+
+// writeSinks 将结果行交给所有输出目标，某个目标失败不影响其余目标，错误汇总后返回
+func (m *Merger) writeSinks(rows []rowData) error {
+	if len(m.config.Sinks) == 0 {
+		return nil
+	}
+	m.infof("[信息] 正在写入 %d 个输出目标...\n", len(m.config.Sinks))
+	fields := m.outputFields()
+	out := make([]Row, len(rows))
+	for i := range rows {
+		out[i] = Row(rows[i].Values)
+	}
+	var errs []error
+	for i, sink := range m.config.Sinks {
+		if err := sink.WriteRows(fields, out); err != nil {
+			logx.Errorf("写入输出目标#%d失败: %v", i+1, err)
+			errs = append(errs, fmt.Errorf("写入输出目标#%d失败: %v", i+1, err))
+		}
+	}
+	return errors.Join(errs...)
+}
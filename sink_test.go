@@ -0,0 +1,63 @@
+package reconciler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSinksReceiveEveryRow(t *testing.T) {
+	db := newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"}, vals{"k": "2", "name": "Anna"})
+	db.insert("b", vals{"k": "2", "name": "Anne"}, vals{"k": "3", "name": "Lily"})
+	var collected []Row
+	var fields []string
+	csvPath := filepath.Join(t.TempDir(), "c.csv")
+	config := fakeConfig(db, "k")
+	config.Sinks = []ResultSink{
+		SinkFunc(func(f []string, rows []Row) error {
+			fields, collected = f, rows
+			return nil
+		}),
+		CSVSink{Path: csvPath},
+	}
+	runFake(t, config)
+
+	// C表和函数输出目标都收到全部3行
+	c := db.table("c")
+	if len(c.rows) != 3 || len(collected) != 3 {
+		t.Fatalf("C表 %d 行, 函数输出目标 %d 行, want 3", len(c.rows), len(collected))
+	}
+	for _, r := range collected {
+		k := *r["k"]
+		if value(c.find("k", k), "name") != value(r, "name") {
+			t.Errorf("k=%s: C表与函数输出目标的 name 不一致", k)
+		}
+	}
+	if len(fields) == 0 || fields[0] != "k" {
+		t.Errorf("fields = %v", fields)
+	}
+	if b, err := os.ReadFile(csvPath); err != nil || strings.Count(string(b), "\n") != 4 {
+		t.Errorf("CSV输出目标内容 = %q, err = %v", b, err)
+	}
+
+	// 某个目标失败不影响其余目标，错误汇总返回
+	db = newFakeSources(t, "k varchar(10)", "name varchar(50)")
+	db.insert("a", vals{"k": "1", "name": "Tom"})
+	config = fakeConfig(db, "k")
+	collected = nil
+	fail := SinkFunc(func([]string, []Row) error { return errors.New("webhook down") })
+	config.Sinks = []ResultSink{fail, SinkFunc(func(_ []string, rows []Row) error {
+		collected = rows
+		return nil
+	}), fail}
+	_, err := NewMerger(config).Run()
+	if err == nil || !strings.Contains(err.Error(), "#1") || !strings.Contains(err.Error(), "#3") {
+		t.Errorf("Run = %v, want 汇总 #1、#3 的错误", err)
+	}
+	if len(collected) != 1 {
+		t.Errorf("第2个输出目标收到 %d 行, want 1", len(collected))
+	}
+}
@@ -0,0 +1,74 @@
+package reconciler
+
+import (
+	"strings"
+)
+
+// TypeCoercion 数据类型不一致的字段的对比方式
+type TypeCoercion int
+
+const (
+	// CoerceString 按字符串原样对比
+	CoerceString TypeCoercion = iota
+	// CoerceNumeric 按数值对比，忽略前导零、末尾小数零等格式差异（如 DECIMAL 的 "12.50" 与 VARCHAR 的 "12.5"）
+	CoerceNumeric
+)
+
+// TypeMismatch A、B表中同名字段的数据类型不一致
+type TypeMismatch struct {
+	Field    string
+	TypeA    string // A表中的完整类型，如 decimal(10,2)
+	TypeB    string // B表中的完整类型，如 varchar(32)
+	Compared bool   // 是否仍参与对比：未开启 RefuseTypeMismatch，或在 TypeCoercions 中配置了对比方式
+}
+
+// checkTypeMismatches 找出A、B表中数据类型不一致的同名字段，记录到 MergeStats.TypeMismatches 并打印警告；
+// 开启 RefuseTypeMismatch 时，未配置 TypeCoercions 的字段不再参与对比（须在构建对比字段之后调用）
+func (m *Merger) checkTypeMismatches(keySet map[string]bool) {
+	typesB := make(map[string]ColumnInfo, len(m.columnsB))
+	for _, c := range m.columnsB {
+		typesB[c.Name] = c
+	}
+	var mismatches []TypeMismatch
+	refused := make(map[string]bool)
+	for _, a := range m.columnsA {
+		b, ok := typesB[a.Name]
+		if !ok || strings.EqualFold(a.DataType, b.DataType) {
+			continue
+		}
+		mm := TypeMismatch{Field: a.Name, TypeA: a.ColumnType, TypeB: b.ColumnType, Compared: true}
+		if _, coerced := m.config.TypeCoercions[a.Name]; m.config.RefuseTypeMismatch && !coerced && !keySet[a.Name] {
+			mm.Compared = false
+			refused[a.Name] = true
+		}
+		mismatches = append(mismatches, mm)
+		if mm.Compared {
+			m.infof("[警告] 字段[%s]类型不一致: A=%s B=%s\n", mm.Field, mm.TypeA, mm.TypeB)
+		} else {
+			m.infof("[警告] 字段[%s]类型不一致: A=%s B=%s，未配置 TypeCoercions，不参与对比\n", mm.Field, mm.TypeA, mm.TypeB)
+		}
+	}
+	m.setStats(func(s *MergeStats) { s.TypeMismatches = mismatches })
+	if len(refused) == 0 {
+		return
+	}
+	fields := m.compareFields[:0]
+	for _, f := range m.compareFields {
+		if !refused[f] {
+			fields = append(fields, f)
+		}
+	}
+	m.compareFields = fields
+}
+
+// coercedEqual 按 TypeCoercions 中配置的对比方式判断两个非 NULL 的值是否相同，ok 为 false 表示未配置
+func (m *Merger) coercedEqual(field, a, b string) (equal, ok bool) {
+	c, ok := m.config.TypeCoercions[field]
+	if !ok {
+		return false, false
+	}
+	if c == CoerceNumeric {
+		return normalizeNumeric(a) == normalizeNumeric(b), true
+	}
+	return a == b, true
+}